@@ -48,7 +48,7 @@ func (u Hasher) HashMem(addr unsafe.Pointer, size uintptr) uint {
 
 // HashBytes hashes the given byte slice.
 func (u Hasher) HashBytes(b []byte) uint {
-	return u.HashMem(unsafe.Pointer(&b[0]), uintptr(uint(len(b))))
+	return u.HashMem(unsafe.Pointer(unsafe.SliceData(b)), uintptr(len(b)))
 }
 
 // HashInt hashes v.
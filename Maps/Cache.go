@@ -0,0 +1,228 @@
+package Maps
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// cacheNode is the node of Cache, which is anyNode with its CLOCK bit.
+type cacheNode[K any, V any] struct {
+	anyNode[K, V]
+	ref atomic.Bool //set when the key is used, cleared when the clock hand passes it.
+}
+
+// Cache is a map holding at most a given number of keys. When a store exceeds the capacity, keys are evicted by CLOCK, which approximates evicting the least recently used keys: the clock hand moves over the keys in the order of hash, evicting the first key that isn't used since the hand last passed it. Eviction deletes keys the same way as Delete, so the buckets are merged as the map shrinks.
+// Values are kept the same way as ValAny, so overwriting a key doesn't allocate once there are enough boxes, and the CLOCK bit is kept in the node.
+//
+// Load, Store and Delete don't block. The clock hand is the hash it's at, which is advanced by CAS, so stores exceeding the capacity at the same time examine different keys. The number of keys can exceed the capacity by the number of stores in progress.
+type Cache[K any, V any] struct {
+	m        *base[K]
+	boxes    anyBoxes[V]
+	capacity int64
+	n        atomic.Int64 //number of keys, which is counted after adding and deleting.
+	onEvict  func(K, V)
+	hand     atomic.Uint64 //the smallest hash that isn't passed yet.
+}
+
+// NewCache is the constructor for Cache. The parameters except capacity and onEvict are the same as NewValPtr. onEvict is called with each key evicted by the clock hand, but not with keys given to Delete; it can be nil. It's called by the store that evicts the key, concurrently with other evictions, so it should be short.
+func NewCache[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, capacity uint, onEvict func(K, V)) *Cache[K, V] {
+	return NewCacheEq(minBucketSize, maxBucketSize, maxHash, hashF, equal[K], capacity, onEvict)
+}
+
+// NewCacheEq is NewCache for keys that aren't comparable, or whose equality isn't ==. eq is used the same way as NewValPtrEq.
+func NewCacheEq[K any, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool, capacity uint, onEvict func(K, V)) *Cache[K, V] {
+	c := &Cache[K, V]{m: &base[K]{MinAvgBucketSize: minBucketSize,
+		MaxAvgBucketSize: maxBucketSize,
+		maxLogChunkSize:  byte(bits.Len(maxHash)),
+		HashF:            hashF,
+		eq:               eq}, capacity: int64(capacity), onEvict: onEvict}
+	c.m.buckets = newChunkArr(c.m.maxLogChunkSize, c.m.maxLogChunkSize)
+	c.m.buckets.set(0, &c.m.firstRelay)
+	return c
+}
+
+func newCacheNode[K any, V any](hash uint, key K, val V) *cacheNode[K, V] {
+	n := &cacheNode[K, V]{anyNode: anyNode[K, V]{relay: relay{hash: hash}, key: key}}
+	n.inline.val, n.val = val, unsafe.Pointer(&n.inline)
+	return n
+}
+
+func (c *Cache[K, V]) hashed() *base[K] {
+	return c.m
+}
+
+// use marks n as used, avoiding writing to the shared cache line when it's already set.
+func (n *cacheNode[K, V]) use() {
+	if !n.ref.Load() {
+		n.ref.Store(true)
+	}
+}
+
+// delete n unless it's deleted already, returning the old value.
+func (c *Cache[K, V]) delete(n *cacheNode[K, V]) (old V, deleted bool) {
+	if p := atomic.SwapPointer(&n.val, tomb); p != tomb {
+		old = (*anyBox[V])(p).val
+		n.reuse(&c.boxes, p)
+		c.m.unlink(&n.relay)
+		c.n.Add(-1)
+		return old, true
+	}
+	return
+}
+
+// Load the value of key, marking key as used.
+func (c *Cache[K, V]) Load(key K) (v V, ok bool) {
+	hash := c.m.HashF(key)
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && c.m.eq((*cacheNode[K, V])(curAddr).key, key) {
+			if v, ok = (*cacheNode[K, V])(curAddr).load(); ok {
+				(*cacheNode[K, V])(curAddr).use()
+				return
+			}
+		}
+	}
+}
+
+// Store val to key, marking key as used when it's present. Returns whether key is added, in which case keys are evicted until the number of keys is within the capacity.
+func (c *Cache[K, V]) Store(key K, val V) bool {
+	hash := c.m.HashF(key)
+	c.m.begin(hash)
+	var new *cacheNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash)
+	}, c.m.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if new == nil {
+				new = newCacheNode(hash, key, val)
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				c.m.added(hash, &path)
+				c.m.trySplit()
+				c.m.end(hash)
+				c.added()
+				return true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && c.m.eq((*cacheNode[K, V])(rightAddr).key, key) {
+			if _, swapped := (*cacheNode[K, V])(rightAddr).swap(&c.boxes, val); swapped {
+				(*cacheNode[K, V])(rightAddr).use()
+				c.m.end(hash)
+				return false
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// LoadOrStore returns the value of key and true when key is present, marking key as used. Otherwise, it stores val to key like Store and returns val and false.
+func (c *Cache[K, V]) LoadOrStore(key K, val V) (V, bool) {
+	hash := c.m.HashF(key)
+	c.m.begin(hash)
+	var new *cacheNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash)
+	}, c.m.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if new == nil {
+				new = newCacheNode(hash, key, val)
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				c.m.added(hash, &path)
+				c.m.trySplit()
+				c.m.end(hash)
+				c.added()
+				return val, false
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && c.m.eq((*cacheNode[K, V])(rightAddr).key, key) {
+			if v, loaded := (*cacheNode[K, V])(rightAddr).load(); loaded {
+				(*cacheNode[K, V])(rightAddr).use()
+				c.m.end(hash)
+				return v, true
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// Delete key, reporting whether it was present. onEvict isn't called.
+func (c *Cache[K, V]) Delete(key K) bool {
+	hash := c.m.HashF(key)
+	c.m.begin(hash)
+	defer c.m.end(hash)
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&c.m.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && c.m.eq((*cacheNode[K, V])(curAddr).key, key) {
+			if _, deleted := c.delete((*cacheNode[K, V])(curAddr)); deleted {
+				return true
+			}
+		}
+	}
+}
+
+// added counts a key that's added, evicting keys when it exceeds the capacity.
+func (c *Cache[K, V]) added() {
+	if c.n.Add(1) > c.capacity {
+		c.evict()
+	}
+}
+
+// evict moves the clock hand until the number of keys is within the capacity. The hand is moved past the hash of the next node by CAS before the nodes of that hash are examined, so each of them is examined by one of the concurrent evictions.
+func (c *Cache[K, V]) evict() {
+	for c.n.Load() > c.capacity {
+		at := c.hand.Load()
+		cur := c.m.seek(uint(at))
+		for ; cur != nil && isRelay(cur); cur = (*relay)(addr(cur)).walk() {
+		}
+		if cur == nil {
+			c.hand.CompareAndSwap(at, 0) //the hand passed the last node, start over.
+			continue
+		}
+		hash := (*relay)(addr(cur)).hash
+		if !c.hand.CompareAndSwap(at, uint64(hash+1)) { //hash+1 wraps to 0 when hash is the largest.
+			continue
+		}
+		c.m.begin(hash)
+		for ; cur != nil && (*relay)(addr(cur)).hash == hash; cur = (*relay)(addr(cur)).walk() {
+			if a := (*cacheNode[K, V])(addr(cur)); !isRelay(cur) && !a.ref.Swap(false) {
+				if v, deleted := c.delete(a); deleted && c.onEvict != nil {
+					c.onEvict(a.key, v)
+				}
+			}
+		}
+		c.m.end(hash)
+	}
+}
+
+// Range over the keys in the Cache without marking them as used. Range isn't linearizable.
+func (c *Cache[K, V]) Range(yield func(K, V) bool) {
+	for cur, curAddr := c.m.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a := (*cacheNode[K, V])(curAddr); !a.yield(yield) {
+				break
+			}
+		}
+	}
+}
+
+// Size returns the number of keys, which is counted after adding and deleting, so it can exceed the capacity while stores are in progress.
+func (c *Cache[K, V]) Size() uint {
+	return uint(max(c.n.Load(), 0))
+}
+
+// Capacity returns the maximum number of keys.
+func (c *Cache[K, V]) Capacity() uint {
+	return uint(c.capacity)
+}
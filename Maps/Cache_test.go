@@ -0,0 +1,140 @@
+package Maps
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCache_Clock(t *testing.T) {
+	const capacity = testAddN / 4
+	evicted := map[testVPT]bool{}
+	mq := NewCache[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, capacity, func(k, v testVPT) {
+		if k != v || evicted[k] {
+			t.Fatal("wrong eviction", k, v)
+		}
+		evicted[k] = true
+	})
+	for i := range testVPT(capacity) {
+		if !mq.Store(i, i) {
+			t.Fatal("not added", i)
+		}
+	}
+	for i := testVPT(0); i < capacity; i += 2 {
+		if v, ok := mq.Load(i); !ok || v != i {
+			t.Fatal("wrong load", i, v, ok)
+		}
+	}
+	for i := testVPT(capacity); i < capacity*3/2; i++ {
+		mq.Store(i, i)
+	}
+	//the keys that weren't used are evicted first.
+	if len(evicted) != capacity/2 || mq.Size() != capacity {
+		t.Fatal("wrong number of evictions", len(evicted), mq.Size())
+	}
+	for i := range testVPT(capacity) {
+		if _, ok := mq.Load(i); ok == evicted[i] || ok != (i%2 == 0) {
+			t.Fatal("wrong key evicted", i)
+		}
+	}
+	if !mq.Delete(0) || mq.Delete(1) || len(evicted) != capacity/2 {
+		t.Fatal("wrong delete")
+	}
+	clear(evicted)
+	for i := testVPT(capacity * 3 / 2); i < testAddN; i++ {
+		if _, loaded := mq.LoadOrStore(i, i); loaded {
+			t.Fatal("wrong LoadOrStore", i)
+		}
+	}
+	n := uint(0)
+	for k, v := range mq.Range {
+		if k != v || evicted[k] {
+			t.Fatal("wrong range", k, v)
+		}
+		n++
+	}
+	if n != capacity || mq.Size() != capacity || len(evicted) != testAddN-capacity*3/2-1 {
+		t.Fatal("wrong size", n, mq.Size(), len(evicted))
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	const capacity = testAddNEach
+	var evictedN, deletedN [testThrdsN]int
+	var lock sync.Mutex
+	mq := NewCache[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, capacity, func(k, v testVPT) {
+		if k != v {
+			t.Error("wrong eviction", k, v)
+		}
+		lock.Lock()
+		evictedN[int(k)/testAddNEach]++
+		lock.Unlock()
+	})
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := testVPT(i * testAddNEach); j < testVPT((i+1)*testAddNEach); j++ {
+				mq.Store(j, j)
+				if v, ok := mq.Load(j); ok && v != j {
+					t.Error("wrong load", j, v)
+				}
+				if j%4 == 0 && mq.Delete(j) {
+					deletedN[i]++
+				}
+				if s := mq.Size(); s > capacity+testThrdsN {
+					t.Error("capacity exceeded", s)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for i := range testThrdsN {
+		total += evictedN[i] + deletedN[i]
+	}
+	if mq.Size() > capacity || int(mq.Size())+total != testAddNEach*testThrdsN {
+		t.Fatal("wrong count", mq.Size(), total)
+	}
+	n := uint(0)
+	for range mq.Range {
+		n++
+	}
+	if n != mq.Size() {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+}
+
+func TestCache_StoreAllocs(t *testing.T) { //overwriting a key reuses the box it swaps out, and using it sets the bit in the node.
+	mq := NewCache[testVPT, testAnyVal](testMinBSz, testMaxBSz, testMaxHash, testHashF, 1, nil)
+	mq.Store(0, testAnyVal{})
+	mq.Store(0, testAnyVal{1})
+	if a := testing.AllocsPerRun(testAddNEach, func() {
+		mq.Store(0, testAnyVal{2})
+		mq.Load(0)
+	}); a != 0 {
+		t.Fatal("overwriting allocates", a)
+	}
+	if v, ok := mq.Load(0); !ok || v != (testAnyVal{2}) {
+		t.Fatal("wrong value", v, ok)
+	}
+}
+
+func TestCache_StoreUses(t *testing.T) { //overwriting a key uses it like loading it.
+	var evicted []testVPT
+	mq := NewCache[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, 2, func(k, _ testVPT) {
+		evicted = append(evicted, k)
+	})
+	mq.Store(0, 0)
+	mq.Store(1, 1)
+	if mq.Store(0, 2) {
+		t.Fatal("overwriting adds")
+	}
+	mq.Store(2, 2)
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Fatal("wrong eviction", evicted)
+	}
+	if v, ok := mq.Load(0); !ok || v != 2 {
+		t.Fatal("wrong value", v, ok)
+	}
+}
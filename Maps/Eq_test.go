@@ -0,0 +1,164 @@
+package Maps
+
+import (
+	"hash/maphash"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValPtr_Bytes(t *testing.T) {
+	seed := maphash.MakeSeed()
+	for name, hashF := range map[string]func([]byte) uint{
+		"maphash": func(b []byte) uint { return uint(maphash.Bytes(seed, b)) },
+		"collide": func(b []byte) uint { //keys of the same length and last byte are only told apart by eq.
+			if len(b) == 0 {
+				return 0
+			}
+			return uint(len(b))<<8 | uint(b[len(b)-1])
+		},
+	} {
+		mq := NewValPtrBytes[testVPT](testMinBSz, testMaxBSz, hashF)
+		wg := sync.WaitGroup{}
+		wg.Add(testThrdsN)
+		for i := range testThrdsN {
+			go func() {
+				defer wg.Done()
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					v := testVPT(j)
+					//a fresh slice each time, so that keys are matched by content.
+					if !mq.StorePtr([]byte(strconv.Itoa(j)), &v) || mq.LoadPtr([]byte(strconv.Itoa(j))) != &v {
+						t.Error(name, "wrong store", j)
+						return
+					}
+					if j%2 == 1 && !mq.Delete([]byte(strconv.Itoa(j))) {
+						t.Error(name, "wrong delete", j)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if mq.Size() != testAddNEach*testThrdsN/2 {
+			t.Fatal(name, "wrong size", mq.Size())
+		}
+		for k, v := range mq.Range {
+			if string(k) != strconv.Itoa(int(*v)) || *v%2 == 1 {
+				t.Fatal(name, "wrong range", k, *v)
+			}
+		}
+		empty := testVPT(1)
+		if !mq.StorePtr(nil, &empty) || mq.LoadPtr([]byte{}) != &empty || !mq.Delete([]byte{}) {
+			t.Fatal(name, "empty key isn't equal to nil key")
+		}
+	}
+}
+
+func TestValUintptr_Eq(t *testing.T) {
+	//keys equal regardless of case, so they must also hash regardless of case.
+	mq := NewValUintptrEq[string, uintptr](testMinBSz, testMaxBSz, 1<<8, func(s string) uint { return uint(len(s)) }, strings.EqualFold)
+	keys := []string{"a", "B", "ab", "Ab", "abc"}
+	for i, k := range keys {
+		mq.Store(k, uintptr(i))
+	}
+	if mq.Size() != 4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	if v, ok := mq.Load("AB"); !ok || v != 3 {
+		t.Fatal("wrong load", v, ok)
+	}
+	if _, ok := mq.Load("b"); !ok {
+		t.Fatal("wrong load")
+	}
+	vals, _ := mq.LoadMany([]string{"A", "ABC", "aB"})
+	if vals[0] != 0 || vals[1] != 4 || vals[2] != 3 {
+		t.Fatal("wrong LoadMany", vals)
+	}
+	copied := mq.Copy()
+	if mq.CompareAndDelete("ABC", 4) != SUCCESS {
+		t.Fatal("wrong delete")
+	}
+	if _, ok := mq.Load("abc"); ok {
+		t.Fatal("not deleted")
+	}
+	if v, ok := copied.Load("aBc"); !ok || v != 4 {
+		t.Fatal("Copy should keep eq", v, ok)
+	}
+}
+
+// testFoldHash hashes strings regardless of case, so it can be used with strings.EqualFold.
+func testFoldHash(s string) uint {
+	return uint(len(s))
+}
+
+func TestValAny_Eq(t *testing.T) {
+	mq := NewValAnyEq[string, []int](testMinBSz, testMaxBSz, 1<<8, testFoldHash, strings.EqualFold)
+	for i, k := range []string{"a", "B", "ab", "Ab", "abc"} {
+		mq.Store(k, []int{i})
+	}
+	if mq.Size() != 4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	if v, ok := mq.Load("AB"); !ok || v[0] != 3 {
+		t.Fatal("wrong load", v, ok)
+	}
+	if mq.CompareAndSwap("aB", []int{5}, func(v []int) bool { return v[0] == 3 }) != SUCCESS {
+		t.Fatal("wrong CompareAndSwap")
+	}
+	if v, ok := mq.LoadAndDelete("ab"); !ok || v[0] != 5 {
+		t.Fatal("wrong delete", v, ok)
+	}
+	if v, ok := mq.Copy().Load("ABC"); !ok || v[0] != 4 {
+		t.Fatal("Copy should keep eq", v, ok)
+	}
+}
+
+func TestSet_Eq(t *testing.T) {
+	s := NewSetEq(testMinBSz, testMaxBSz, 1<<8, testFoldHash, strings.EqualFold)
+	for _, k := range []string{"a", "B", "ab", "Ab", "abc"} {
+		s.Add(k)
+	}
+	if s.Size() != 4 || !s.Has("A") || !s.Has("aB") || s.Has("ba") {
+		t.Fatal("wrong keys", s.Size())
+	}
+	o := NewSetEq(testMinBSz, testMaxBSz, 1<<8, testFoldHash, strings.EqualFold)
+	o.Add("AB")
+	o.Add("c")
+	if u := s.Union(o); u.Size() != 5 || !u.Has("C") {
+		t.Fatal("wrong union", u.Size())
+	}
+	if i := s.Intersect(o); i.Size() != 1 || !i.Has("ab") {
+		t.Fatal("wrong intersection", i.Size())
+	}
+	if !s.Remove("ABC") || s.Has("abc") || !s.Copy().Has("b") {
+		t.Fatal("wrong remove")
+	}
+}
+
+func TestMulti_Eq(t *testing.T) {
+	m := NewMultiEq[string, int](testMinBSz, testMaxBSz, 1<<8, testFoldHash, strings.EqualFold)
+	m.Add("ab", 1)
+	m.Add("AB", 2)
+	if m.Add("aB", 1) || m.Count("Ab") != 2 || !m.Has("ab", 2) {
+		t.Fatal("values of equal keys aren't together", m.Count("ab"))
+	}
+	m.Add("ba", 3)
+	if m.RemoveKey("AB") != 2 || m.Count("ba") != 1 {
+		t.Fatal("wrong RemoveKey")
+	}
+}
+
+func TestCache_Eq(t *testing.T) {
+	c := NewCacheEq[string, int](testMinBSz, testMaxBSz, 1<<8, testFoldHash, strings.EqualFold, 2, nil)
+	c.Store("ab", 1)
+	if c.Store("AB", 2) {
+		t.Fatal("equal key added")
+	}
+	if v, ok := c.Load("aB"); !ok || v != 2 {
+		t.Fatal("wrong load", v, ok)
+	}
+	if !c.Delete("Ab") || c.Size() != 0 {
+		t.Fatal("wrong delete", c.Size())
+	}
+}
@@ -0,0 +1,138 @@
+package Maps
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock tells Expiring the current time. Tests can use a Clock whose time is set by hand.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// expiringVal is never modified once stored, so replacing it by pointer tells whether the key is stored again.
+type expiringVal[V any] struct {
+	val      V
+	deadline int64 //UnixNano of the Clock.
+}
+
+// Expiring is a ValPtr whose keys expire after a time to live. An expired key is treated as absent and is deleted by the first call that finds it, or by Sweep. Deleting an expired key only succeeds when it isn't stored again meanwhile.
+type Expiring[K comparable, V any] struct {
+	m     *ValPtr[K, expiringVal[V]]
+	clock Clock
+}
+
+// NewExpiring is the constructor for Expiring. The parameters except clock are the same as NewValPtr. clock can be nil to use the system time.
+func NewExpiring[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, clock Clock) *Expiring[K, V] {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Expiring[K, V]{NewValPtr[K, expiringVal[V]](minBucketSize, maxBucketSize, maxHash, hashF), clock}
+}
+
+func (e *Expiring[K, V]) now() int64 {
+	return e.clock.Now().UnixNano()
+}
+
+// live returns the value of key when it's present and not expired. An expired value is deleted.
+func (e *Expiring[K, V]) live(key K, now int64) *expiringVal[V] {
+	if v := e.m.LoadPtr(key); v != nil {
+		if now < v.deadline {
+			return v
+		}
+		e.m.ComparePtrAndDelete(key, v)
+	}
+	return nil
+}
+
+// StoreWithTTL stores val to key, which expires after ttl. Returns whether key is added, which includes replacing an expired key. A deadline past the largest time the Clock can tell is saturated to it, so key never expires.
+func (e *Expiring[K, V]) StoreWithTTL(key K, val V, ttl time.Duration) bool {
+	now, added := e.now(), false
+	new := &expiringVal[V]{val, math.MaxInt64}
+	if now < 0 || int64(ttl) <= math.MaxInt64-now {
+		new.deadline = now + int64(ttl)
+	}
+	e.m.Compute(key, func(old *expiringVal[V], loaded bool) (*expiringVal[V], ComputeOp) {
+		added = !loaded || now >= old.deadline
+		return new, STORE
+	})
+	return added
+}
+
+// Load the value of key. Returns false when key is absent or expired.
+func (e *Expiring[K, V]) Load(key K) (v V, ok bool) {
+	if a := e.live(key, e.now()); a != nil {
+		return a.val, true
+	}
+	return
+}
+
+// Deadline returns when key expires. Returns false when key is absent or expired.
+func (e *Expiring[K, V]) Deadline(key K) (time.Time, bool) {
+	if a := e.live(key, e.now()); a != nil {
+		return time.Unix(0, a.deadline), true
+	}
+	return time.Time{}, false
+}
+
+// Delete key, reporting whether it was present and not expired.
+func (e *Expiring[K, V]) Delete(key K) bool {
+	a := e.m.LoadPtrAndDelete(key)
+	return a != nil && e.now() < a.deadline
+}
+
+// Range over the keys that aren't expired. Expired keys found are deleted. Range isn't linearizable.
+func (e *Expiring[K, V]) Range(yield func(K, V) bool) {
+	now := e.now()
+	for k, a := range e.m.Range {
+		if now >= a.deadline {
+			e.m.ComparePtrAndDelete(k, a)
+		} else if !yield(k, a.val) {
+			break
+		}
+	}
+}
+
+// Sweep deletes all expired keys and returns the number of keys deleted.
+func (e *Expiring[K, V]) Sweep() (n int) {
+	now := e.now()
+	for k, a := range e.m.Range {
+		if now >= a.deadline && e.m.ComparePtrAndDelete(k, a) == SUCCESS {
+			n++
+		}
+	}
+	return
+}
+
+// SweepEvery starts a goroutine that calls Sweep every interval, which is stopped by calling the returned function. stop returns after the goroutine exits, so no Sweep runs afterward, and it may be called more than once. It's only needed when expired keys aren't accessed to be deleted lazily.
+func (e *Expiring[K, V]) SweepEvery(interval time.Duration) (stop func()) {
+	done, exited, ticker := make(chan struct{}), make(chan struct{}), time.NewTicker(interval)
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-ticker.C:
+				e.Sweep()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		close(done)
+		<-exited
+	})
+}
+
+// Size includes the expired keys that aren't deleted yet.
+func (e *Expiring[K, V]) Size() uint {
+	return e.m.Size()
+}
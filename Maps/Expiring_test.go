@@ -0,0 +1,156 @@
+package Maps
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	nanos atomic.Int64
+}
+
+func (c *testClock) Now() time.Time {
+	return time.Unix(0, c.nanos.Load())
+}
+func (c *testClock) Advance(d time.Duration) {
+	c.nanos.Add(int64(d))
+}
+
+type countingClock struct {
+	testClock
+	calls atomic.Int64
+}
+
+func (c *countingClock) Now() time.Time {
+	c.calls.Add(1)
+	return c.testClock.Now()
+}
+
+func TestExpiring_TTL(t *testing.T) {
+	clock := &testClock{}
+	mq := NewExpiring[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, clock)
+	for i := range testVPT(testAddN) {
+		if !mq.StoreWithTTL(i, i, time.Duration(i%4+1)*time.Second) {
+			t.Fatal("not added", i)
+		}
+	}
+	if mq.StoreWithTTL(0, 0, time.Second) {
+		t.Fatal("replacing a live key is not an add")
+	}
+	clock.Advance(time.Second)
+	for i := range testVPT(testAddN) {
+		if v, ok := mq.Load(i); ok != (i%4 != 0) || ok && v != i {
+			t.Fatal("wrong load", i, v, ok)
+		}
+	}
+	if s := mq.Size(); s != testAddN*3/4 {
+		t.Fatal("expired keys are not deleted lazily", s)
+	}
+	if d, ok := mq.Deadline(1); !ok || !d.Equal(time.Unix(0, int64(2*time.Second))) {
+		t.Fatal("wrong deadline", d, ok)
+	}
+	clock.Advance(time.Second)
+	if n := mq.Sweep(); n != testAddN/4 {
+		t.Fatal("wrong sweep count", n)
+	}
+	n := 0
+	for k, v := range mq.Range {
+		if k != v || k%4 < 2 {
+			t.Fatal("wrong range", k, v)
+		}
+		n++
+	}
+	if n != testAddN/2 || mq.Size() != testAddN/2 {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+	clock.Advance(time.Second)
+	if mq.Delete(2) || !mq.Delete(3) {
+		t.Fatal("Delete should report only live keys")
+	}
+	if !mq.StoreWithTTL(6, 6, time.Second) {
+		t.Fatal("replacing an expired key is an add")
+	}
+	for range mq.Range {
+	}
+	if s := mq.Size(); s != testAddN/4 {
+		t.Fatal("Range should delete expired keys", s)
+	}
+}
+
+func TestExpiring_MaxTTL(t *testing.T) { //the deadline saturates instead of wrapping to the past.
+	clock := &testClock{}
+	clock.Advance(time.Hour)
+	mq := NewExpiring[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, clock)
+	if !mq.StoreWithTTL(0, 0, math.MaxInt64) {
+		t.Fatal("not added")
+	}
+	if d, ok := mq.Deadline(0); !ok || d.UnixNano() != math.MaxInt64 {
+		t.Fatal("wrong deadline", d, ok)
+	}
+	clock.Advance(time.Hour)
+	if v, ok := mq.Load(0); !ok || v != 0 {
+		t.Fatal("expired", v, ok)
+	}
+}
+
+func TestExpiring_Concurrent(t *testing.T) {
+	clock := &testClock{}
+	mq := NewExpiring[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, clock)
+	stop := mq.SweepEvery(time.Microsecond)
+	defer stop()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := testVPT(i * testAddNEach); j < testVPT((i+1)*testAddNEach); j++ {
+				mq.StoreWithTTL(j, j, time.Second)
+				clock.Advance(time.Millisecond)
+				//a key stored again must not be deleted as expired by the sweeper or other loads.
+				mq.StoreWithTTL(j, j, time.Hour)
+				if v, ok := mq.Load(j); !ok || v != j {
+					t.Error("lost", j)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := mq.Size(); s != testAddNEach*testThrdsN {
+		t.Fatal("wrong size", s)
+	}
+	clock.Advance(time.Hour)
+	deadline := time.Now().Add(10 * time.Second)
+	for mq.Size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper didn't delete expired keys", mq.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+func TestExpiring_SweepEvery_Stop(t *testing.T) {
+	clock := &countingClock{}
+	mq := NewExpiring[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF, clock)
+	stop := mq.SweepEvery(time.Microsecond)
+	for clock.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN { //stopping more than once, even concurrently, must not panic.
+		go func() {
+			defer wg.Done()
+			stop()
+		}()
+	}
+	wg.Wait()
+	calls := clock.calls.Load()
+	time.Sleep(10 * time.Millisecond)
+	if c := clock.calls.Load(); c != calls {
+		t.Fatal("swept after stop returned", calls, c)
+	}
+	stop()
+}
@@ -0,0 +1,153 @@
+package Maps
+
+import (
+	"iter"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Multi maps a key to a set of values, which are compared by ==. Each pair of key and value is a node, and the nodes of a key are kept adjacent in the list: a value is linked before the first node of its key, or after all nodes of its hash when the key is absent. Since a node is never modified, all writes are linearizable.
+type Multi[K any, V comparable] struct {
+	base[K]
+}
+
+func NewMulti[K comparable, V comparable](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *Multi[K, V] {
+	return NewMultiEq[K, V](minBucketSize, maxBucketSize, maxHash, hashF, equal[K])
+}
+
+// NewMultiEq is NewMulti for keys that aren't comparable, or whose equality isn't ==. eq is used the same way as NewValPtrEq.
+func NewMultiEq[K any, V comparable](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool) *Multi[K, V] {
+	m := Multi[K, V]{
+		base[K]{MinAvgBucketSize: minBucketSize,
+			MaxAvgBucketSize: maxBucketSize,
+			maxLogChunkSize:  byte(bits.Len(maxHash)),
+			HashF:            hashF,
+			eq:               eq},
+	}
+	m.buckets = newChunkArr(m.maxLogChunkSize, m.maxLogChunkSize)
+	m.buckets.set(0, &m.firstRelay)
+	return &m
+}
+
+// Add val to the values of key, reporting whether it wasn't present.
+func (m *Multi[K, V]) Add(key K, val V) bool {
+	hash := m.HashF(key)
+	m.begin(hash)
+	defer m.end(hash)
+	var new *pairNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&m.buckets)))).Get(hash)
+	}, evictStack{}
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&m.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		rightAddr := addr(right)
+		if right != nil && (*relay)(rightAddr).hash == hash && !isRelay(right) && m.eq((*pairNode[K, V])(rightAddr).key, key) {
+			if m.find(right, key, val) != nil { //right is the first node of key.
+				return false
+			}
+		} else if right != nil && hash >= (*relay)(rightAddr).hash {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+			continue
+		}
+		if new == nil {
+			new = &pairNode[K, V]{relay{hash: hash}, key, val}
+		}
+		if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+			m.added(hash, nil) //the values of a key are a run of its hash by design.
+			m.trySplit()
+			return true
+		}
+	}
+}
+
+// find returns the node of key and val from cur to the end of the nodes of key, or nil.
+func (m *Multi[K, V]) find(cur unsafe.Pointer, key K, val V) *pairNode[K, V] {
+	for ; cur != nil && !isRelay(cur) && m.eq((*pairNode[K, V])(addr(cur)).key, key); cur = (*relay)(addr(cur)).walk() {
+		if n := (*pairNode[K, V])(addr(cur)); n.val == val {
+			return n
+		}
+	}
+	return nil
+}
+
+// first returns the first node of key, or nil.
+func (m *Multi[K, V]) first(key K, hash uint) unsafe.Pointer {
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&m.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return nil
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && m.eq((*pairNode[K, V])(curAddr).key, key) {
+			return cur
+		}
+	}
+}
+
+// Has reports whether val is a value of key.
+func (m *Multi[K, V]) Has(key K, val V) bool {
+	return m.find(m.first(key, m.HashF(key)), key, val) != nil
+}
+
+// RemoveValue removes val from the values of key, reporting whether it was present.
+func (m *Multi[K, V]) RemoveValue(key K, val V) bool {
+	hash := m.HashF(key)
+	m.begin(hash)
+	defer m.end(hash)
+	if n := m.find(m.first(key, hash), key, val); n != nil && n.mark() {
+		m.removed(hash)
+		m.tryMerge()
+		return true
+	}
+	return false
+}
+
+// RemoveKey removes all values of key and returns the number of values removed. It isn't linearizable when values are added to key concurrently.
+func (m *Multi[K, V]) RemoveKey(key K) (n int) {
+	hash := m.HashF(key)
+	m.begin(hash)
+	defer m.end(hash)
+	for cur := m.first(key, hash); cur != nil && !isRelay(cur) && m.eq((*pairNode[K, V])(addr(cur)).key, key); cur = (*relay)(addr(cur)).walk() {
+		if (*relay)(addr(cur)).mark() {
+			m.removed(hash)
+			n++
+		}
+	}
+	if n > 0 {
+		m.tryMerge()
+	}
+	return
+}
+
+// Values returns an iterator over the values of key. Like Range, it isn't linearizable.
+func (m *Multi[K, V]) Values(key K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for cur := m.first(key, m.HashF(key)); cur != nil && !isRelay(cur) && m.eq((*pairNode[K, V])(addr(cur)).key, key); cur = (*relay)(addr(cur)).walk() {
+			if !yield((*pairNode[K, V])(addr(cur)).val) {
+				break
+			}
+		}
+	}
+}
+
+// Count returns the number of values of key. Like Range, it isn't linearizable.
+func (m *Multi[K, V]) Count(key K) (n int) {
+	for range m.Values(key) {
+		n++
+	}
+	return
+}
+
+// Clear deletes all keys the same way as ValPtr.Clear.
+func (m *Multi[K, V]) Clear() {
+	m.clear((*relay).mark)
+}
+
+// Range over the pairs of key and value in the map, stopping when yield returns false. The values of a key are given consecutively. Range isn't linearizable.
+func (m *Multi[K, V]) Range(yield func(K, V) bool) {
+	for cur, curAddr := m.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a := (*pairNode[K, V])(curAddr); !yield(a.key, a.val) {
+				break
+			}
+		}
+	}
+}
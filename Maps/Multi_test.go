@@ -0,0 +1,64 @@
+package Maps
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestMulti_Concurrent(t *testing.T) {
+	const keys = testAddNEach
+	collide := func(a testVPT) uint { return uint(a >> 2) } //4 keys share each hash.
+	mq := NewMulti[testVPT, int](testMinBSz, testMaxBSz, testMaxHash, collide)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testVPT(keys) {
+				if !mq.Add(j, i) || mq.Add(j, i) || !mq.Has(j, i) {
+					t.Error("wrong add", j, i)
+					return
+				}
+				if i%2 == 1 && (!mq.RemoveValue(j, i) || mq.RemoveValue(j, i) || mq.Has(j, i)) {
+					t.Error("wrong remove", j, i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != keys*testThrdsN/2 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	for j := range testVPT(keys) {
+		vals := slices.Sorted(mq.Values(j))
+		if mq.Count(j) != testThrdsN/2 || len(vals) != testThrdsN/2 {
+			t.Fatal("wrong count", j, vals)
+		}
+		for i, v := range vals {
+			if v != i*2 {
+				t.Fatal("wrong values", j, vals)
+			}
+		}
+	}
+	//the values of a key are adjacent.
+	seen := map[testVPT]bool{}
+	last := testVPT(keys)
+	for k := range mq.Range {
+		if k != last {
+			if seen[k] {
+				t.Fatal("values of key aren't adjacent", k)
+			}
+			seen[k], last = true, k
+		}
+	}
+	for j := testVPT(0); j < keys; j += 2 {
+		if n := mq.RemoveKey(j); n != testThrdsN/2 || mq.Count(j) != 0 {
+			t.Fatal("wrong RemoveKey", j, n)
+		}
+	}
+	if mq.Size() != keys*testThrdsN/4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+}
@@ -0,0 +1,298 @@
+package Maps
+
+import (
+	"cmp"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+	"sync/atomic"
+	"unsafe"
+)
+
+const ordMaxLevels = 16 //each index level holds about 1/4 of the level below, so 16 levels serve up to 4^16 keys.
+
+// ordIndex is a node of an index level of Ordered, which skips to node in the list. Each level is linked by right in the order of key, starting from a head whose node is the first relay. Indices are only hints for where to start in the list, so losing one to a race only makes the search longer.
+type ordIndex struct {
+	node  *relay
+	down  *ordIndex //the index of node in the level below, nil in the lowest level.
+	right unsafe.Pointer
+	level byte //1 is the lowest level.
+}
+
+// Ordered is a map that keeps its keys in order, so that it can find the keys next to a key and range over the keys between 2 keys. Like ValPtr, it stores values by pointer, and nodes are deleted by the same tombs and marks. But the list is ordered by key, and chunkArr is replaced by index levels of a skip list, which find a node in the list in O(log n) expected time.
+// Operations on a single key are linearizable, while Floor, Ceiling, and the ranges aren't when keys in between are written concurrently. Inserts are lock-free rather than wait-free, since building the index of a key retries when the index changes.
+type Ordered[K any, V any] struct {
+	first relay
+	head  unsafe.Pointer //*ordIndex of the highest level.
+	cmp   func(K, K) int
+	size  atomic.Int64
+}
+
+// NewOrdered is the constructor for Ordered whose keys are in the order of cmp.Compare.
+func NewOrdered[K cmp.Ordered, V any]() *Ordered[K, V] {
+	return NewOrderedFunc[K, V](cmp.Compare[K])
+}
+
+// NewOrderedFunc is NewOrdered for keys in the order of compare, which returns a negative number, 0, or a positive number when a is less than, equal to, or greater than b, like cmp.Compare. Keys mustn't be modified once stored.
+func NewOrderedFunc[K any, V any](compare func(a, b K) int) *Ordered[K, V] {
+	o := &Ordered[K, V]{cmp: compare}
+	o.head = unsafe.Pointer(&ordIndex{node: &o.first, level: 1})
+	return o
+}
+
+// descend searches the index levels from the top for the last node whose key is less than key, or the first relay when there's none. Indices of deleted nodes are unlinked on the way. When preds isn't nil, preds[i] is set to the last index of level i+1 that's passed.
+func (o *Ordered[K, V]) descend(key K, preds *[ordMaxLevels]*ordIndex) *relay {
+	for q := (*ordIndex)(atomic.LoadPointer(&o.head)); ; {
+		if r := (*ordIndex)(atomic.LoadPointer(&q.right)); r != nil {
+			if n := (*ptrNode[K])(unsafe.Pointer(r.node)); atomic.LoadPointer(&n.val) == tomb {
+				atomic.CompareAndSwapPointer(&q.right, unsafe.Pointer(r), atomic.LoadPointer(&r.right))
+				continue
+			} else if o.cmp(n.key, key) < 0 {
+				q = r
+				continue
+			}
+		}
+		if preds != nil {
+			preds[q.level-1] = q
+		}
+		if q.down == nil {
+			return q.node
+		}
+		q = q.down
+	}
+}
+
+// compare compares key with the key of the node at tagged.
+func (o *Ordered[K, V]) compare(key K, tagged unsafe.Pointer) (*ptrNode[K], int) {
+	n := (*ptrNode[K])(addr(tagged))
+	return n, o.cmp(key, n.key)
+}
+
+// start is where the list is searched from for key.
+func (o *Ordered[K, V]) start(key K) *relay {
+	return o.descend(key, nil)
+}
+
+// index links new indices of n into a random number of levels, from the lowest up. It stops when n is deleted meanwhile.
+func (o *Ordered[K, V]) index(n *ptrNode[K]) {
+	levels := byte(min(bits.TrailingZeros64(rand.Uint64())/2, ordMaxLevels)) //a key has at least i levels with probability 1/4^i.
+	if levels == 0 {
+		return
+	}
+	for h := (*ordIndex)(atomic.LoadPointer(&o.head)); h.level < levels; h = (*ordIndex)(atomic.LoadPointer(&o.head)) {
+		atomic.CompareAndSwapPointer(&o.head, unsafe.Pointer(h), unsafe.Pointer(&ordIndex{node: &o.first, down: h, level: h.level + 1}))
+	}
+	var preds [ordMaxLevels]*ordIndex
+	o.descend(n.key, &preds)
+	var down *ordIndex
+	for level := byte(1); level <= levels; level++ {
+		idx := &ordIndex{node: &n.relay, down: down, level: level}
+		for {
+			if atomic.LoadPointer(&n.val) == tomb {
+				return
+			}
+			q := preds[level-1]
+			r := atomic.LoadPointer(&q.right)
+			if r == nil || o.cmp(n.key, (*ptrNode[K])(unsafe.Pointer((*ordIndex)(r).node)).key) < 0 { //the index must go right after q.
+				if idx.right = r; atomic.CompareAndSwapPointer(&q.right, r, unsafe.Pointer(idx)) {
+					break
+				}
+			}
+			o.descend(n.key, &preds)
+		}
+		down = idx
+	}
+}
+
+// unlink marks n after its value is replaced by tomb. Only the one who wrote tomb may call it. Its indices are unlinked by later searches.
+func (o *Ordered[K, V]) unlink(n *ptrNode[K]) {
+	n.mark()
+	o.size.Add(-1)
+}
+
+// Has reports whether a key is present, regardless of the value.
+func (o *Ordered[K, V]) Has(key K) bool {
+	for cur := o.start(key).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(key, cur); c < 0 {
+			return false
+		} else if c == 0 && atomic.LoadPointer(&n.val) != tomb {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPtr returns the pointer to the value of a key. Returns nil when key isn't found.
+func (o *Ordered[K, V]) LoadPtr(key K) *V {
+	for cur := o.start(key).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(key, cur); c < 0 {
+			return nil
+		} else if c == 0 {
+			if v := atomic.LoadPointer(&n.val); v != tomb {
+				return (*V)(v)
+			}
+		}
+	}
+	return nil
+}
+
+// store links a node of key and val after the deleted nodes of key, or calls found with the value of the node of key that's present. found returns whether it's done with the node; otherwise the search goes on, since the node is deleted meanwhile. Returns whether key is added.
+func (o *Ordered[K, V]) store(key K, val *V, found func(n *ptrNode[K]) bool) bool {
+	var new *ptrNode[K]
+	fb, path := func() *relay {
+		return o.start(key)
+	}, evictStack{}
+	for left, right := o.start(key).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		rightAddr, c := addr(right), -1
+		if right != nil {
+			_, c = o.compare(key, right)
+		}
+		if c < 0 {
+			if new == nil {
+				new = &ptrNode[K]{relay{}, unsafe.Pointer(val), key}
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				o.size.Add(1)
+				o.index(new)
+				return true
+			}
+		} else if c == 0 && found((*ptrNode[K])(rightAddr)) {
+			return false
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// StorePtr of the value of a given key. Returns whether key is added.
+func (o *Ordered[K, V]) StorePtr(key K, val *V) bool {
+	return o.store(key, val, func(n *ptrNode[K]) bool {
+		return casLive(&n.val, unsafe.Pointer(val)) != tomb
+	})
+}
+
+// LoadOrStorePtr stores val to key when key wasn't present and returns nil or returns the pointer to the value corresponding to key.
+func (o *Ordered[K, V]) LoadOrStorePtr(key K, val *V) (actual *V) {
+	o.store(key, val, func(n *ptrNode[K]) bool {
+		if v := atomic.LoadPointer(&n.val); v != tomb {
+			actual = (*V)(v)
+			return true
+		}
+		return false
+	})
+	return
+}
+
+// LoadPtrAndDelete returns the pointer to the value of the deleted key. Returns nil when key isn't found.
+func (o *Ordered[K, V]) LoadPtrAndDelete(key K) *V {
+	for cur := o.start(key).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(key, cur); c < 0 {
+			return nil
+		} else if c == 0 {
+			if old := atomic.SwapPointer(&n.val, tomb); old != tomb {
+				o.unlink(n)
+				return (*V)(old)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete a key from the map, reporting whether it was present.
+func (o *Ordered[K, V]) Delete(key K) bool {
+	for cur := o.start(key).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(key, cur); c < 0 {
+			return false
+		} else if c == 0 && atomic.SwapPointer(&n.val, tomb) != tomb {
+			o.unlink(n)
+			return true
+		}
+	}
+	return false
+}
+
+// Ceiling returns the smallest key that's at least key, with its value. ok is false when there's none.
+func (o *Ordered[K, V]) Ceiling(key K) (k K, v *V, ok bool) {
+	for cur := o.start(key).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(key, cur); c <= 0 {
+			if val := atomic.LoadPointer(&n.val); val != tomb {
+				return n.key, (*V)(val), true
+			}
+		}
+	}
+	return
+}
+
+// Floor returns the largest key that's at most key, with its value. ok is false when there's none.
+func (o *Ordered[K, V]) Floor(key K) (k K, v *V, ok bool) {
+	//the list only goes forward, so the last present key up to bound after where the search starts is the floor. When all keys there are deleted, the floor is before the start, which is searched next.
+	for bound, strict := key, false; ; strict = true {
+		from := o.start(bound)
+		for cur := unsafe.Pointer(from); cur != nil; cur = addr((*relay)(cur).walk()) {
+			if cur == unsafe.Pointer(&o.first) {
+				continue
+			} else if n, c := o.compare(bound, cur); c < 0 || strict && c == 0 {
+				break
+			} else if val := atomic.LoadPointer(&n.val); val != tomb {
+				k, v, ok = n.key, (*V)(val), true
+			}
+		}
+		if ok || from == &o.first {
+			return
+		}
+		bound = (*ptrNode[K])(unsafe.Pointer(from)).key
+	}
+}
+
+// RangeBetween ranges over the keys from lo up to but not including hi in order. It isn't linearizable.
+func (o *Ordered[K, V]) RangeBetween(lo, hi K, yield func(K, *V) bool) {
+	for cur := o.start(lo).walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if n, c := o.compare(hi, cur); c <= 0 {
+			return
+		} else if v := atomic.LoadPointer(&n.val); v != tomb && o.cmp(n.key, lo) >= 0 && !yield(n.key, (*V)(v)) {
+			return
+		}
+	}
+}
+
+// Between returns an iterator over the keys from lo up to but not including hi in order. It's the same as RangeBetween.
+func (o *Ordered[K, V]) Between(lo, hi K) iter.Seq2[K, *V] {
+	return func(yield func(K, *V) bool) {
+		o.RangeBetween(lo, hi, yield)
+	}
+}
+
+// Range over all keys in order. Range isn't linearizable.
+func (o *Ordered[K, V]) Range(yield func(K, *V) bool) {
+	for cur := o.first.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		n := (*ptrNode[K])(addr(cur))
+		if v := atomic.LoadPointer(&n.val); v != tomb && !yield(n.key, (*V)(v)) { //v is loaded once, since a Delete may write tomb after it's checked.
+			return
+		}
+	}
+}
+
+// All returns an iterator over the key value pairs in order. It's the same as Range, so it isn't linearizable either.
+func (o *Ordered[K, V]) All() iter.Seq2[K, *V] {
+	return o.Range
+}
+
+// Keys returns an iterator over the keys in order.
+func (o *Ordered[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		o.Range(func(k K, _ *V) bool { return yield(k) })
+	}
+}
+
+// Values returns an iterator over the pointers to the values in the order of their keys.
+func (o *Ordered[K, V]) Values() iter.Seq[*V] {
+	return func(yield func(*V) bool) {
+		o.Range(func(_ K, v *V) bool { return yield(v) })
+	}
+}
+
+// Size isn't linearizable, and it's off by the number of writes in progress.
+func (o *Ordered[K, V]) Size() uint {
+	return uint(max(o.size.Load(), 0))
+}
@@ -0,0 +1,203 @@
+package Maps
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+// testOrderedModel checks every query of mq against keys, the sorted keys that mq should hold with themselves as values.
+func testOrderedModel(t *testing.T, mq *Ordered[testVPT, testVPT], keys []testVPT) {
+	t.Helper()
+	if got := slices.Collect(mq.Keys()); !slices.Equal(got, keys) || mq.Size() != uint(len(keys)) {
+		t.Fatal("wrong keys", len(got), len(keys), mq.Size())
+	}
+	for k := range testVPT(testMaxHash + 2) {
+		i, found := slices.BinarySearch(keys, k)
+		if v := mq.LoadPtr(k); found != (v != nil) || found != mq.Has(k) || v != nil && *v != k {
+			t.Fatal("wrong load", k, v)
+		}
+		if c, v, ok := mq.Ceiling(k); ok != (i < len(keys)) || ok && (c != keys[i] || *v != c) {
+			t.Fatal("wrong ceiling", k, c, ok)
+		}
+		if !found {
+			i--
+		}
+		if f, v, ok := mq.Floor(k); ok != (i >= 0) || ok && (f != keys[i] || *v != f) {
+			t.Fatal("wrong floor", k, f, ok)
+		}
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	mq := NewOrdered[testVPT, testVPT]()
+	r := rand.New(rand.NewPCG(1, 2))
+	present := map[testVPT]bool{}
+	all := make([]testVPT, testMaxHash+1)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	for range testAddN {
+		k := testVPT(r.IntN(len(all)))
+		switch r.IntN(3) {
+		case 0:
+			if mq.StorePtr(k, &all[k]) == present[k] {
+				t.Fatal("wrong store", k)
+			}
+			present[k] = true
+		case 1:
+			if v := mq.LoadOrStorePtr(k, &all[k]); (v != nil) != present[k] {
+				t.Fatal("wrong LoadOrStore", k)
+			}
+			present[k] = true
+		case 2:
+			if mq.Delete(k) != present[k] {
+				t.Fatal("wrong delete", k)
+			}
+			delete(present, k)
+		}
+	}
+	keys := make([]testVPT, 0, len(present))
+	for k := range present {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	testOrderedModel(t, mq, keys)
+
+	lo, hi := keys[len(keys)/4], keys[len(keys)/2]
+	var between []testVPT
+	for k, v := range mq.Between(lo, hi) {
+		if k != *v {
+			t.Fatal("wrong value", k, *v)
+		}
+		between = append(between, k)
+	}
+	if i, j := len(keys)/4, len(keys)/2; !slices.Equal(between, keys[i:j]) {
+		t.Fatal("wrong RangeBetween", between, keys[i:j])
+	}
+	for k := range mq.Between(lo, hi) {
+		if k != lo {
+			t.Fatal("break is ignored")
+		}
+		break
+	}
+	for _, k := range keys {
+		if v := mq.LoadPtrAndDelete(k); v == nil || *v != k {
+			t.Fatal("wrong LoadPtrAndDelete", k, v)
+		}
+	}
+	testOrderedModel(t, mq, nil)
+}
+
+func TestOrdered_Concurrent(t *testing.T) {
+	mq := NewOrdered[testVPT, testVPT]()
+	all := make([]testVPT, testAddNEach*testThrdsN)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j*testThrdsN + i) //the goroutines insert next to each other.
+				all[k] = k
+				if !mq.StorePtr(k, &all[k]) {
+					t.Error("not added", k)
+					return
+				}
+				if j%2 == 1 {
+					if !mq.Delete(k - testThrdsN) {
+						t.Error("not deleted", k-testThrdsN)
+						return
+					}
+				} else if f, _, ok := mq.Floor(k); !ok || f != k {
+					t.Error("wrong floor", k, f)
+					return
+				} else if c, _, ok := mq.Ceiling(k); !ok || c != k {
+					t.Error("wrong ceiling", k, c)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	var keys []testVPT
+	for k := range testVPT(testAddNEach * testThrdsN) {
+		if k/testThrdsN%2 == 1 {
+			keys = append(keys, k)
+		}
+	}
+	testOrderedModel(t, mq, keys)
+}
+
+func TestOrdered_RangeDelete(t *testing.T) { //iterators and searches must never yield the value of a key deleted after it's checked.
+	const keys = 1 << 6 //few keys, so deletes often hit the node being read.
+	mq := NewOrdered[testVPT, testVPT]()
+	all := make([]testVPT, keys)
+	for k := range testVPT(keys) {
+		all[k] = k
+		mq.StorePtr(k, &all[k])
+	}
+	check := func(k testVPT, v *testVPT) bool {
+		if unsafe.Pointer(v) == tomb || *v != k {
+			t.Error("wrong value", k, v)
+			return false
+		}
+		return true
+	}
+	var done atomic.Bool
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				for j := 0; !done.Load(); j++ {
+					k := testVPT(j*testThrdsN+i) % keys
+					mq.Delete(k)
+					mq.StorePtr(k, &all[k])
+				}
+				return
+			}
+			for range 1 << 10 {
+				for k, v := range mq.All() {
+					if !check(k, v) {
+						return
+					}
+				}
+				for k, v := range mq.Between(keys/4, keys/2) {
+					if !check(k, v) {
+						return
+					}
+				}
+				for k := range testVPT(keys) {
+					if c, v, ok := mq.Ceiling(k); ok && !check(c, v) {
+						return
+					} else if f, v, ok := mq.Floor(k); ok && !check(f, v) {
+						return
+					}
+				}
+			}
+			done.Store(true)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOrderedFunc(t *testing.T) {
+	mq := NewOrderedFunc[string, int](func(a, b string) int { return strings.Compare(b, a) }) //descending.
+	for i, k := range []string{"b", "d", "a", "c"} {
+		mq.StorePtr(k, &i)
+	}
+	if got := slices.Collect(mq.Keys()); !slices.Equal(got, []string{"d", "c", "b", "a"}) {
+		t.Fatal("wrong order", got)
+	}
+	if f, _, _ := mq.Floor("bb"); f != "c" {
+		t.Fatal("wrong floor", f)
+	} else if c, _, _ := mq.Ceiling("bb"); c != "b" {
+		t.Fatal("wrong ceiling", c)
+	}
+}
@@ -0,0 +1,209 @@
+package Maps
+
+import (
+	"iter"
+	"math/bits"
+	"slices"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Set stores only keys, so its nodes carry no value. A key is removed by marking its node, so all of its methods are linearizable.
+type Set[K any] struct {
+	base[K]
+}
+
+func NewSet[K comparable](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *Set[K] {
+	return NewSetEq(minBucketSize, maxBucketSize, maxHash, hashF, equal[K])
+}
+
+// NewSetEq is NewSet for keys that aren't comparable, or whose equality isn't ==. eq is used the same way as NewValPtrEq.
+func NewSetEq[K any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool) *Set[K] {
+	s := Set[K]{
+		base[K]{MinAvgBucketSize: minBucketSize,
+			MaxAvgBucketSize: maxBucketSize,
+			maxLogChunkSize:  byte(bits.Len(maxHash)),
+			HashF:            hashF,
+			eq:               eq},
+	}
+	s.buckets = newChunkArr(s.maxLogChunkSize, s.maxLogChunkSize)
+	s.buckets.set(0, &s.firstRelay)
+	return &s
+}
+
+// Add key to the set, reporting whether it wasn't present.
+func (s *Set[K]) Add(key K) bool {
+	hash := s.HashF(key)
+	s.begin(hash)
+	defer s.end(hash)
+	var new *keyNode[K]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.buckets)))).Get(hash)
+	}, s.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if new == nil {
+				new = &keyNode[K]{relay{hash: hash}, key}
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				s.added(hash, &path)
+				s.trySplit()
+				return true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && s.eq((*keyNode[K])(rightAddr).key, key) {
+			return false
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// Has reports whether key is present.
+func (s *Set[K]) Has(key K) bool {
+	hash := s.HashF(key)
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && s.eq((*keyNode[K])(curAddr).key, key) {
+			return true
+		}
+	}
+}
+
+// Remove key from the set, reporting whether it was present.
+func (s *Set[K]) Remove(key K) bool {
+	hash := s.HashF(key)
+	s.begin(hash)
+	defer s.end(hash)
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && s.eq((*keyNode[K])(curAddr).key, key) {
+			if (*relay)(curAddr).mark() {
+				s.removed(hash)
+				s.tryMerge()
+				return true
+			}
+			return false
+		}
+	}
+}
+
+// Take returns a key in the set, or nil when the set is empty. The key isn't removed.
+func (s *Set[K]) Take() *K {
+	if n := s.first(&s.firstRelay); n != nil {
+		return &n.key
+	}
+	return nil
+}
+
+// Range over the keys in the set in the order of hash, stopping when yield returns false. Range isn't linearizable.
+func (s *Set[K]) Range(yield func(K) bool) {
+	for n := s.first(&s.firstRelay); n != nil && yield(n.key); n = s.first(&n.relay) {
+	}
+}
+
+// All returns an iterator over the keys in the set. It's the same as Range, so it isn't linearizable either.
+func (s *Set[K]) All() iter.Seq[K] {
+	return s.Range
+}
+
+// first returns the first key node after r, skipping relays.
+func (s *Set[K]) first(r *relay) *keyNode[K] {
+	for cur := r.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if !isRelay(cur) {
+			return (*keyNode[K])(addr(cur))
+		}
+	}
+	return nil
+}
+
+// emptyCopy makes an empty Set with the same parameters as s, and a builder with the same bucket count as s to fill it.
+func (s *Set[K]) emptyCopy() (*Set[K], listBuilder[K]) {
+	copied := &Set[K]{base[K]{MinAvgBucketSize: s.MinAvgBucketSize, MaxAvgBucketSize: s.MaxAvgBucketSize, maxLogChunkSize: s.maxLogChunkSize, HashF: s.HashF, eq: s.eq}}
+	return copied, copied.builder((*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.buckets)))).logChunkSize)
+}
+
+// Clear deletes all keys the same way as ValPtr.Clear.
+func (s *Set[K]) Clear() {
+	s.clear((*relay).mark)
+}
+
+func (s *Set[K]) Copy() *Set[K] {
+	copied, b := s.emptyCopy()
+	for n := s.first(&s.firstRelay); n != nil; n = s.first(&n.relay) {
+		b.link(&(&keyNode[K]{relay{hash: n.hash}, n.key}).relay)
+	}
+	b.done()
+	return copied
+}
+
+// Union returns a new set of the keys in s or o. The result has the parameters of s. s and o must have the same HashF and maxHash, which lets the sets be merged in 1 pass over both, and keys are compared by the eq of s. Like Range, it isn't linearizable.
+func (s *Set[K]) Union(o *Set[K]) *Set[K] {
+	return s.merge(o, true, true, true)
+}
+
+// Intersect returns a new set of the keys in both s and o, the same way as Union.
+func (s *Set[K]) Intersect(o *Set[K]) *Set[K] {
+	return s.merge(o, false, false, true)
+}
+
+// Difference returns a new set of the keys in s but not in o, the same way as Union.
+func (s *Set[K]) Difference(o *Set[K]) *Set[K] {
+	return s.merge(o, true, false, false)
+}
+
+// merge walks s and o together in the order of hash, keeping the keys only in s when onlyS, only in o when onlyO, and in both when both. Keys of equal hash are gathered to be compared with each other.
+func (s *Set[K]) merge(o *Set[K], onlyS, onlyO, both bool) *Set[K] {
+	merged, b := s.emptyCopy()
+	add := func(hash uint, key K) {
+		b.link(&(&keyNode[K]{relay{hash: hash}, key}).relay)
+	}
+	var groupS, groupO []K
+	for a, c := s.first(&s.firstRelay), o.first(&o.firstRelay); a != nil || c != nil; {
+		if c == nil || a != nil && a.hash < c.hash {
+			if onlyS {
+				add(a.hash, a.key)
+			}
+			a = s.first(&a.relay)
+		} else if a == nil || c.hash < a.hash {
+			if onlyO {
+				add(c.hash, c.key)
+			}
+			c = o.first(&c.relay)
+		} else {
+			hash := a.hash
+			for groupS = groupS[:0]; a != nil && a.hash == hash; a = s.first(&a.relay) {
+				groupS = append(groupS, a.key)
+			}
+			for groupO = groupO[:0]; c != nil && c.hash == hash; c = o.first(&c.relay) {
+				groupO = append(groupO, c.key)
+			}
+			for _, k := range groupS {
+				if slices.ContainsFunc(groupO, func(o K) bool { return s.eq(k, o) }) {
+					if both {
+						add(hash, k)
+					}
+				} else if onlyS {
+					add(hash, k)
+				}
+			}
+			if onlyO {
+				for _, k := range groupO {
+					if !slices.ContainsFunc(groupS, func(o K) bool { return s.eq(k, o) }) {
+						add(hash, k)
+					}
+				}
+			}
+		}
+	}
+	b.done()
+	for buckets := (*chunkArr)(nil); buckets != merged.buckets; { //the result can be much larger or smaller than s.
+		buckets = merged.buckets
+		if merged.trySplit(); buckets == merged.buckets {
+			merged.tryMerge()
+		}
+	}
+	return merged
+}
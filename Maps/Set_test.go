@@ -0,0 +1,93 @@
+package Maps
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSet_AddRemove(t *testing.T) {
+	mq := NewSet[testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := testVPT(i * testAddNEach); j < testVPT((i+1)*testAddNEach); j++ {
+				if !mq.Add(j) || mq.Add(j) || !mq.Has(j) {
+					t.Error("wrong add", j)
+					return
+				}
+				if j%2 == 1 && (!mq.Remove(j) || mq.Remove(j) || mq.Has(j)) {
+					t.Error("wrong remove", j)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testAddNEach*testThrdsN/2 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	n := testVPT(0)
+	for k := range mq.All() {
+		if k != n {
+			t.Fatal("wrong order", k, n)
+		}
+		n += 2
+	}
+	if n != testAddNEach*testThrdsN || *mq.Take() != 0 {
+		t.Fatal("wrong range", n)
+	}
+	copied := mq.Copy()
+	for k := range mq.All() {
+		if !copied.Remove(k) {
+			t.Fatal("not copied", k)
+		}
+	}
+	if copied.Size() != 0 || copied.Take() != nil {
+		t.Fatal("wrong copy", copied.Size())
+	}
+}
+
+func TestSet_Algebra(t *testing.T) {
+	collide := func(a testVPT) uint { return uint(a >> 2) } //keys of equal hash are compared by the merge.
+	a, b := NewSet[testVPT](testMinBSz, testMaxBSz, testMaxHash, collide), NewSet[testVPT](testMinBSz, testMaxBSz, testMaxHash, collide)
+	for i := range testVPT(testAddN) {
+		if i%2 == 0 {
+			a.Add(i)
+		}
+		if i%3 == 0 {
+			b.Add(i)
+		}
+	}
+	for name, c := range map[string]struct {
+		s    *Set[testVPT]
+		want func(testVPT) bool
+	}{
+		"Union":      {a.Union(b), func(i testVPT) bool { return i%2 == 0 || i%3 == 0 }},
+		"Intersect":  {a.Intersect(b), func(i testVPT) bool { return i%6 == 0 }},
+		"Difference": {a.Difference(b), func(i testVPT) bool { return i%2 == 0 && i%3 != 0 }},
+		"Empty":      {a.Intersect(NewSet[testVPT](testMinBSz, testMaxBSz, testMaxHash, collide)), func(testVPT) bool { return false }},
+	} {
+		n := uint(0)
+		for i := range testVPT(testAddN) {
+			if c.s.Has(i) != c.want(i) {
+				t.Fatal(name, "wrong key", i)
+			}
+			if c.want(i) {
+				n++
+			}
+		}
+		if c.s.Size() != n {
+			t.Fatal(name, "wrong size", c.s.Size(), n)
+		}
+		for k := range c.s.All() { //the result is an ordinary set.
+			if !c.s.Remove(k) {
+				t.Fatal(name, "can't remove", k)
+			}
+		}
+		if c.s.Size() != 0 || c.s.Add(1) != true {
+			t.Fatal(name, "wrong size after removing", c.s.Size())
+		}
+	}
+}
@@ -0,0 +1,791 @@
+package Maps
+
+import (
+	"iter"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ValAny stores keys and values by value, so values of any type can be used without allocating a pointer for each of them like ValPtr.
+// A value is kept inline in its node when the key is added; later writes to an existing key put the value in a box and swap it in, since values wider than a machine word can't be written atomically. A box that's swapped out is reused by later writes once no reader is copying from it, so overwriting keys doesn't allocate once there are enough boxes. Values are always returned by copy.
+// Values needn't be comparable, so CompareAndSwap and CompareAndDelete take a function deciding whether the current value is the expected one, like ValPtr.CompareAndSwap. They retry when the box is replaced concurrently, calling it again, which makes them lock-free instead of wait-free. Reads also retry when the box they start to copy from is swapped out, since it may be reused.
+type ValAny[K any, V any] struct {
+	base[K]
+	boxes anyBoxes[V]
+	obs   *observers[K, V] //nil unless OnChange is called.
+}
+
+func NewValAny[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *ValAny[K, V] {
+	return NewValAnyEq[K, V](minBucketSize, maxBucketSize, maxHash, hashF, equal[K])
+}
+
+// NewValAnyEq is NewValAny for keys that aren't comparable, or whose equality isn't ==. eq is used the same way as NewValPtrEq.
+func NewValAnyEq[K any, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool) *ValAny[K, V] {
+	va := ValAny[K, V]{
+		base: base[K]{MinAvgBucketSize: minBucketSize,
+			MaxAvgBucketSize: maxBucketSize,
+			maxLogChunkSize:  byte(bits.Len(maxHash)),
+			HashF:            hashF,
+			eq:               eq},
+	}
+	va.buckets = newChunkArr(va.maxLogChunkSize, va.maxLogChunkSize)
+	va.buckets.set(0, &va.firstRelay)
+	return &va
+}
+
+// NewValAnyFor is NewValAny with the hashF and maxHash picked by HashFor.
+func NewValAnyFor[K comparable, V any](minBucketSize, maxBucketSize byte) *ValAny[K, V] {
+	hashF, maxHash := HashFor[K]()
+	return NewValAny[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+}
+
+// NewValAnyFromSlice is NewValAny filled with vals[i] for keys[i] for all i, built the same way as NewValPtrFromSlice.
+func NewValAnyFromSlice[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, keys []K, vals []V) *ValAny[K, V] {
+	va := NewValAny[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+	va.build(va.sortUnique(keys), func(hash uint, i int) *relay {
+		return &newAnyNode(hash, keys[i], vals[i]).relay
+	})
+	return va
+}
+
+// NewValAnyFromSeq is NewValAnyFromSlice of the pairs in seq.
+func NewValAnyFromSeq[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, seq iter.Seq2[K, V]) *ValAny[K, V] {
+	var keys []K
+	var vals []V
+	for k, v := range seq {
+		keys, vals = append(keys, k), append(vals, v)
+	}
+	return NewValAnyFromSlice(minBucketSize, maxBucketSize, maxHash, hashF, keys, vals)
+}
+
+func newAnyNode[K any, V any](hash uint, key K, val V) *anyNode[K, V] {
+	n := &anyNode[K, V]{relay: relay{hash: hash}, key: key}
+	n.inline.val, n.val = val, unsafe.Pointer(&n.inline)
+	return n
+}
+
+// PoolNodes makes the map reuse the nodes of deleted keys the same way as ValPtr.PoolNodes. The boxes of later writes are reused regardless.
+func (va *ValAny[K, V]) PoolNodes() {
+	va.poolNodes(func(n unsafe.Pointer) {
+		*(*anyNode[K, V])(n) = anyNode[K, V]{}
+	})
+}
+
+// OnChange makes the map observable the same way as ValPtr.OnChange. The values in the changes are copies, so they don't keep boxes from being reused.
+func (va *ValAny[K, V]) OnChange(f func(Change[K, V])) {
+	va.obs = &observers[K, V]{onChange: f, eq: va.eq}
+	va.locks = va.obs.locks()
+}
+
+// Watch calls f after every write to key until cancel is called, the same way as ValPtr.Watch. Writes made through the pointer returned by LoadPtr are never observed.
+func (va *ValAny[K, V]) Watch(key K, f func(Change[K, V])) (cancel func()) {
+	if va.obs == nil {
+		panic("Maps: Watch requires OnChange")
+	}
+	return va.obs.watch(va.HashF(key), key, f)
+}
+
+// changed queues the change of key for the observers, which had old when loaded and has new when stored. A value that isn't there is given as zero.
+func (va *ValAny[K, V]) changed(hash uint, key K, old V, loaded bool, new V, stored bool) {
+	if va.obs != nil {
+		var c Change[K, V]
+		if c.Key, c.Loaded, c.Stored = key, loaded, stored; loaded {
+			c.Old = old
+		}
+		if stored {
+			c.New = new
+		}
+		va.obs.queue(hash, c)
+	}
+}
+
+// node returns a node for key, which is a free one when there is.
+func (va *ValAny[K, V]) node(hash uint, key K, val V) *anyNode[K, V] {
+	if va.writes == nil && va.nodes == nil {
+		return newAnyNode(hash, key, val)
+	}
+	var n *anyNode[K, V]
+	if va.nodes != nil {
+		n = (*anyNode[K, V])(va.nodes.get())
+	}
+	if n == nil {
+		n = new(anyNode[K, V])
+	}
+	n.hash, n.key = hash, key
+	va.keep(n, val)
+	return n
+}
+
+// keep val in n, which isn't shared yet, as its first value: inline, or as its first version when writes are tracked. The version is stamped by linked once n is linked.
+func (va *ValAny[K, V]) keep(n *anyNode[K, V], val V) {
+	if va.writes != nil {
+		n.val = unsafe.Pointer(&version[V]{val: val})
+	} else {
+		n.inline.val, n.val = val, unsafe.Pointer(&n.inline)
+	}
+}
+
+// TrackWrites makes the map count its writes and keep its values as versions the same way as ValPtr.TrackWrites. The values are no longer kept inline or in boxes, so every write allocates a version.
+func (va *ValAny[K, V]) TrackWrites() {
+	va.trackVersions(func(n *relay) {
+		a := (*anyNode[K, V])(unsafe.Pointer(n))
+		v := &version[V]{gone: a.val == tomb}
+		if !v.gone {
+			v.val = (*anyBox[V])(a.val).val
+		}
+		v.stamp.Store(1) //the first moment of the clock, which no snapshot precedes.
+		var zero V
+		a.val, a.inline.val = unsafe.Pointer(v), zero
+	}, func(n *relay, moment uint64) bool {
+		return at[V](va.writes, &(*anyNode[K, V])(unsafe.Pointer(n)).val, moment) != nil
+	})
+}
+
+// value copies the value of n, or returns false when n is deleted.
+func (va *ValAny[K, V]) value(n *anyNode[K, V]) (v V, ok bool) {
+	if va.writes == nil {
+		return n.load()
+	} else if h := head[V](va.writes, &n.val); !h.gone {
+		return h.val, true
+	}
+	return
+}
+
+// yield the key and value of n unless n is deleted, returning false when yield does.
+func (va *ValAny[K, V]) yield(n *anyNode[K, V], yield func(K, V) bool) bool {
+	v, ok := va.value(n)
+	return !ok || yield(n.key, v)
+}
+
+// head returns the newest version of n, or nil when n is deleted or writes aren't tracked.
+func (va *ValAny[K, V]) head(n *anyNode[K, V]) *version[V] {
+	if va.writes != nil {
+		if h := head[V](va.writes, &n.val); !h.gone {
+			return h
+		}
+	}
+	return nil
+}
+
+// acquire the box of n, or return nil when n is deleted or writes are tracked, since n has versions instead of boxes then.
+func (va *ValAny[K, V]) acquire(n *anyNode[K, V]) *anyBox[V] {
+	if va.writes != nil {
+		return nil
+	}
+	return acquire[V](&n.val)
+}
+
+// swap val into n unless n is deleted, returning the old value.
+func (va *ValAny[K, V]) swap(n *anyNode[K, V], val V) (old V, swapped bool) {
+	if va.writes != nil {
+		return swapLive(va.writes, &n.val, val, false)
+	}
+	return n.swap(&va.boxes, val)
+}
+
+// compareAndSwap replaces the value of n with new, or deletes n when del, only when eq(value)==true. Returns NULL when n is deleted.
+func (va *ValAny[K, V]) compareAndSwap(n *anyNode[K, V], new V, eq func(V) bool, del bool) CASResult {
+	if va.writes != nil {
+		for h := head[V](va.writes, &n.val); !h.gone; h = head[V](va.writes, &n.val) {
+			if !callEq(&va.base, n.hash, eq, h.val) {
+				return FAILED
+			} else if replace(va.writes, &n.val, h, new, del) {
+				if del {
+					va.unlink(&n.relay)
+				}
+				va.changed(n.hash, n.key, h.val, true, new, !del)
+				return SUCCESS
+			}
+		}
+		return NULL
+	}
+	var box *anyBox[V]
+	for b := acquire[V](&n.val); b != nil; b = acquire[V](&n.val) { //retry when the box is replaced. b is held until it's replaced, so it can't be reused and put back in between.
+		old := b.val
+		if !callEq(&va.base, n.hash, eq, old) {
+			b.readers.Add(-1)
+			if box != nil {
+				va.boxes.unbox(box)
+			}
+			return FAILED
+		}
+		to := tomb
+		if !del {
+			if box == nil {
+				box = va.boxes.box(new)
+			}
+			to = unsafe.Pointer(box)
+		}
+		swapped := atomic.CompareAndSwapPointer(&n.val, unsafe.Pointer(b), to)
+		if b.readers.Add(-1); swapped {
+			n.reuse(&va.boxes, unsafe.Pointer(b))
+			if del {
+				va.unlink(&n.relay)
+			}
+			va.changed(n.hash, n.key, old, true, new, !del)
+			return SUCCESS
+		}
+	}
+	if box != nil {
+		va.boxes.unbox(box)
+	}
+	return NULL
+}
+
+// delete n unless it's deleted already, returning the old value.
+func (va *ValAny[K, V]) delete(n *anyNode[K, V]) (old V, deleted bool) {
+	var zero V
+	if va.writes != nil {
+		old, deleted = swapLive(va.writes, &n.val, zero, true)
+	} else if p := atomic.SwapPointer(&n.val, tomb); p != tomb {
+		old, deleted = (*anyBox[V])(p).val, true
+		n.reuse(&va.boxes, p)
+	}
+	if deleted {
+		va.unlink(&n.relay)
+		va.changed(n.hash, n.key, old, true, zero, false)
+	}
+	return
+}
+
+func (va *ValAny[K, V]) LoadAndDelete(key K) (v V, loaded bool) {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			if v, loaded = va.delete((*anyNode[K, V])(curAddr)); loaded {
+				return
+			}
+		}
+	}
+}
+func (va *ValAny[K, V]) Load(key K) (v V, loaded bool) {
+	hash := va.HashF(key)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			if v, loaded = va.value((*anyNode[K, V])(curAddr)); loaded {
+				return
+			}
+		}
+	}
+}
+
+// LoadPtr to the current box of the given key; returns nil when key isn't present. The box is shared with all other readers and is replaced rather than modified by the map, so writing through the pointer isn't atomic and should be synchronized externally. The box is never reused once LoadPtr returns it. When nodes are pooled by PoolNodes, a value still inline in its node is moved to a box first, since the node is reused once key is deleted.
+func (va *ValAny[K, V]) LoadPtr(key K) *V {
+	hash := va.HashF(key)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return nil
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			n := (*anyNode[K, V])(curAddr)
+			if va.writes != nil {
+				if h := head[V](va.writes, &n.val); !h.gone {
+					return &h.val //a version is never reused.
+				}
+				continue
+			}
+			for b := acquire[V](&n.val); b != nil; b = acquire[V](&n.val) {
+				if b != &n.inline || va.nodes == nil {
+					return &b.val //b keeps the reader, so it isn't reused.
+				}
+				box := va.boxes.box(b.val)
+				box.readers.Add(1)
+				swapped := atomic.CompareAndSwapPointer(&n.val, unsafe.Pointer(b), unsafe.Pointer(box))
+				if b.readers.Add(-1); swapped {
+					return &box.val
+				}
+				box.readers.Add(-1)
+				va.boxes.unbox(box)
+			}
+		}
+	}
+}
+func (va *ValAny[K, V]) Store(key K, val V) (added bool) {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var new *anyNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash)
+	}, va.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if new == nil {
+				new = va.node(hash, key, val)
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				va.linked(&new.val)
+				va.added(hash, &path)
+				va.trySplit()
+				var zero V
+				va.changed(hash, key, zero, false, val, true)
+				return true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && va.eq((*anyNode[K, V])(rightAddr).key, key) {
+			if old, swapped := va.swap((*anyNode[K, V])(rightAddr), val); swapped {
+				va.changed(hash, key, old, true, val, true)
+				return false
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+func (va *ValAny[K, V]) LoadOrStore(key K, val V) (v V, loaded bool) {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var new *anyNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash)
+	}, va.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if new == nil {
+				new = va.node(hash, key, val)
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				va.linked(&new.val)
+				va.added(hash, &path)
+				va.trySplit()
+				va.changed(hash, key, v, false, val, true)
+				return
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && va.eq((*anyNode[K, V])(rightAddr).key, key) {
+			if v, loaded = va.value((*anyNode[K, V])(rightAddr)); loaded {
+				return
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// Compute atomically updates key with what f returns. f is called again when key is changed concurrently, so it should be free of side effects, and it's called without any lock held like ValPtr.Compute. Returns the value of key after the call and whether key is present.
+func (va *ValAny[K, V]) Compute(key K, f func(old V, loaded bool) (V, ComputeOp)) (v V, present bool) {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var new *anyNode[K, V]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash)
+	}, va.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			var zero V
+			val, op := callCompute(&va.base, hash, f, zero, false)
+			if op != STORE {
+				return
+			} else if new == nil {
+				new = va.node(hash, key, val)
+			} else {
+				va.keep(new, val)
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				va.linked(&new.val)
+				va.added(hash, &path)
+				va.trySplit()
+				va.changed(hash, key, zero, false, val, true)
+				return val, true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && va.eq((*anyNode[K, V])(rightAddr).key, key) {
+			n := (*anyNode[K, V])(rightAddr)
+			for h := va.head(n); h != nil; h = va.head(n) {
+				val, op := callCompute(&va.base, hash, f, h.val, true)
+				if op == KEEP {
+					return h.val, true
+				} else if !replace(va.writes, &n.val, h, val, op == DELETE) {
+					continue
+				} else if op == DELETE {
+					va.unlink(&n.relay)
+					va.changed(hash, key, h.val, true, v, false)
+					return
+				}
+				va.changed(hash, key, h.val, true, val, true)
+				return val, true
+			}
+			for b := va.acquire(n); b != nil; b = acquire[V](&n.val) { //b is held until it's replaced, so it can't be reused and put back in between.
+				old := b.val
+				val, op := callCompute(&va.base, hash, f, old, true)
+				if op == KEEP {
+					b.readers.Add(-1)
+					return old, true
+				}
+				new := tomb
+				if op == STORE {
+					new = unsafe.Pointer(va.boxes.box(val))
+				}
+				swapped := atomic.CompareAndSwapPointer(&n.val, unsafe.Pointer(b), new)
+				if b.readers.Add(-1); !swapped {
+					if op == STORE {
+						va.boxes.unbox((*anyBox[V])(new))
+					}
+					continue
+				}
+				n.reuse(&va.boxes, unsafe.Pointer(b))
+				if op == DELETE {
+					va.unlink(&n.relay)
+					va.changed(hash, key, old, true, v, false)
+					return
+				}
+				va.changed(hash, key, old, true, val, true)
+				return val, true
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+func (va *ValAny[K, V]) Swap(key K, val V) (old V, swapped bool) {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			if old, swapped = va.swap((*anyNode[K, V])(curAddr), val); swapped {
+				va.changed(hash, key, old, true, val, true)
+				return
+			}
+		}
+	}
+}
+
+// CompareAndSwap value of a given key. That is, set the value to new only when eq(value)==true. eq may be called more than once when the value is changed concurrently.
+func (va *ValAny[K, V]) CompareAndSwap(key K, new V, eq func(V) bool) CASResult {
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return NULL
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			if r := va.compareAndSwap((*anyNode[K, V])(curAddr), new, eq, false); r != NULL {
+				return r
+			}
+		}
+	}
+}
+
+// CompareAndDelete deletes key only when eq(value)==true, calling eq the same way as CompareAndSwap. Deleting is linearized at replacing the box, so it's ordered with all other operations on key.
+func (va *ValAny[K, V]) CompareAndDelete(key K, eq func(V) bool) CASResult {
+	var zero V
+	hash := va.HashF(key)
+	va.begin(hash)
+	defer va.end(hash)
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return NULL
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, key) {
+			if r := va.compareAndSwap((*anyNode[K, V])(curAddr), zero, eq, true); r != NULL {
+				return r
+			}
+		}
+	}
+}
+
+func (va *ValAny[K, V]) Take() (*K, V) {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	for cur := va.firstRelay.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if !isRelay(cur) {
+			if v, ok := va.value((*anyNode[K, V])(cur)); ok {
+				key := &(*anyNode[K, V])(cur).key
+				if va.nodes != nil { //the node may be reused once it's deleted.
+					k := *key
+					key = &k
+				}
+				return key, v
+			}
+		}
+	}
+	var v V
+	return nil, v
+}
+func (va *ValAny[K, V]) Range(yield func(K, V) bool) {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	for cur, curAddr := va.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a := (*anyNode[K, V])(curAddr); !va.yield(a, yield) {
+				break
+			}
+		}
+	}
+}
+
+// RangeFrom is Range over the keys whose hash isn't smaller than hash, in the order of hash.
+func (va *ValAny[K, V]) RangeFrom(hash uint, yield func(K, V) bool) {
+	if va.nodes != nil {
+		defer va.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := va.seek(hash), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a := (*anyNode[K, V])(curAddr); !va.yield(a, yield) {
+				break
+			}
+		}
+	}
+}
+
+// Scan is Range from where c is, in the order of hash. c is updated to the last key given to yield, so the next Scan with c starts after it. Scan isn't linearizable.
+func (va *ValAny[K, V]) Scan(c *Cursor, yield func(K, V) bool) {
+	if c.done {
+		return
+	}
+	if va.nodes != nil {
+		defer va.nodes.pin(c.hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr, seen := va.seek(c.hash), (unsafe.Pointer)(nil), c.skip; ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil {
+			c.done = true
+			return
+		} else if !isRelay(cur) {
+			a := (*anyNode[K, V])(curAddr)
+			if v, ok := va.value(a); ok && c.visit(a.hash, &seen) && !yield(a.key, v) {
+				break
+			}
+		}
+	}
+}
+
+// All returns an iterator over the key value pairs in the map. It's the same as Range, so it isn't linearizable either.
+func (va *ValAny[K, V]) All() iter.Seq2[K, V] {
+	return va.Range
+}
+
+// Keys returns an iterator over the keys in the map.
+func (va *ValAny[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		va.Range(func(k K, _ V) bool { return yield(k) })
+	}
+}
+
+// Values returns an iterator over the values in the map.
+func (va *ValAny[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		va.Range(func(_ K, v V) bool { return yield(v) })
+	}
+}
+
+// Insert stores the key value pairs from seq, overwriting existing keys. It's the counterpart of maps.Insert.
+func (va *ValAny[K, V]) Insert(seq iter.Seq2[K, V]) {
+	for k, v := range seq {
+		va.Store(k, v)
+	}
+}
+
+// StoreMany is Store of vals[i] to keys[i] for all i, reporting whether each key is added. Keys are sorted by hash first, so the list is traversed once instead of once per key. Equal keys are stored in the order they appear.
+func (va *ValAny[K, V]) StoreMany(keys []K, vals []V) []bool {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	order := va.sortByHash(keys)
+	added := make([]bool, len(keys))
+	var hash uint
+	var left *relay
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).Get(hash)
+	}, va.path()
+	for _, o := range order {
+		i := o.i
+		hash, left = o.hash, va.nearer(left, o.hash)
+		va.begin(hash)
+		var new *anyNode[K, V]
+		for l, right := left.crawl(&path, fb); ; l, right = l.crawl(&path, fb) {
+			if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+				if new == nil {
+					new = va.node(hash, keys[i], vals[i])
+				}
+				if new.next = right; l.tryLink(right, unsafe.Pointer(new)) {
+					va.linked(&new.val)
+					va.added(hash, &path)
+					va.trySplit()
+					var zero V
+					va.changed(hash, keys[i], zero, false, vals[i], true)
+					added[i], left = true, l
+					break
+				}
+			} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && va.eq((*anyNode[K, V])(rightAddr).key, keys[i]) {
+				if old, swapped := va.swap((*anyNode[K, V])(rightAddr), vals[i]); swapped {
+					va.changed(hash, keys[i], old, true, vals[i], true)
+					left = l //the next key may be equal, so it must start before this node.
+					break
+				}
+				path.Push(rightAddr)
+				l = (*relay)(rightAddr)
+			} else {
+				path.Push(rightAddr)
+				l = (*relay)(rightAddr)
+			}
+		}
+		va.end(hash)
+	}
+	return added
+}
+
+// LoadMany is Load of all keys, traversing the list once.
+func (va *ValAny[K, V]) LoadMany(keys []K) ([]V, []bool) {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	order := va.sortByHash(keys)
+	vals, loaded := make([]V, len(keys)), make([]bool, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = va.nearer(from, hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
+				break
+			} else if !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, keys[i]) {
+				if vals[i], loaded[i] = va.value((*anyNode[K, V])(curAddr)); loaded[i] {
+					break
+				}
+			}
+		}
+	}
+	return vals, loaded
+}
+
+// DeleteMany is LoadAndDelete of all keys without loading, traversing the list once. Reports whether each key is deleted; only the first of equal keys can be.
+func (va *ValAny[K, V]) DeleteMany(keys []K) []bool {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	order := va.sortByHash(keys)
+	deleted := make([]bool, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = va.nearer(from, hash)
+		va.begin(hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
+				break
+			} else if !isRelay(cur) && va.eq((*anyNode[K, V])(curAddr).key, keys[i]) {
+				if _, deleted[i] = va.delete((*anyNode[K, V])(curAddr)); deleted[i] {
+					break
+				}
+			}
+		}
+		va.end(hash)
+	}
+	return deleted
+}
+
+// Clear deletes all keys the same way as ValPtr.Clear, which requires TrackWrites likewise.
+func (va *ValAny[K, V]) Clear() bool {
+	return va.clear(func(n *relay) bool {
+		if !n.mark() {
+			return false
+		}
+		a := (*anyNode[K, V])(unsafe.Pointer(n))
+		if old, ok := va.value(a); ok {
+			var zero V
+			va.changed(n.hash, a.key, old, true, zero, false)
+		}
+		return true
+	})
+}
+
+func (va *ValAny[K, V]) Copy() *ValAny[K, V] {
+	return va.copy(va.value)
+}
+
+// copy the nodes whose value by val is present.
+func (va *ValAny[K, V]) copy(val func(n *anyNode[K, V]) (V, bool)) *ValAny[K, V] {
+	if va.nodes != nil {
+		defer va.nodes.pin(0).Add(-1)
+	}
+	copied := &ValAny[K, V]{base: base[K]{MinAvgBucketSize: va.MinAvgBucketSize, MaxAvgBucketSize: va.MaxAvgBucketSize, maxLogChunkSize: va.maxLogChunkSize, HashF: va.HashF, eq: va.eq}}
+	b := copied.builder((*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&va.buckets)))).logChunkSize)
+	for cur, curAddr := va.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			a := (*anyNode[K, V])(curAddr)
+			if v, ok := val(a); ok {
+				b.link(&newAnyNode(a.hash, a.key, v).relay)
+			}
+		}
+	}
+	b.done()
+	return copied
+}
+
+// Snapshot copies the map at a single moment without blocking writes the same way as ValPtr.Snapshot, reporting false unless writes are tracked by TrackWrites. Writes through LoadPtr aren't versioned, so they may be seen by a snapshot taken before them.
+func (va *ValAny[K, V]) Snapshot() (ValAnySnapshot[K, V], bool) {
+	var copied *ValAny[K, V]
+	ok := va.snapshot(func(moment uint64) {
+		copied = va.copy(func(n *anyNode[K, V]) (v V, ok bool) {
+			if h := at[V](va.writes, &n.val, moment); h != nil {
+				return h.val, true
+			}
+			return
+		})
+	})
+	return ValAnySnapshot[K, V]{copied}, ok
+}
+
+// ValAnySnapshot is a read-only view of a ValAny taken by Snapshot. All of its methods are linearizable since it never changes.
+type ValAnySnapshot[K any, V any] struct {
+	m *ValAny[K, V]
+}
+
+func (s ValAnySnapshot[K, V]) Load(key K) (V, bool) {
+	return s.m.Load(key)
+}
+func (s ValAnySnapshot[K, V]) Range(yield func(K, V) bool) {
+	s.m.Range(yield)
+}
+func (s ValAnySnapshot[K, V]) Size() uint {
+	return s.m.Size()
+}
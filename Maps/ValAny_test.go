@@ -0,0 +1,695 @@
+// Code generated by go generate; DO NOT EDIT.
+// Generated specializations of ValVal maps that exhausts atomicXXX functions based on ValUintptr.go and ValUintptr_test.go.
+package Maps
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testVAnyT int
+
+func TestValAny_LoadOrStore2(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testVAnyT(testThrdsN) {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.LoadOrStore(testVPT(j), j)
+				if a, b := mq.LoadOrStore(testVPT(j), j); !b || a != j {
+					t.Fail()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVAnyT(testThrdsN * testAddNEach) {
+		av, l := mq.LoadOrStore(testVPT(i), i)
+		if !l || av != i {
+			t.Fail()
+		}
+	}
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+}
+func TestValAny_LoadOrStore3(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	counts := make([]atomic.Uint32, testThrdsN*testAddNEach)
+	for range testThrdsN {
+		go func() {
+			for i := range testVAnyT(testThrdsN * testAddNEach) {
+				if _, b := mq.LoadOrStore(testVPT(i), i); !b {
+					counts[i].Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range counts {
+		if counts[i].Load() != 1 {
+			t.Fail()
+		}
+	}
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+}
+func TestValAny_LoadOrStore1(t *testing.T) {
+	std := make(map[testVPT]testVAnyT, testAddN/2)
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVAnyT(rand.Intn(testAddN)) {
+		k := testVPT(i)
+		if _, a := mq.LoadOrStore(k, i); a {
+			t.Fail()
+		}
+		if mq.Size() != uint(i)+1 {
+			t.Fail()
+		}
+		std[k] = i
+	}
+	for k, ev := range std {
+		av, b := mq.LoadOrStore(k, 0)
+		if !b || av != ev {
+			t.Fatal(av, ev)
+		}
+	}
+	if mq.Size() != uint(len(std)) {
+		t.Fail()
+	}
+}
+func TestValAny_Load_Store1(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVAnyT(testAddN) {
+		if !mq.Store(testVPT(i), i) {
+			t.Fail()
+		}
+		if mq.Size() != uint(i)+1 {
+			t.Fail()
+		}
+	}
+	for k := range testVAnyT(testAddN) {
+		if a, b := mq.Load(testVPT(k)); a != k || !b {
+			t.Fail()
+		}
+	}
+}
+func TestValAny_Load_Store2(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				if !mq.Store(testVPT(j), testVAnyT(j)) {
+					t.Fail()
+				}
+				if a, b := mq.Load(testVPT(j)); !b || a != testVAnyT(j) {
+					t.Fail()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+	for i := range testVAnyT(testThrdsN * testAddNEach) {
+		if a, b := mq.Load(testVPT(i)); a != i || !b {
+			t.Fail()
+		}
+	}
+}
+func TestValAny_Load_Store_Delete(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.Store(testVPT(j), testVAnyT(j))
+				if a, b := mq.Load(testVPT(j)); a != testVAnyT(j) || !b {
+					t.Error("didn't store", j, a)
+				}
+				mq.LoadAndDelete(testVPT(j))
+				if _, b := mq.Load(testVPT(j)); b {
+					t.Error("didn't delete", j)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != 0 {
+		t.Fail()
+	}
+}
+func TestValAny_Clear(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if mq.Store(1, 1); mq.Clear() || mq.Size() != 1 {
+		t.Fatal("cleared without tracking writes")
+	}
+	mq.TrackWrites()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.Store(testVPT(j), testVAnyT(j))
+				if a, b := mq.Load(testVPT(j)); b && a != testVAnyT(j) {
+					t.Error("wrong value", j, a)
+				}
+				if j%(testAddNEach/4) == 0 {
+					mq.Clear()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	n := uint(0)
+	for k, v := range mq.Range {
+		if testVAnyT(k) != v {
+			t.Fatal("wrong value", k, v)
+		}
+		n++
+	}
+	if n != mq.Size() {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+	if !mq.Clear() || mq.Size() != 0 || mq.Stats().Keys != 0 {
+		t.Fatal("not cleared", mq.Size())
+	}
+}
+func TestValAny_FromSlice(t *testing.T) {
+	keys, vals := make([]testVPT, testAddN), make([]testVAnyT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(i%(testAddN/4)), testVAnyT(i) //every key repeats 4 times; the last is kept.
+	}
+	mq := NewValAnyFromSlice(testMinBSz, testMaxBSz, testMaxHash, testHashF, keys, vals)
+	if mq.Size() != testAddN/4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	for k, v := range mq.Range {
+		if v != testVAnyT(k)+testAddN*3/4 {
+			t.Fatal("wrong value", k, v)
+		}
+	}
+	for i := range testVPT(testAddN) { //the buckets of the upper 3/4 are empty, but they must still have their relays.
+		if mq.Store(i, 0) != (i >= testAddN/4) {
+			t.Fatal("wrong store", i)
+		}
+	}
+	if fromSeq := NewValAnyFromSeq(testMinBSz, testMaxBSz, testMaxHash, testHashF, mq.Range); fromSeq.Size() != testAddN {
+		t.Fatal("wrong size from seq", fromSeq.Size())
+	}
+}
+
+func TestValAny_LoadAndDelete1(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	for i := range testVAnyT(testAddN) {
+		if a, b := mq.LoadAndDelete(testVPT(i)); a != i || !b {
+			t.Fatal("wrong delete", a, i)
+		}
+		if _, b := mq.LoadAndDelete(testVPT(i)); b {
+			t.Fatal("can't delete")
+		}
+		if mq.Size() != uint(testAddN-i)-1 {
+			t.Fail()
+		}
+	}
+}
+func TestValAny_LoadPtrAndDelete2(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testThrdsN * testAddNEach {
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				if a, b := mq.LoadAndDelete(testVPT(j)); a != testVAnyT(j) || !b {
+					t.Error("wrong delete", a, j)
+				}
+				if _, b := mq.LoadAndDelete(testVPT(j)); b {
+					t.Error("can't delete")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+func TestValAny_LoadPtrAndDelete3(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testThrdsN * testAddNEach {
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	count := make([]atomic.Uint32, testThrdsN*testAddNEach)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(testThrdsN * testAddNEach) {
+				if _, a := mq.LoadAndDelete(i); a {
+					count[i].Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range count {
+		if count[i].Load() != 1 {
+			t.Fail()
+		}
+	}
+	if mq.Size() != 0 {
+		t.Fail()
+	}
+}
+func TestValAny_Swap(t *testing.T) {
+	vp := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, 16, testHashF)
+	if _, b := vp.Swap(0, 0); b {
+		t.Fail()
+	}
+	v1, v2 := testVAnyT(0), testVAnyT(1)
+	vp.Store(0, v1)
+	if a, b := vp.Swap(0, v2); !b || a != v1 {
+		t.Fail()
+	}
+	if a, b := vp.Load(0); !b || a != v2 {
+		t.Fail()
+	}
+}
+func TestValAny_LoadOrStore_Delete(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.LoadOrStore(testVPT(j), testVAnyT(j))
+				if a, b := mq.LoadOrStore(testVPT(j), testVAnyT(j)); !b || a != testVAnyT(j) {
+					t.Error("can't store", j)
+				}
+				if a, b := mq.LoadAndDelete(testVPT(j)); a != testVAnyT(j) || !b {
+					t.Error("wrong delete", a, j)
+				}
+				if _, b := mq.LoadAndDelete(testVPT(j)); b {
+					t.Error("can't delete")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+func TestValAny_Compute(t *testing.T) {
+	const keys = 16
+	vp := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	if _, ok := vp.Compute(0, func(testVAnyT, bool) (testVAnyT, ComputeOp) { return 0, DELETE }); ok || vp.Size() != 0 {
+		t.Fatal("DELETE on absent key.")
+	}
+	if _, ok := vp.Compute(0, func(testVAnyT, bool) (testVAnyT, ComputeOp) { return 1, KEEP }); ok || vp.Size() != 0 {
+		t.Fatal("KEEP on absent key.")
+	}
+	incr := func(old testVAnyT, loaded bool) (testVAnyT, ComputeOp) {
+		if loaded {
+			return old + 1, STORE
+		}
+		return 1, STORE
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for j := range testAddNEach {
+				vp.Compute(testVPT(j%keys), incr)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVPT(keys) {
+		if v, ok := vp.Load(i); !ok || v != testThrdsN*testAddNEach/keys {
+			t.Fatal("lost update on", i)
+		}
+	}
+	evicted := atomic.Int32{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(keys) {
+				if _, ok := vp.Compute(i, func(old testVAnyT, loaded bool) (testVAnyT, ComputeOp) {
+					if loaded && old == testThrdsN*testAddNEach/keys {
+						return 0, DELETE
+					}
+					return old, KEEP
+				}); !ok {
+					evicted.Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if evicted.Load() != keys*testThrdsN || vp.Size() != 0 {
+		t.Fatal("conditional eviction failed.", evicted.Load(), vp.Size())
+	}
+}
+func TestValAny_Take(t *testing.T) {
+	vp := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, 16, testHashF)
+	if kp, _ := vp.Take(); kp != nil {
+		t.Fail()
+	}
+	a := testVAnyT(15)
+	vp.Store(15, a)
+	if kp, v := vp.Take(); v != a || *kp != 15 {
+		t.Fail()
+	}
+	b := testVAnyT(0)
+	vp.Store(0, b)
+	if kp, v := vp.Take(); v != b || *kp != 0 {
+		t.Fail()
+	}
+}
+func TestValAny_Range(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	count := 0
+	for k, v := range mq.Range {
+		if k != testVPT(count) {
+			t.Fail()
+		}
+		if v != testVAnyT(count) {
+			t.Fail()
+		}
+		count++
+	}
+}
+func TestValAny_All_Keys_Values(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	m := make(map[testVPT]testVAnyT, testAddN)
+	for i := range testAddN {
+		m[testVPT(i)] = testVAnyT(i)
+	}
+	mq.Insert(maps.All(m))
+	if !maps.Equal(m, maps.Collect(mq.All())) {
+		t.Fatal("All doesn't match inserted.")
+	}
+	keys, values := slices.Collect(mq.Keys()), slices.Collect(mq.Values())
+	if len(keys) != testAddN || len(values) != testAddN {
+		t.Fatal("size mismatch.", len(keys), len(values))
+	}
+	for i := range testAddN {
+		if keys[i] != testVPT(i) || values[i] != testVAnyT(i) {
+			t.Fatal("wrong order at", i)
+		}
+	}
+	for k := range mq.Keys() {
+		if k == 10 {
+			break
+		}
+	}
+}
+func TestValAny_RangeFrom(t *testing.T) {
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	from := testVPT(rand.Intn(testAddN))
+	next := from
+	mq.RangeFrom(uint(from), func(k testVPT, v testVAnyT) bool {
+		if k != next || v != testVAnyT(k) {
+			t.Fatal("expected", next, "got", k)
+		}
+		next++
+		return true
+	})
+	if next != testAddN {
+		t.Fatal("stopped at", next)
+	}
+}
+func TestValAny_Scan(t *testing.T) {
+	const pageSize = 7
+	collide := func(a testVPT) uint { return uint(a) >> 2 } //every 4 keys share a hash.
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testAddN>>2, collide)
+	for i := 0; i < testAddN; i += 2 { //even keys stay, odd keys are added and deleted during the scan.
+		mq.Store(testVPT(i), testVAnyT(i))
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for !stop.Load() {
+				for i := 1; i < testAddN; i += 2 {
+					mq.Store(testVPT(i), testVAnyT(i))
+				}
+				for i := 1; i < testAddN; i += 2 {
+					mq.LoadAndDelete(testVPT(i))
+				}
+			}
+			wg.Done()
+		}()
+	}
+	visited := make([]byte, testAddN)
+	var c Cursor
+	for lastHash := uint(0); !c.Done(); {
+		n := 0
+		mq.Scan(&c, func(k testVPT, v testVAnyT) bool {
+			if collide(k) < lastHash || v != testVAnyT(k) {
+				t.Fatal("hash isn't ordered.")
+			}
+			lastHash = collide(k)
+			visited[k]++
+			n++
+			return n < pageSize
+		})
+	}
+	stop.Store(true)
+	wg.Wait()
+	for i, v := range visited {
+		if i&1 == 0 && v != 1 { //odd keys sharing the hash of the last visited key can be repeated.
+			t.Fatal(i, "is visited", v, "times.")
+		}
+	}
+}
+func TestValAny_Copy(t *testing.T) {
+	vp0 := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for range rand.Intn(testAddN) {
+		vp0.Store(testVPT(rand.Uint32()%testMaxHash), testVAnyT(rand.Intn(testAddN)))
+	}
+	vp1 := vp0.Copy()
+	if vp0.Size() != vp1.Size() {
+		t.Fail()
+	}
+	for k, v := range vp0.Range {
+		if a, _ := vp1.Load(k); a != v {
+			t.Fail()
+		}
+	}
+	for k, v := range vp1.Range {
+		if a, _ := vp0.Load(k); a != v {
+			t.Fail()
+		}
+	}
+}
+func TestValAny_Snapshot(t *testing.T) { //each writer stores the same step to x then y, so any linearizable view has y<=x<=y+1. a copy that isn't linearizable can see the new y with the old x.
+	const writers, gap = 4, 1 << 8 //keys between x and y make the window larger.
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, gap+writers-1, testHashF)
+	mq.TrackWrites()
+	for i := range testVPT(gap + writers) {
+		mq.Store(i, 0)
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(writers)
+	for w := range testVPT(writers) {
+		go func() {
+			for step := testVAnyT(1); !stop.Load(); step++ {
+				mq.Store(w, step)
+				mq.Store(gap+w, step)
+				if step&7 == 0 {
+					time.Sleep(time.Microsecond)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	check := func(s ValAnySnapshot[testVPT, testVAnyT], ok bool) {
+		if !ok {
+			t.Fatal("Snapshot of a tracked map failed.")
+		}
+		if s.Size() != gap+writers {
+			t.Fatal("wrong size", s.Size())
+		}
+		for w := range testVPT(writers) {
+			x, _ := s.Load(w)
+			if y, _ := s.Load(gap + w); x != y && x != y+1 {
+				t.Fatal("inconsistent snapshot", x, y)
+			}
+		}
+		n := uint(0)
+		s.Range(func(testVPT, testVAnyT) bool {
+			n++
+			return true
+		})
+		if n != s.Size() {
+			t.Fatal("Range doesn't match Size.")
+		}
+	}
+	for range testAddNEach {
+		check(mq.Snapshot())
+	}
+	stop.Store(true)
+	wg.Wait()
+	s, ok := mq.Snapshot()
+	check(s, ok)
+	mq.LoadAndDelete(0)
+	if _, ok := s.Load(0); !ok || s.Size() != gap+writers {
+		t.Fatal("snapshot changed by later writes.")
+	}
+	if _, ok := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, 0, testHashF).Snapshot(); ok {
+		t.Fatal("Snapshot of a map whose writes aren't tracked succeeded.")
+	}
+}
+func TestValAny_Size_Tracked(t *testing.T) { //Size of a map near empty mustn't underflow when writes are tracked.
+	const keys = 1
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	mq.TrackWrites()
+	running := atomic.Int32{}
+	running.Store(testThrdsN)
+	for i := range testVAnyT(testThrdsN) {
+		go func() {
+			for j := range testAddN {
+				if k := testVPT(j % keys); j&1 == 0 {
+					mq.Store(k, i)
+				} else {
+					mq.LoadAndDelete(k)
+				}
+			}
+			running.Add(-1)
+		}()
+	}
+	for running.Load() != 0 {
+		if s := mq.Size(); s > keys+testThrdsN { //a size read while writing can be off by the number of writers.
+			t.Fatal("wrong size", s)
+		}
+	}
+	n := uint(0)
+	for range mq.Keys() {
+		n++
+	}
+	if mq.Size() != n {
+		t.Fatal("size is", mq.Size(), "instead of", n)
+	}
+}
+func TestValAny_StoreMany_LoadMany_DeleteMany(t *testing.T) {
+	collided := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, 0, func(testVPT) uint { return 0 })
+	for i := range testVPT(3) {
+		collided.Store(i, 1)
+	}
+	if added := collided.StoreMany([]testVPT{2, 0}, []testVAnyT{1, 1}); added[0] || added[1] || collided.Size() != 3 { //0 is before 2 in the list, so it mustn't be searched from 2.
+		t.Fatal("equal hashes are added again.", added)
+	}
+	mq := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	keys, vals := make([]testVPT, testAddN), make([]testVAnyT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(rand.Intn(testAddN>>1)), testVAnyT(i) //about half are duplicates.
+	}
+	added, want := mq.StoreMany(keys, vals), make(map[testVPT]testVAnyT)
+	for i, k := range keys {
+		if _, ok := want[k]; ok == added[i] {
+			t.Fatal("wrong added for", k)
+		}
+		want[k] = vals[i]
+	}
+	if mq.Size() != uint(len(want)) {
+		t.Fatal("wrong size", mq.Size(), len(want))
+	}
+	loadedVals, loaded := mq.LoadMany(append(keys, testAddN))
+	for i, v := range loadedVals[:len(keys)] {
+		if !loaded[i] || v != want[keys[i]] {
+			t.Fatal("wrong value for", keys[i])
+		}
+	}
+	if loaded[len(keys)] {
+		t.Fatal("loaded absent key.")
+	}
+	deleted, seen := mq.DeleteMany(keys), make(map[testVPT]bool)
+	for i, k := range keys {
+		if deleted[i] == seen[k] {
+			t.Fatal("wrong deleted for", k)
+		}
+		seen[k] = true
+	}
+	if mq.Size() != 0 {
+		t.Fatal("keys left", mq.Size())
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			keys, vals := make([]testVPT, testAddNEach), make([]testVAnyT, testAddNEach)
+			for j := range keys {
+				keys[j] = testVPT(i + j*testThrdsN)
+				vals[j] = testVAnyT(keys[j])
+			}
+			rand.Shuffle(len(keys), func(a, b int) {
+				keys[a], keys[b] = keys[b], keys[a]
+				vals[a], vals[b] = vals[b], vals[a]
+			})
+			for _, a := range mq.StoreMany(keys, vals) {
+				if !a {
+					t.Error("key isn't added.")
+				}
+			}
+			loadedVals, loaded := mq.LoadMany(keys)
+			for j, v := range loadedVals {
+				if !loaded[j] || v != vals[j] {
+					t.Error("wrong value.")
+				}
+			}
+			for _, d := range mq.DeleteMany(keys[:testAddNEach/2]) {
+				if !d {
+					t.Error("key isn't deleted.")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testThrdsN*testAddNEach/2 {
+		t.Fatal("wrong size", mq.Size())
+	}
+}
+func TestValAny_LoadPtr(t *testing.T) {
+	vu := NewValAny[testVPT, testVAnyT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vu.LoadPtr(0) != nil {
+		t.Fail()
+	}
+	vu.Store(0, 0)
+	*vu.LoadPtr(0)++
+	if *vu.LoadPtr(0) != 1 {
+		t.Fail()
+	}
+}
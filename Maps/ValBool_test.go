@@ -0,0 +1,38 @@
+package Maps
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestValBool(t *testing.T) {
+	keys, vals := make([]testVPT, testAddN), make([]bool, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(i), i%3 == 0
+	}
+	mq := NewValBoolFromSlice(testMinBSz, testMaxBSz, testMaxHash, testHashF, keys, vals)
+	for k, v := range mq.Range {
+		if v != (k%3 == 0) {
+			t.Fatal("wrong value", k, v)
+		}
+	}
+	if old, ok := mq.Swap(1, true); old || !ok || mq.CompareAndSwap(1, true, false) != SUCCESS || mq.CompareAndDelete(3, false) != FAILED || mq.CompareAndDelete(3, true) != SUCCESS {
+		t.Fatal("wrong swap")
+	}
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewValBool[testVPT, bool](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if err := decoded.Decode(&buf, IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size() != testAddN-1 {
+		t.Fatal("wrong size", decoded.Size())
+	}
+	for k, v := range decoded.Range {
+		if v != (k%3 == 0 && k != 3) {
+			t.Fatal("wrong decoded value", k, v)
+		}
+	}
+}
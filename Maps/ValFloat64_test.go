@@ -0,0 +1,53 @@
+package Maps
+
+import (
+	"bytes"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestValFloat64_Add(t *testing.T) {
+	mq := NewValFloat64[testVPT, float64](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for k := range testVPT(testAddNEach) {
+				mq.Add(k, 0.5) //halves are exact, so the sum doesn't depend on the order.
+			}
+		}()
+	}
+	wg.Wait()
+	for k, v := range mq.Range {
+		if v != testThrdsN*0.5 {
+			t.Fatal("wrong sum", k, v)
+		}
+	}
+	if v, loaded := mq.Add(testAddNEach, -1.5); v != -1.5 || loaded {
+		t.Fatal("wrong add to a new key", v, loaded)
+	}
+}
+
+func TestValFloat64_Bits(t *testing.T) { //values are compared by bits.
+	mq := NewValFloat64[testVPT, float64](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Store(0, math.NaN())
+	if v, ok := mq.Load(0); !ok || !math.IsNaN(v) || mq.CompareAndSwap(0, math.NaN(), 1) != SUCCESS {
+		t.Fatal("NaN isn't kept by its bits", v)
+	}
+	mq.Store(1, math.Copysign(0, -1))
+	if mq.CompareAndSwap(1, 0, 1) != FAILED || mq.CompareAndDelete(1, math.Copysign(0, -1)) != SUCCESS {
+		t.Fatal("-0 equals +0")
+	}
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewValFloat64[testVPT, float64](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if err := decoded.Decode(&buf, IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	} else if v, ok := decoded.Load(0); !ok || v != 1 || decoded.Size() != 1 {
+		t.Fatal("wrong decode", v, ok)
+	}
+}
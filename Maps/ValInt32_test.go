@@ -3,10 +3,14 @@
 package Maps
 
 import (
+	"maps"
 	"math/rand"
+	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type testVInt32T int32
@@ -152,6 +156,96 @@ func TestValInt32_Load_Store_Delete(t *testing.T) {
 		t.Fail()
 	}
 }
+func TestValInt32_Clear(t *testing.T) {
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if mq.Store(1, 1); mq.Clear() || mq.Size() != 1 {
+		t.Fatal("cleared without tracking writes")
+	}
+	mq.TrackWrites()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.Store(testVPT(j), testVInt32T(j))
+				if a, b := mq.Load(testVPT(j)); b && a != testVInt32T(j) {
+					t.Error("wrong value", j, a)
+				}
+				if j%(testAddNEach/4) == 0 {
+					mq.Clear()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	n := uint(0)
+	for k, v := range mq.Range {
+		if testVInt32T(k) != v {
+			t.Fatal("wrong value", k, v)
+		}
+		n++
+	}
+	if n != mq.Size() {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+	if !mq.Clear() || mq.Size() != 0 || mq.Stats().Keys != 0 {
+		t.Fatal("not cleared", mq.Size())
+	}
+}
+func TestValInt32_FromSlice(t *testing.T) {
+	keys, vals := make([]testVPT, testAddN), make([]testVInt32T, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(i%(testAddN/4)), testVInt32T(i) //every key repeats 4 times; the last is kept.
+	}
+	mq := NewValInt32FromSlice(testMinBSz, testMaxBSz, testMaxHash, testHashF, keys, vals)
+	if mq.Size() != testAddN/4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	for k, v := range mq.Range {
+		if v != testVInt32T(k)+testAddN*3/4 {
+			t.Fatal("wrong value", k, v)
+		}
+	}
+	for i := range testVPT(testAddN) { //the buckets of the upper 3/4 are empty, but they must still have their relays.
+		if mq.Store(i, 0) != (i >= testAddN/4) {
+			t.Fatal("wrong store", i)
+		}
+	}
+	if fromSeq := NewValInt32FromSeq(testMinBSz, testMaxBSz, testMaxHash, testHashF, mq.Range); fromSeq.Size() != testAddN {
+		t.Fatal("wrong size from seq", fromSeq.Size())
+	}
+}
+
+func TestValInt32_Add(t *testing.T) {
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	var inserted atomic.Int64
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for k := range testVPT(testAddNEach) {
+				if _, loaded := mq.Add(k, 1); !loaded {
+					inserted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted.Load() != testAddNEach || mq.Size() != testAddNEach {
+		t.Fatal("wrong number of keys added", inserted.Load(), mq.Size())
+	}
+	for k, v := range mq.Range {
+		if v != testThrdsN {
+			t.Fatal("wrong count", k, v)
+		}
+	}
+	if v, loaded := mq.Add(0, 2); v != testThrdsN+2 || !loaded {
+		t.Fatal("wrong add", v, loaded)
+	}
+}
+
 func TestValInt32_LoadAndDelete1(t *testing.T) {
 	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
 	for i := range testAddN {
@@ -256,6 +350,7 @@ func TestValInt32_LoadOrStore_Delete(t *testing.T) {
 	}
 	wg.Wait()
 }
+
 func TestValInt32_CompareAndSwap(t *testing.T) {
 	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 16, testHashF)
 	if vp.CompareAndSwap(0, 0, 0) != NULL {
@@ -311,6 +406,147 @@ func TestValInt32_CompareAndSwap(t *testing.T) {
 		}
 	}
 }
+func TestValInt32_CompareAndDelete(t *testing.T) {
+	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.CompareAndDelete(0, 0) != NULL {
+		t.Fail()
+	}
+	vp.Store(0, 0)
+	if vp.CompareAndDelete(0, 1) != FAILED {
+		t.Fail()
+	}
+	results := make([]CASResult, 2)
+	for range rand.Intn(testAddN) {
+		vp.Store(0, 0)
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			results[0] = vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			results[1] = vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			vp.LoadOrStore(0, 1)
+			wg.Done()
+		}()
+		wg.Wait()
+		if (results[0] == SUCCESS) == (results[1] == SUCCESS) {
+			t.Fatal("exactly 1 of 0 and 1 should SUCCESS", results)
+		}
+	}
+}
+func TestValInt32_CompareAndDelete_Lease(t *testing.T) { //each key is a lease; only the holder of the token may release it.
+	const keys = 16
+	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, keys-1, testHashF)
+	holders := make([]atomic.Int32, keys)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testVInt32T(testThrdsN) {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j*int(i+1)) % keys
+				if _, loaded := vp.LoadOrStore(k, i); loaded {
+					if vp.CompareAndDelete(k, i) == SUCCESS {
+						t.Error("released a lease held by another.")
+					}
+					continue
+				}
+				if holders[k].Add(1) != 1 {
+					t.Error("lease held by more than 1.")
+				}
+				holders[k].Add(-1)
+				if a := vp.CompareAndDelete(k, i); a != SUCCESS {
+					t.Error("failed to release own lease:", a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if vp.Size() != 0 {
+		t.Fatal("leases left:", vp.Size())
+	}
+	vp.Range(func(testVPT, testVInt32T) bool {
+		t.Fatal("range found released lease.")
+		return false
+	})
+}
+func TestValInt32_CompareAndDelete_Store(t *testing.T) { //a Store racing CompareAndDelete is never deleted with the old value.
+	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 16, testHashF)
+	for range testAddN {
+		vp.Store(0, 0)
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			vp.Store(0, 1)
+			wg.Done()
+		}()
+		wg.Wait()
+		if v, ok := vp.Load(0); !ok || v != 1 {
+			t.Fatal("lost the store", v, ok)
+		}
+	}
+}
+func TestValInt32_Compute(t *testing.T) {
+	const keys = 16
+	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, keys-1, testHashF)
+	if _, ok := vp.Compute(0, func(testVInt32T, bool) (testVInt32T, ComputeOp) { return 0, DELETE }); ok || vp.Size() != 0 {
+		t.Fatal("DELETE on absent key.")
+	}
+	if _, ok := vp.Compute(0, func(testVInt32T, bool) (testVInt32T, ComputeOp) { return 1, KEEP }); ok || vp.Size() != 0 {
+		t.Fatal("KEEP on absent key.")
+	}
+	incr := func(old testVInt32T, loaded bool) (testVInt32T, ComputeOp) {
+		if loaded {
+			return old + 1, STORE
+		}
+		return 1, STORE
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for j := range testAddNEach {
+				vp.Compute(testVPT(j%keys), incr)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVPT(keys) {
+		if v, ok := vp.Load(i); !ok || v != testThrdsN*testAddNEach/keys {
+			t.Fatal("lost update on", i)
+		}
+	}
+	evicted := atomic.Int32{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(keys) {
+				if _, ok := vp.Compute(i, func(old testVInt32T, loaded bool) (testVInt32T, ComputeOp) {
+					if loaded && old == testThrdsN*testAddNEach/keys {
+						return 0, DELETE
+					}
+					return old, KEEP
+				}); !ok {
+					evicted.Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if evicted.Load() != keys*testThrdsN || vp.Size() != 0 {
+		t.Fatal("conditional eviction failed.", evicted.Load(), vp.Size())
+	}
+}
 func TestValInt32_Take(t *testing.T) {
 	vp := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 16, testHashF)
 	if kp, _ := vp.Take(); kp != nil {
@@ -343,6 +579,94 @@ func TestValInt32_Range(t *testing.T) {
 		count++
 	}
 }
+func TestValInt32_All_Keys_Values(t *testing.T) {
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	m := make(map[testVPT]testVInt32T, testAddN)
+	for i := range testAddN {
+		m[testVPT(i)] = testVInt32T(i)
+	}
+	mq.Insert(maps.All(m))
+	if !maps.Equal(m, maps.Collect(mq.All())) {
+		t.Fatal("All doesn't match inserted.")
+	}
+	keys, values := slices.Collect(mq.Keys()), slices.Collect(mq.Values())
+	if len(keys) != testAddN || len(values) != testAddN {
+		t.Fatal("size mismatch.", len(keys), len(values))
+	}
+	for i := range testAddN {
+		if keys[i] != testVPT(i) || values[i] != testVInt32T(i) {
+			t.Fatal("wrong order at", i)
+		}
+	}
+	for k := range mq.Keys() {
+		if k == 10 {
+			break
+		}
+	}
+}
+func TestValInt32_RangeFrom(t *testing.T) {
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVInt32T(i))
+	}
+	from := testVPT(rand.Intn(testAddN))
+	next := from
+	mq.RangeFrom(uint(from), func(k testVPT, v testVInt32T) bool {
+		if k != next || v != testVInt32T(k) {
+			t.Fatal("expected", next, "got", k)
+		}
+		next++
+		return true
+	})
+	if next != testAddN {
+		t.Fatal("stopped at", next)
+	}
+}
+func TestValInt32_Scan(t *testing.T) {
+	const pageSize = 7
+	collide := func(a testVPT) uint { return uint(a) >> 2 } //every 4 keys share a hash.
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testAddN>>2, collide)
+	for i := 0; i < testAddN; i += 2 { //even keys stay, odd keys are added and deleted during the scan.
+		mq.Store(testVPT(i), testVInt32T(i))
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for !stop.Load() {
+				for i := 1; i < testAddN; i += 2 {
+					mq.Store(testVPT(i), testVInt32T(i))
+				}
+				for i := 1; i < testAddN; i += 2 {
+					mq.LoadAndDelete(testVPT(i))
+				}
+			}
+			wg.Done()
+		}()
+	}
+	visited := make([]byte, testAddN)
+	var c Cursor
+	for lastHash := uint(0); !c.Done(); {
+		n := 0
+		mq.Scan(&c, func(k testVPT, v testVInt32T) bool {
+			if collide(k) < lastHash || v != testVInt32T(k) {
+				t.Fatal("hash isn't ordered.")
+			}
+			lastHash = collide(k)
+			visited[k]++
+			n++
+			return n < pageSize
+		})
+	}
+	stop.Store(true)
+	wg.Wait()
+	for i, v := range visited {
+		if i&1 == 0 && v != 1 { //odd keys sharing the hash of the last visited key can be repeated.
+			t.Fatal(i, "is visited", v, "times.")
+		}
+	}
+}
 func TestValInt32_Copy(t *testing.T) {
 	vp0 := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
 	for range rand.Intn(testAddN) {
@@ -363,6 +687,175 @@ func TestValInt32_Copy(t *testing.T) {
 		}
 	}
 }
+func TestValInt32_Snapshot(t *testing.T) { //each writer stores the same step to x then y, so any linearizable view has y<=x<=y+1. a copy that isn't linearizable can see the new y with the old x.
+	const writers, gap = 4, 1 << 8 //keys between x and y make the window larger.
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, gap+writers-1, testHashF)
+	mq.TrackWrites()
+	for i := range testVPT(gap + writers) {
+		mq.Store(i, 0)
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(writers)
+	for w := range testVPT(writers) {
+		go func() {
+			for step := testVInt32T(1); !stop.Load(); step++ {
+				mq.Store(w, step)
+				mq.Store(gap+w, step)
+				if step&7 == 0 {
+					time.Sleep(time.Microsecond)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	check := func(s ValInt32Snapshot[testVPT, testVInt32T], ok bool) {
+		if !ok {
+			t.Fatal("Snapshot of a tracked map failed.")
+		}
+		if s.Size() != gap+writers {
+			t.Fatal("wrong size", s.Size())
+		}
+		for w := range testVPT(writers) {
+			x, _ := s.Load(w)
+			if y, _ := s.Load(gap + w); x != y && x != y+1 {
+				t.Fatal("inconsistent snapshot", x, y)
+			}
+		}
+		n := uint(0)
+		s.Range(func(testVPT, testVInt32T) bool {
+			n++
+			return true
+		})
+		if n != s.Size() {
+			t.Fatal("Range doesn't match Size.")
+		}
+	}
+	for range testAddNEach {
+		check(mq.Snapshot())
+	}
+	stop.Store(true)
+	wg.Wait()
+	s, ok := mq.Snapshot()
+	check(s, ok)
+	mq.LoadAndDelete(0)
+	if _, ok := s.Load(0); !ok || s.Size() != gap+writers {
+		t.Fatal("snapshot changed by later writes.")
+	}
+	if _, ok := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 0, testHashF).Snapshot(); ok {
+		t.Fatal("Snapshot of a map whose writes aren't tracked succeeded.")
+	}
+}
+func TestValInt32_Size_Tracked(t *testing.T) { //Size of a map near empty mustn't underflow when writes are tracked.
+	const keys = 1
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, keys-1, testHashF)
+	mq.TrackWrites()
+	running := atomic.Int32{}
+	running.Store(testThrdsN)
+	for i := range testVInt32T(testThrdsN) {
+		go func() {
+			for j := range testAddN {
+				if k := testVPT(j % keys); j&1 == 0 {
+					mq.Store(k, i)
+				} else {
+					mq.LoadAndDelete(k)
+				}
+			}
+			running.Add(-1)
+		}()
+	}
+	for running.Load() != 0 {
+		if s := mq.Size(); s > keys+testThrdsN { //a size read while writing can be off by the number of writers.
+			t.Fatal("wrong size", s)
+		}
+	}
+	n := uint(0)
+	for range mq.Keys() {
+		n++
+	}
+	if mq.Size() != n {
+		t.Fatal("size is", mq.Size(), "instead of", n)
+	}
+}
+func TestValInt32_StoreMany_LoadMany_DeleteMany(t *testing.T) {
+	collided := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 0, func(testVPT) uint { return 0 })
+	for i := range testVPT(3) {
+		collided.Store(i, 1)
+	}
+	if added := collided.StoreMany([]testVPT{2, 0}, []testVInt32T{1, 1}); added[0] || added[1] || collided.Size() != 3 { //0 is before 2 in the list, so it mustn't be searched from 2.
+		t.Fatal("equal hashes are added again.", added)
+	}
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	keys, vals := make([]testVPT, testAddN), make([]testVInt32T, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(rand.Intn(testAddN>>1)), testVInt32T(i) //about half are duplicates.
+	}
+	added, want := mq.StoreMany(keys, vals), make(map[testVPT]testVInt32T)
+	for i, k := range keys {
+		if _, ok := want[k]; ok == added[i] {
+			t.Fatal("wrong added for", k)
+		}
+		want[k] = vals[i]
+	}
+	if mq.Size() != uint(len(want)) {
+		t.Fatal("wrong size", mq.Size(), len(want))
+	}
+	loadedVals, loaded := mq.LoadMany(append(keys, testAddN))
+	for i, v := range loadedVals[:len(keys)] {
+		if !loaded[i] || v != want[keys[i]] {
+			t.Fatal("wrong value for", keys[i])
+		}
+	}
+	if loaded[len(keys)] {
+		t.Fatal("loaded absent key.")
+	}
+	deleted, seen := mq.DeleteMany(keys), make(map[testVPT]bool)
+	for i, k := range keys {
+		if deleted[i] == seen[k] {
+			t.Fatal("wrong deleted for", k)
+		}
+		seen[k] = true
+	}
+	if mq.Size() != 0 {
+		t.Fatal("keys left", mq.Size())
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			keys, vals := make([]testVPT, testAddNEach), make([]testVInt32T, testAddNEach)
+			for j := range keys {
+				keys[j] = testVPT(i + j*testThrdsN)
+				vals[j] = testVInt32T(keys[j])
+			}
+			rand.Shuffle(len(keys), func(a, b int) {
+				keys[a], keys[b] = keys[b], keys[a]
+				vals[a], vals[b] = vals[b], vals[a]
+			})
+			for _, a := range mq.StoreMany(keys, vals) {
+				if !a {
+					t.Error("key isn't added.")
+				}
+			}
+			loadedVals, loaded := mq.LoadMany(keys)
+			for j, v := range loadedVals {
+				if !loaded[j] || v != vals[j] {
+					t.Error("wrong value.")
+				}
+			}
+			for _, d := range mq.DeleteMany(keys[:testAddNEach/2]) {
+				if !d {
+					t.Error("key isn't deleted.")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testThrdsN*testAddNEach/2 {
+		t.Fatal("wrong size", mq.Size())
+	}
+}
 func TestValInt32_LoadPtr(t *testing.T) {
 	vu := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, 16, testHashF)
 	if vu.LoadPtr(0) != nil {
@@ -374,3 +867,146 @@ func TestValInt32_LoadPtr(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestValInt32_PoolNodes(t *testing.T) {
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.PoolNodes()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	var done atomic.Bool
+	ranged := make(chan struct{})
+	go func() { //a reused node must never be seen with the key of its last use and the value of the next.
+		for !done.Load() {
+			for k, v := range mq.Range {
+				if testVPT(v) != k {
+					t.Error("wrong value", k, v)
+				}
+			}
+		}
+		close(ranged)
+	}()
+	for i := range testVInt32T(testThrdsN) {
+		go func() {
+			defer wg.Done()
+			for range 4 {
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					if !mq.Store(testVPT(j), j) {
+						t.Error("not added", j)
+						return
+					}
+					if v, ok := mq.LoadAndDelete(testVPT(j)); !ok || v != j {
+						t.Error("wrong value", j, v)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	<-ranged
+	if s := mq.Stats(); s.Reused == 0 || s.Keys != 0 || mq.Size() != 0 {
+		t.Fatal("nodes aren't reused", s.Reused, s.Keys, mq.Size())
+	}
+}
+
+func TestValInt32_OnChange(t *testing.T) {
+	type change = Change[testVPT, testVInt32T]
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites() //Clear requires it.
+	var got, watched []change
+	mq.OnChange(func(c change) { got = append(got, c) })
+	cancel := mq.Watch(1, func(c change) { watched = append(watched, c) })
+	mq.Store(1, 1)
+	mq.Store(2, 2)
+	mq.Swap(1, 3)
+	mq.CompareAndSwap(1, 1, 4) //fails, so it isn't a change.
+	mq.LoadOrStore(1, 4)
+	mq.LoadAndDelete(1)
+	cancel()
+	mq.Store(1, 5)
+	mq.Clear()
+	want := []change{
+		{Key: 1, New: 1, Stored: true},
+		{Key: 2, New: 2, Stored: true},
+		{Key: 1, Old: 1, New: 3, Loaded: true, Stored: true},
+		{Key: 1, Old: 3, Loaded: true},
+		{Key: 1, New: 5, Stored: true},
+		{Key: 1, Old: 5, Loaded: true},
+		{Key: 2, Old: 2, Loaded: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("wrong changes", got)
+	}
+	if want = slices.DeleteFunc(want[:4], func(c change) bool { return c.Key != 1 }); !slices.Equal(watched, want) {
+		t.Fatal("wrong watched changes", watched)
+	}
+}
+func TestValInt32_OnChange_Compute(t *testing.T) { //f of Compute is called without the lock of the stripe, so it may write to the same stripe.
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Store(trackerStripes, 0) //f only overwrites it, so f isn't called again for a node linked next to key.
+	var got []testVPT
+	mq.OnChange(func(c Change[testVPT, testVInt32T]) { got = append(got, c.Key) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, loaded := range []bool{false, true} {
+			mq.Compute(0, func(old testVInt32T, ok bool) (testVInt32T, ComputeOp) {
+				if ok != loaded {
+					t.Error("wrong loaded", ok)
+				}
+				mq.Store(trackerStripes, old+1)
+				return old + 1, STORE
+			})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("Compute blocks f from writing to its stripe")
+	}
+	if v, _ := mq.Load(0); v != 2 || !slices.Equal(got, []testVPT{trackerStripes, 0, trackerStripes, 0}) {
+		t.Fatal("wrong changes", v, got)
+	}
+}
+func TestValInt32_Watch_Order(t *testing.T) { //every change of a key must start from where the previous one ended.
+	const keys = 4
+	mq := NewValInt32[testVPT, testVInt32T](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.OnChange(nil)
+	changes := make([][]Change[testVPT, testVInt32T], keys)
+	for k := range testVPT(keys) {
+		mq.Watch(k, func(c Change[testVPT, testVInt32T]) {
+			runtime.Gosched() //let other writers race with the delivery.
+			changes[k] = append(changes[k], c)
+		})
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j % keys)
+				switch (i + j) % 3 {
+				case 0:
+					mq.Add(k, 1)
+				case 1:
+					mq.Swap(k, testVInt32T(j))
+				default:
+					mq.LoadAndDelete(k)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for k, cs := range changes {
+		for i := 1; i < len(cs); i++ {
+			if cs[i].Loaded != cs[i-1].Stored || cs[i].Old != cs[i-1].New {
+				t.Fatal("changes out of order", k, i, cs[i-1], cs[i])
+			}
+		}
+		if v, ok := mq.Load(testVPT(k)); cs[len(cs)-1].Stored != ok || cs[len(cs)-1].New != v {
+			t.Fatal("last change isn't the value", k, cs[len(cs)-1])
+		}
+	}
+}
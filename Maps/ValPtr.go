@@ -1,36 +1,183 @@
 package Maps
 
 import (
+	"bytes"
+	"io"
+	"iter"
+	"math"
 	"math/bits"
 	"sync/atomic"
 	"unsafe"
 )
 
 // ValPtr is a map that stores keys by value and values by pointer. Pointers to values can be nil, but isn't suggested.
-type ValPtr[K comparable, V any] struct {
+type ValPtr[K any, V any] struct {
 	base[K]
+	obs *observers[K, *V] //nil unless OnChange is called.
 }
 
 // NewValPtr is the constructor for ValPtr. maxHash is max{for all a in K | hashF(a)}. Using a tightly bounded maxHash makes the distribution of keys more even and thus speeds up the map. Using a general hash function would require setting maxHash to the appropriate upper bound, likely things like math.MaxUint.
 func NewValPtr[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *ValPtr[K, V] {
+	return NewValPtrEq[K, V](minBucketSize, maxBucketSize, maxHash, hashF, equal[K])
+}
+
+// NewValPtrFor is NewValPtr with the hashF and maxHash picked by HashFor.
+func NewValPtrFor[K comparable, V any](minBucketSize, maxBucketSize byte) *ValPtr[K, V] {
+	hashF, maxHash := HashFor[K]()
+	return NewValPtr[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+}
+
+// NewValPtrEq is NewValPtr for keys that aren't comparable, such as slices, or whose equality isn't ==. eq reports whether 2 keys are equal, and equal keys must have the same hash. eq is only called on keys of the same hash. Keys mustn't be modified once stored.
+func NewValPtrEq[K any, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool) *ValPtr[K, V] {
 	vp := ValPtr[K, V]{
-		base[K]{MinAvgBucketSize: minBucketSize,
+		base: base[K]{MinAvgBucketSize: minBucketSize,
 			MaxAvgBucketSize: maxBucketSize,
 			maxLogChunkSize:  byte(bits.Len(maxHash)),
-			HashF:            hashF},
+			HashF:            hashF,
+			eq:               eq},
 	}
 	vp.buckets = newChunkArr(vp.maxLogChunkSize, vp.maxLogChunkSize)
 	vp.buckets.first = uintptr(unsafe.Pointer(&vp.firstRelay))
 	return &vp
 }
 
+// NewValPtrBytes is NewValPtr for []byte keys, which are compared by bytes.Equal. hashF is usually Hasher.HashBytes from the root package, so maxHash is math.MaxUint; it's taken rather than built in, since the root package links to the hash functions of the runtime and can't be imported without -checklinkname=0. Seeded(Go_Utils.Hasher.HashBytes) is such a hashF with a seed of its own.
+func NewValPtrBytes[V any](minBucketSize, maxBucketSize byte, hashF func([]byte) uint) *ValPtr[[]byte, V] {
+	return NewValPtrEq[[]byte, V](minBucketSize, maxBucketSize, math.MaxUint, hashF, bytes.Equal)
+}
+
+// NewValPtrFromSlice is NewValPtr filled with vals[i] for keys[i] for all i. The pairs are sorted by hash and linked in order, which is much faster than storing them one by one. When keys repeat, the last value is kept like StorePtr in order.
+func NewValPtrFromSlice[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, keys []K, vals []*V) *ValPtr[K, V] {
+	vp := NewValPtr[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+	vp.build(vp.sortUnique(keys), func(hash uint, i int) *relay {
+		return &(&ptrNode[K]{relay{hash: hash}, unsafe.Pointer(vals[i]), keys[i]}).relay
+	})
+	return vp
+}
+
+// NewValPtrFromSeq is NewValPtrFromSlice of the pairs in seq. It's the counterpart of maps.Collect.
+func NewValPtrFromSeq[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, seq iter.Seq2[K, *V]) *ValPtr[K, V] {
+	var keys []K
+	var vals []*V
+	for k, v := range seq {
+		keys, vals = append(keys, k), append(vals, v)
+	}
+	return NewValPtrFromSlice(minBucketSize, maxBucketSize, maxHash, hashF, keys, vals)
+}
+
+// PoolNodes makes the map reuse the nodes of deleted keys for the keys added later, which saves most of the allocations when keys are added and deleted all the time. A node is reused once all operations that started before it was removed from the list finish, so a long operation, such as a Range with a slow yield, only delays the reuse. Deleting a key crawls its bucket once more to remove the node and takes a lock shared by a stripe of hashes to retire it, so deletes aren't wait-free anymore, and adding and deleting keys is slower unless the GC is the bottleneck. It must be called before the map is used concurrently, and maps made by Copy don't pool their nodes.
+func (vp *ValPtr[K, V]) PoolNodes() {
+	vp.poolNodes(func(n unsafe.Pointer) {
+		*(*ptrNode[K])(n) = ptrNode[K]{}
+	})
+}
+
+// OnChange makes the map observable and calls f after every successful write to a key, which may be nil when only Watch is used. Writes to the map then hold a lock of the stripe of hashes of their key while they change it and queue the change, so the changes of a key are delivered in the order they're made. The changes of a stripe are delivered after the lock is released by one writer at a time, which also delivers the changes queued meanwhile, so a write may return before its change is delivered. f and the functions given to Watch may therefore write to the map, and their changes are delivered after they return. The functions given to Compute, CompareAndSwap and CompareAndDelete are called with the lock released and their result is applied by CAS after it's taken again, so they may write to the map as well, even to keys of the same stripe. It must be called before the map is used concurrently, and maps made by Copy aren't observed.
+func (vp *ValPtr[K, V]) OnChange(f func(Change[K, *V])) {
+	vp.obs = &observers[K, *V]{onChange: f, eq: vp.eq}
+	vp.locks = vp.obs.locks()
+}
+
+// Watch calls f after every successful write to key, until the returned cancel is called. Each change of key is delivered to every watch registered before the change is made, in the order of the changes, and cancel may be called by f itself. The map must be observable by OnChange.
+func (vp *ValPtr[K, V]) Watch(key K, f func(Change[K, *V])) (cancel func()) {
+	if vp.obs == nil {
+		panic("Maps: Watch requires OnChange")
+	}
+	return vp.obs.watch(vp.HashF(key), key, f)
+}
+
+// changed queues the change of key from old to new for the observers, either of which is tomb when key is absent.
+func (vp *ValPtr[K, V]) changed(hash uint, key K, old, new unsafe.Pointer) {
+	if vp.obs != nil {
+		c := Change[K, *V]{Key: key, Loaded: old != tomb, Stored: new != tomb}
+		if c.Loaded {
+			c.Old = (*V)(old)
+		}
+		if c.Stored {
+			c.New = (*V)(new)
+		}
+		vp.obs.queue(hash, c)
+	}
+}
+
+// node returns a node for key, which is a free one when there is.
+func (vp *ValPtr[K, V]) node(hash uint, val unsafe.Pointer, key K) *ptrNode[K] {
+	if val = vp.first(val); vp.nodes != nil {
+		if n := (*ptrNode[K])(vp.nodes.get()); n != nil {
+			n.hash, n.val, n.key = hash, val, key
+			return n
+		}
+	}
+	return &ptrNode[K]{relay{hash: hash}, val, key}
+}
+
+// TrackWrites makes the map count its writes, which makes Size exact and Clear possible, and keep its values as versions, which Snapshot relies on: a write makes a new version instead of replacing the value in place, so it allocates, and the versions a snapshot in progress may need are kept until it ends.
+func (vp *ValPtr[K, V]) TrackWrites() {
+	vp.trackVersions(func(n *relay) {
+		a := (*ptrNode[K])(unsafe.Pointer(n))
+		v := &version[unsafe.Pointer]{val: a.val, gone: a.val == tomb}
+		v.stamp.Store(1) //the first moment of the clock, which no snapshot precedes.
+		a.val = unsafe.Pointer(v)
+	}, func(n *relay, moment uint64) bool {
+		return at[unsafe.Pointer](vp.writes, &(*ptrNode[K])(unsafe.Pointer(n)).val, moment) != nil
+	})
+}
+
+// first returns what a new node keeps val as, which is its first version when writes are tracked. The version is stamped by linked once the node is linked.
+func (vp *ValPtr[K, V]) first(val unsafe.Pointer) unsafe.Pointer {
+	if vp.writes != nil {
+		return unsafe.Pointer(&version[unsafe.Pointer]{val: val})
+	}
+	return val
+}
+
+// value returns the value of n, which is tomb when n is deleted. When writes are tracked, n.val is the newest version of the value instead.
+func (vp *ValPtr[K, V]) value(n *ptrNode[K]) unsafe.Pointer {
+	if vp.writes == nil {
+		return atomic.LoadPointer(&n.val)
+	} else if h := head[unsafe.Pointer](vp.writes, &n.val); !h.gone {
+		return h.val
+	}
+	return tomb
+}
+
+// swap replaces the value of n with new, which is tomb to delete n, unless n is deleted. It returns the replaced value, or tomb when nothing is replaced.
+func (vp *ValPtr[K, V]) swap(n *ptrNode[K], new unsafe.Pointer) unsafe.Pointer {
+	if vp.writes != nil {
+		if old, swapped := swapLive(vp.writes, &n.val, new, new == tomb); swapped {
+			return old
+		}
+		return tomb
+	} else if new == tomb {
+		return atomic.SwapPointer(&n.val, tomb)
+	}
+	return casLive(&n.val, new)
+}
+
+// cas replaces the value of n with new, which is tomb to delete n, only when it's old, which isn't tomb.
+func (vp *ValPtr[K, V]) cas(n *ptrNode[K], old, new unsafe.Pointer) bool {
+	if vp.writes == nil {
+		return atomic.CompareAndSwapPointer(&n.val, old, new)
+	}
+	for {
+		if h := head[unsafe.Pointer](vp.writes, &n.val); h.gone || h.val != old {
+			return false
+		} else if replace(vp.writes, &n.val, h, new, new == tomb) {
+			return true
+		}
+	}
+}
+
 // Has reports whether a key is present, regardless of the value.
 func (vp *ValPtr[K, V]) Has(key K) bool {
 	hash := vp.HashF(key)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return false
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) && vp.value((*ptrNode[K])(curAddr)) != tomb {
 			return true
 		}
 	}
@@ -39,16 +186,20 @@ func (vp *ValPtr[K, V]) Has(key K) bool {
 // Delete a key from the map, reporting whether it's successful. Delete is successful when the key was present.
 func (vp *ValPtr[K, V]) Delete(key K) bool {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return false
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			if (*relay)(curAddr).mark() {
-				vp.size.Add(^uintptr(resizingMask<<1 - 1))
-				vp.tryMerge()
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if old := vp.swap((*ptrNode[K])(curAddr), tomb); old != tomb {
+				vp.unlink((*relay)(curAddr))
+				vp.changed(hash, key, old, tomb)
 				return true
 			}
-			return false
 		}
 	}
 }
@@ -56,16 +207,20 @@ func (vp *ValPtr[K, V]) Delete(key K) bool {
 // LoadPtrAndDelete returns the pointer to the value of the deleted key. Returns nil when key isn't found. You can recycle the deleted pointers via a sync.Pool.
 func (vp *ValPtr[K, V]) LoadPtrAndDelete(key K) *V {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return nil
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			if (*relay)(curAddr).mark() {
-				vp.size.Add(^uintptr(resizingMask<<1 - 1))
-				vp.tryMerge()
-				return (*V)(atomic.LoadPointer(&(*ptrNode[K])(curAddr).val)) //val==nil is the same as node not exist to the caller.
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if old := vp.swap((*ptrNode[K])(curAddr), tomb); old != tomb {
+				vp.unlink((*relay)(curAddr))
+				vp.changed(hash, key, old, tomb)
+				return (*V)(old) //val==nil is the same as node not exist to the caller.
 			}
-			return nil
 		}
 	}
 }
@@ -73,11 +228,16 @@ func (vp *ValPtr[K, V]) LoadPtrAndDelete(key K) *V {
 // LoadPtr returns the pointer to the value of a key. Returns nil when key isn't found.
 func (vp *ValPtr[K, V]) LoadPtr(key K) *V {
 	hash := vp.HashF(key)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return nil
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			return (*V)(atomic.LoadPointer(&(*ptrNode[K])(curAddr).val))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if v := vp.value((*ptrNode[K])(curAddr)); v != tomb {
+				return (*V)(v)
+			}
 		}
 	}
 }
@@ -85,10 +245,15 @@ func (vp *ValPtr[K, V]) LoadPtr(key K) *V {
 // StorePtr of the value of a given key.
 func (vp *ValPtr[K, V]) StorePtr(key K, val *V) bool {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	var new *ptrNode[K]
 	fb, path := func() *relay {
 		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash)
-	}, evictStack{}
+	}, vp.path()
 	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
 		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
 			/*
@@ -96,16 +261,22 @@ func (vp *ValPtr[K, V]) StorePtr(key K, val *V) bool {
 				Also according to benchmarks, the cases where an object is allocated but ultimately unused is never encountered, meaning it's extremely rare.
 			*/
 			if new == nil {
-				new = &ptrNode[K]{relay{hash: hash}, unsafe.Pointer(val), key}
+				new = vp.node(hash, unsafe.Pointer(val), key)
 			}
 			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
-				vp.size.Add(resizingMask << 1)
+				vp.linked(&new.val)
+				vp.added(hash, &path)
 				vp.trySplit()
+				vp.changed(hash, key, tomb, unsafe.Pointer(val))
 				return true
 			}
-		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && (*ptrNode[K])(rightAddr).key == key {
-			atomic.StorePointer(&(*ptrNode[K])(rightAddr).val, unsafe.Pointer(val))
-			return false
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vp.eq((*ptrNode[K])(rightAddr).key, key) {
+			if old := vp.swap((*ptrNode[K])(rightAddr), unsafe.Pointer(val)); old != tomb {
+				vp.changed(hash, key, old, unsafe.Pointer(val))
+				return false
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
 		} else {
 			path.Push(rightAddr)
 			left = (*relay)(rightAddr)
@@ -116,22 +287,89 @@ func (vp *ValPtr[K, V]) StorePtr(key K, val *V) bool {
 // LoadOrStorePtr stores val to key when key wasn't present and returns nil or returns the pointer to the value corresponding to key.
 func (vp *ValPtr[K, V]) LoadOrStorePtr(key K, val *V) *V {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	var new *ptrNode[K]
 	fb, path := func() *relay {
 		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash)
-	}, evictStack{}
+	}, vp.path()
 	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
 		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
 			if new == nil {
-				new = &ptrNode[K]{relay{hash: hash}, unsafe.Pointer(val), key}
+				new = vp.node(hash, unsafe.Pointer(val), key)
 			}
 			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
-				vp.size.Add(resizingMask << 1)
+				vp.linked(&new.val)
+				vp.added(hash, &path)
 				vp.trySplit()
+				vp.changed(hash, key, tomb, unsafe.Pointer(val))
 				return nil
 			}
-		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && (*ptrNode[K])(rightAddr).key == key {
-			return (*V)(atomic.LoadPointer(&(*ptrNode[K])(rightAddr).val))
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vp.eq((*ptrNode[K])(rightAddr).key, key) {
+			if v := vp.value((*ptrNode[K])(rightAddr)); v != tomb {
+				return (*V)(v)
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// Compute atomically updates key with what f returns. f receives the current value and whether key is present, and the returned ComputeOp decides whether key is kept, stored to, or deleted. f is called again when key is changed concurrently, so it should be free of side effects. f is called without any lock held, so it may use the map even when it's observed by OnChange. Returns the value of key after the call and whether key is present.
+func (vp *ValPtr[K, V]) Compute(key K, f func(old *V, loaded bool) (*V, ComputeOp)) (*V, bool) {
+	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var new *ptrNode[K]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash)
+	}, vp.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			val, op := callCompute(&vp.base, hash, f, nil, false)
+			if op != STORE {
+				return nil, false
+			} else if new == nil {
+				new = vp.node(hash, unsafe.Pointer(val), key)
+			} else {
+				new.val = vp.first(unsafe.Pointer(val))
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				vp.linked(&new.val)
+				vp.added(hash, &path)
+				vp.trySplit()
+				vp.changed(hash, key, tomb, unsafe.Pointer(val))
+				return val, true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vp.eq((*ptrNode[K])(rightAddr).key, key) {
+			for old := vp.value((*ptrNode[K])(rightAddr)); old != tomb; old = vp.value((*ptrNode[K])(rightAddr)) {
+				switch val, op := callCompute(&vp.base, hash, f, (*V)(old), true); op {
+				case KEEP:
+					return (*V)(old), true
+				case STORE:
+					if vp.cas((*ptrNode[K])(rightAddr), old, unsafe.Pointer(val)) {
+						vp.changed(hash, key, old, unsafe.Pointer(val))
+						return val, true
+					}
+				case DELETE:
+					if vp.cas((*ptrNode[K])(rightAddr), old, tomb) {
+						vp.unlink((*relay)(rightAddr))
+						vp.changed(hash, key, old, tomb)
+						return nil, false
+					}
+				}
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
 		} else {
 			path.Push(rightAddr)
 			left = (*relay)(rightAddr)
@@ -142,11 +380,19 @@ func (vp *ValPtr[K, V]) LoadOrStorePtr(key K, val *V) *V {
 // SwapPtr of a given key. Returns the old value or nil if key wasn't present.
 func (vp *ValPtr[K, V]) SwapPtr(key K, val *V) *V {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return nil
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			return (*V)(atomic.SwapPointer(&(*ptrNode[K])(curAddr).val, unsafe.Pointer(val)))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if old := vp.swap((*ptrNode[K])(curAddr), unsafe.Pointer(val)); old != tomb {
+				vp.changed(hash, key, old, unsafe.Pointer(val))
+				return (*V)(old)
+			}
 		}
 	}
 }
@@ -154,12 +400,21 @@ func (vp *ValPtr[K, V]) SwapPtr(key K, val *V) *V {
 // CompareAndSwapPtr of a given key.
 func (vp *ValPtr[K, V]) CompareAndSwapPtr(key K, old, new *V) CASResult {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return NULL
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			a := atomic.CompareAndSwapPointer(&(*ptrNode[K])(curAddr).val, unsafe.Pointer(old), unsafe.Pointer(new))
-			return *(*CASResult)(unsafe.Pointer(&a))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if vp.cas((*ptrNode[K])(curAddr), unsafe.Pointer(old), unsafe.Pointer(new)) {
+				vp.changed(hash, key, unsafe.Pointer(old), unsafe.Pointer(new))
+				return SUCCESS
+			} else if vp.value((*ptrNode[K])(curAddr)) != tomb {
+				return FAILED
+			}
 		}
 	}
 }
@@ -167,62 +422,77 @@ func (vp *ValPtr[K, V]) CompareAndSwapPtr(key K, old, new *V) CASResult {
 // CompareAndSwap value of a given key. That is, set the value to new only when when eq(old)==true.
 func (vp *ValPtr[K, V]) CompareAndSwap(key K, new *V, eq func(*V) bool) CASResult {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return NULL
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			if old := atomic.LoadPointer(&(*ptrNode[K])(curAddr).val); eq((*V)(old)) {
-				a := atomic.CompareAndSwapPointer(&(*ptrNode[K])(curAddr).val, old, unsafe.Pointer(new))
-				return *(*CASResult)(unsafe.Pointer(&a))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if old := vp.value((*ptrNode[K])(curAddr)); old == tomb {
+				continue
+			} else if callEq(&vp.base, hash, eq, (*V)(old)) {
+				if vp.cas((*ptrNode[K])(curAddr), old, unsafe.Pointer(new)) {
+					vp.changed(hash, key, old, unsafe.Pointer(new))
+					return SUCCESS
+				} else if vp.value((*ptrNode[K])(curAddr)) == tomb {
+					continue
+				}
 			}
 			return FAILED
 		}
 	}
 }
 
-/*
-CaD ops implemented by itself like this isn't linerizable. To make them linerizable. First, one would need to change StorePtr to check for nil val. Second, one would need to change CaS to check for nil val. These changes will slightly degrade the performance of both, but the reason that I decided to not make CaD available is because I don't see it as a useful operation.
-*/
-/*
-func (vp *ValPtr[K, V]) ComparePtrAndDelete(key K, old  *V) CASResult {
+// ComparePtrAndDelete deletes key only when its value is old. Deleting is linearized at replacing the value, so it's ordered with all other operations on key.
+func (vp *ValPtr[K, V]) ComparePtrAndDelete(key K, old *V) CASResult {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return NULL
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			if atomic.CompareAndSwapPointer(&(*ptrNode[K])(curAddr).val, unsafe.Pointer(old), nil) { //because old!=nil, so this will fail if another CaD changed val to nil; only 1 CaD may success on the same key without Store.
-				if (*relay)(curAddr).mark() {
-					vp.size.And(^uintptr(1 - 1))
-					vp.tryMerge()
-					return SUCCESS
-				}
-				return NULL
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			if vp.cas((*ptrNode[K])(curAddr), unsafe.Pointer(old), tomb) {
+				vp.unlink((*relay)(curAddr))
+				vp.changed(hash, key, unsafe.Pointer(old), tomb)
+				return SUCCESS
+			} else if vp.value((*ptrNode[K])(curAddr)) != tomb {
+				return FAILED
 			}
-			return FAILED
 		}
 	}
 }
-func (vp *ValPtr[K, V]) CompareAndDelete(key K, eq func(  *V) bool) CASResult {
+
+// CompareAndDelete deletes key only when eq(value)==true. eq may be called more than once when the value is changed concurrently.
+func (vp *ValPtr[K, V]) CompareAndDelete(key K, eq func(*V) bool) CASResult {
 	hash := vp.HashF(key)
+	vp.begin(hash)
+	defer vp.end(hash)
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return NULL
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*ptrNode[K])(curAddr).key == key {
-			if old := atomic.LoadPointer(&(*ptrNode[K])(curAddr).val); old == nil {
-				return NULL //another CaD operation deleted it; only 1 CaD may success on the same key without Store.
-			} else if eq((*V)(old)) && atomic.CompareAndSwapPointer(&(*ptrNode[K])(curAddr).val, old, nil) {
-				if (*relay)(curAddr).mark() {
-					vp.size.And(^uintptr(1 - 1))
-					vp.tryMerge()
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, key) {
+			for old := vp.value((*ptrNode[K])(curAddr)); old != tomb; old = vp.value((*ptrNode[K])(curAddr)) {
+				if !callEq(&vp.base, hash, eq, (*V)(old)) {
+					return FAILED
+				} else if vp.cas((*ptrNode[K])(curAddr), old, tomb) {
+					vp.unlink((*relay)(curAddr))
+					vp.changed(hash, key, old, tomb)
 					return SUCCESS
 				}
-				return NULL
 			}
-			return FAILED
 		}
 	}
 }
-*/
 
 // TakePtr returns a key value pair from the map that has the smallest hash value for the key. This is designed to replace the patterns
 //
@@ -238,47 +508,304 @@ func (vp *ValPtr[K, V]) CompareAndDelete(key K, eq func(  *V) bool) CASResult {
 //						break
 //					}
 func (vp *ValPtr[K, V]) TakePtr() (*K, *V) {
-	cur := vp.firstRelay.walk()
-	for ; isRelay(cur); cur = (*relay)(addr(cur)).walk() {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
 	}
-	if cur == nil {
-		return nil, nil
+	for cur := vp.firstRelay.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if !isRelay(cur) {
+			if v := vp.value((*ptrNode[K])(cur)); v != tomb {
+				key := &(*ptrNode[K])(cur).key
+				if vp.nodes != nil { //the node may be reused once it's deleted.
+					k := *key
+					key = &k
+				}
+				return key, (*V)(v)
+			}
+		}
 	}
-	a := (*ptrNode[K])(cur)
-	return &a.key, (*V)(atomic.LoadPointer(&a.val))
+	return nil, nil
 }
 
 // Range over the key value pairs in the map, stopping when yield returns false. Range isn't linearizable.
 func (vp *ValPtr[K, V]) Range(yield func(K, *V) bool) {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := vp.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); !isRelay(cur) {
-			if a := (*ptrNode[K])(curAddr); !yield(a.key, (*V)(atomic.LoadPointer(&a.val))) {
+			if a, v := (*ptrNode[K])(curAddr), vp.value((*ptrNode[K])(curAddr)); v != tomb && !yield(a.key, (*V)(v)) {
+				break
+			}
+		}
+	}
+}
+
+// RangeFrom is Range over the keys whose hash isn't smaller than hash, in the order of hash.
+func (vp *ValPtr[K, V]) RangeFrom(hash uint, yield func(K, *V) bool) {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := vp.seek(hash), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a, v := (*ptrNode[K])(curAddr), vp.value((*ptrNode[K])(curAddr)); v != tomb && !yield(a.key, (*V)(v)) {
+				break
+			}
+		}
+	}
+}
+
+// Scan is Range from where c is, in the order of hash. c is updated to the last key given to yield, so the next Scan with c starts after it. Scan isn't linearizable.
+func (vp *ValPtr[K, V]) Scan(c *Cursor, yield func(K, *V) bool) {
+	if c.done {
+		return
+	}
+	if vp.nodes != nil {
+		defer vp.nodes.pin(c.hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr, seen := vp.seek(c.hash), (unsafe.Pointer)(nil), c.skip; ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil {
+			c.done = true
+			return
+		} else if !isRelay(cur) {
+			if a, v := (*ptrNode[K])(curAddr), vp.value((*ptrNode[K])(curAddr)); v != tomb && c.visit(a.hash, &seen) && !yield(a.key, (*V)(v)) {
+				break
+			}
+		}
+	}
+}
+
+// All returns an iterator over the key value pairs in the map. It's the same as Range, so it isn't linearizable either.
+func (vp *ValPtr[K, V]) All() iter.Seq2[K, *V] {
+	return vp.Range
+}
+
+// Keys returns an iterator over the keys in the map.
+func (vp *ValPtr[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		vp.Range(func(k K, _ *V) bool { return yield(k) })
+	}
+}
+
+// Values returns an iterator over the pointers to the values in the map.
+func (vp *ValPtr[K, V]) Values() iter.Seq[*V] {
+	return func(yield func(*V) bool) {
+		vp.Range(func(_ K, v *V) bool { return yield(v) })
+	}
+}
+
+// Insert stores the key value pairs from seq, overwriting existing keys. It's the counterpart of maps.Insert.
+func (vp *ValPtr[K, V]) Insert(seq iter.Seq2[K, *V]) {
+	for k, v := range seq {
+		vp.StorePtr(k, v)
+	}
+}
+
+// StoreMany is StorePtr of vals[i] to keys[i] for all i, reporting whether each key is added. Keys are sorted by hash first, so the list is traversed once instead of once per key. Equal keys are stored in the order they appear.
+func (vp *ValPtr[K, V]) StoreMany(keys []K, vals []*V) []bool {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
+	}
+	order := vp.sortByHash(keys)
+	added := make([]bool, len(keys))
+	var hash uint
+	var left *relay
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash)
+	}, vp.path()
+	for _, o := range order {
+		i := o.i
+		hash, left = o.hash, vp.nearer(left, o.hash)
+		vp.begin(hash)
+		var new *ptrNode[K]
+		for l, right := left.crawl(&path, fb); ; l, right = l.crawl(&path, fb) {
+			if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+				if new == nil {
+					new = vp.node(hash, unsafe.Pointer(vals[i]), keys[i])
+				}
+				if new.next = right; l.tryLink(right, unsafe.Pointer(new)) {
+					vp.linked(&new.val)
+					vp.added(hash, &path)
+					vp.trySplit()
+					vp.changed(hash, keys[i], tomb, unsafe.Pointer(vals[i]))
+					added[i], left = true, l
+					break
+				}
+			} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vp.eq((*ptrNode[K])(rightAddr).key, keys[i]) {
+				if old := vp.swap((*ptrNode[K])(rightAddr), unsafe.Pointer(vals[i])); old != tomb {
+					vp.changed(hash, keys[i], old, unsafe.Pointer(vals[i]))
+					left = l //the next key may be equal, so it must start before this node.
+					break
+				}
+				path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+				l = (*relay)(rightAddr)
+			} else {
+				path.Push(rightAddr)
+				l = (*relay)(rightAddr)
+			}
+		}
+		vp.end(hash)
+	}
+	return added
+}
+
+// LoadMany is LoadPtr of all keys, traversing the list once.
+func (vp *ValPtr[K, V]) LoadMany(keys []K) []*V {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
+	}
+	order := vp.sortByHash(keys)
+	vals := make([]*V, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = vp.nearer(from, hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
 				break
+			} else if !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, keys[i]) {
+				if v := vp.value((*ptrNode[K])(curAddr)); v != tomb {
+					vals[i] = (*V)(v)
+					break
+				}
 			}
 		}
 	}
+	return vals
+}
+
+// DeleteMany is Delete of all keys, traversing the list once. Reports whether each key is deleted; only the first of equal keys can be.
+func (vp *ValPtr[K, V]) DeleteMany(keys []K) []bool {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
+	}
+	order := vp.sortByHash(keys)
+	deleted := make([]bool, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = vp.nearer(from, hash)
+		vp.begin(hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
+				break
+			} else if !isRelay(cur) && vp.eq((*ptrNode[K])(curAddr).key, keys[i]) {
+				if old := vp.swap((*ptrNode[K])(curAddr), tomb); old != tomb {
+					vp.unlink((*relay)(curAddr))
+					vp.changed(hash, keys[i], old, tomb)
+					deleted[i] = true
+					break
+				}
+			}
+		}
+		vp.end(hash)
+	}
+	return deleted
+}
+
+// Clear deletes all keys and reports true, or reports false without deleting any unless writes are tracked by TrackWrites, since it's linearizable only with the writes it can wait for. It waits for the writes and snapshots in progress and holds off new ones until it detaches the list, which it's linearized at: operations starting afterward see an empty map at once, and the detached keys are deleted one by one afterward.
+func (vp *ValPtr[K, V]) Clear() bool {
+	return vp.clear(func(n *relay) bool {
+		if !n.mark() {
+			return false
+		} else if old := vp.value((*ptrNode[K])(unsafe.Pointer(n))); old != tomb {
+			vp.changed(n.hash, (*ptrNode[K])(unsafe.Pointer(n)).key, old, tomb)
+		}
+		return true
+	})
 }
 
 // Copy the map. This is faster than adding the keys one by one. Copy isn't linearizable.
 func (vp *ValPtr[K, V]) Copy() *ValPtr[K, V] {
-	copied := ValPtr[K, V]{base[K]{MinAvgBucketSize: vp.MinAvgBucketSize, MaxAvgBucketSize: vp.MaxAvgBucketSize, maxLogChunkSize: vp.maxLogChunkSize, buckets: newChunkArr(vp.maxLogChunkSize, (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).logChunkSize), HashF: vp.HashF}}
-	tail := &copied.firstRelay
-	copied.buckets.first = uintptr(unsafe.Pointer(tail))
-	tailIndex := uint(0)
+	return vp.copy(vp.value)
+}
+
+// copy the nodes whose value by val isn't tomb.
+func (vp *ValPtr[K, V]) copy(val func(n *ptrNode[K]) unsafe.Pointer) *ValPtr[K, V] {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0 % trackerStripes).Add(-1)
+	}
+	copied := &ValPtr[K, V]{base: base[K]{MinAvgBucketSize: vp.MinAvgBucketSize, MaxAvgBucketSize: vp.MaxAvgBucketSize, maxLogChunkSize: vp.maxLogChunkSize, HashF: vp.HashF, eq: vp.eq}}
+	b := copied.builder((*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).logChunkSize)
 	for cur, curAddr := vp.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); !isRelay(cur) {
 			a := (*ptrNode[K])(curAddr)
-			if index := copied.buckets.Index(a.hash); index != tailIndex {
-				new := &relay{hash: index * (1 << copied.buckets.logChunkSize)}
-				tail.next = unsafe.Pointer(uintptr(unsafe.Pointer(new)) | relayMask)
-				tail = new
-				copied.buckets.set(index, new)
-				tailIndex = index
+			if v := val(a); v != tomb {
+				b.link(&(&ptrNode[K]{relay{hash: a.hash}, v, a.key}).relay)
 			}
-			tail.next = unsafe.Pointer(&ptrNode[K]{relay{hash: a.hash}, atomic.LoadPointer(&(*ptrNode[K])(curAddr).val), a.key})
-			tail = (*relay)(tail.next)
-			copied.size.Add(resizingMask << 1)
 		}
 	}
-	return &copied
+	b.done()
+	return copied
+}
+
+// Encode writes the keys and values in the map to w, converting them to bytes by keys and vals. Nil values are written as nil. Like Copy, Encode isn't linearizable; encode a map made by Copy of a Snapshot when it must be. It returns the first error of w.
+func (vp *ValPtr[K, V]) Encode(w io.Writer, keys Codec[K], vals Codec[V]) error {
+	e := newEncoder(w, kindValPtr)
+	for k, v := range vp.Range {
+		e.entry()
+		if encodeField(e, keys, k, 0); v == nil {
+			e.buf = append(e.buf, 0)
+		} else {
+			encodeField(e, vals, *v, 1)
+		}
+		if e.err != nil {
+			break
+		}
+	}
+	return e.done()
+}
+
+// Decode replaces the contents of the map with what Encode wrote to r, converting the bytes back by keys and vals. The nodes are laid out in order like Copy instead of being stored one by one. The map mustn't be used concurrently while it's decoded, and it's unchanged when an error is returned. r may be read past the end of the map unless it's an io.ByteReader.
+func (vp *ValPtr[K, V]) Decode(r io.Reader, keys Codec[K], vals Codec[V]) error {
+	d, err := newDecoder(r, kindValPtr)
+	if err != nil {
+		return err
+	}
+	ks, vs, err := decodeEntries(d, keys, func(d *decoder) (*V, error) {
+		if n, err := d.uvarint(); err != nil || n == 0 {
+			return nil, err
+		} else {
+			v, err := decodeField(d, vals, n-1)
+			return &v, err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return vp.load(ks, func(hash uint, i int) *relay {
+		return &(&ptrNode[K]{relay{hash: hash}, unsafe.Pointer(vs[i]), ks[i]}).relay
+	})
+}
+
+// Snapshot copies the map at a single moment without blocking writes, reading the versions of the values kept since that moment. It reports false without copying unless writes are tracked by TrackWrites. Only the pointers are copied, so changes made through them are seen by the snapshot.
+func (vp *ValPtr[K, V]) Snapshot() (ValPtrSnapshot[K, V], bool) {
+	var copied *ValPtr[K, V]
+	ok := vp.snapshot(func(moment uint64) {
+		copied = vp.copy(func(n *ptrNode[K]) unsafe.Pointer {
+			if v := at[unsafe.Pointer](vp.writes, &n.val, moment); v != nil {
+				return v.val
+			}
+			return tomb
+		})
+	})
+	return ValPtrSnapshot[K, V]{copied}, ok
+}
+
+// ValPtrSnapshot is a read-only view of a ValPtr taken by Snapshot. All of its methods are linearizable since it never changes.
+type ValPtrSnapshot[K any, V any] struct {
+	m *ValPtr[K, V]
+}
+
+func (s ValPtrSnapshot[K, V]) LoadPtr(key K) *V {
+	return s.m.LoadPtr(key)
+}
+func (s ValPtrSnapshot[K, V]) Range(yield func(K, *V) bool) {
+	s.m.Range(yield)
+}
+func (s ValPtrSnapshot[K, V]) Size() uint {
+	return s.m.Size()
 }
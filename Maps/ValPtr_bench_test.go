@@ -2,6 +2,7 @@ package Maps
 
 //these are mainly used for measuring performances to find the optimal implementation. for benchmark to compare with other implementations see the cmps subdirectory.
 import (
+	"math/rand"
 	"sync/atomic"
 	"testing"
 	"unsafe"
@@ -95,6 +96,34 @@ func BenchmarkDelete_Collision(b *testing.B) {
 		}
 	})
 }
+func BenchmarkDelete_CollisionAttack(b *testing.B) { //keys chosen to share a hash unless the map has its own seed.
+	const maxHash = 1 << 16
+	keys := testCollidingKeys(1024)
+	for name, hashF := range map[string]func(uint) uint{
+		"Unseeded": func(k uint) uint { return testWeakHash(0, k) },
+		"Seeded":   Seeded(testWeakHash),
+		"SeedHash": nil,
+	} {
+		b.Run(name, func(b *testing.B) {
+			vp := NewValPtr[uint, uint](benchMinBucketSize, benchMaxBucketSize, maxHash-1, hashF)
+			if hashF == nil {
+				SeedHash(vp, testWeakHash)
+			}
+			for i := range keys {
+				vp.StorePtr(keys[i], &keys[i])
+			}
+			var count atomic.Uintptr
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if k := &keys[count.Add(1)%uintptr(len(keys))]; vp.Delete(*k) {
+						vp.StorePtr(*k, k)
+					}
+				}
+			})
+		})
+	}
+}
 func BenchmarkStoreAndDelete_ScatteredEmpty(b *testing.B) {
 	const maxHash, existing uint = 1024, 0
 	vp := NewValPtr[uint, uint](benchMinBucketSize, benchMaxBucketSize, maxHash-1, benchHashF)
@@ -305,3 +334,108 @@ func BenchmarkLoadOrStorePtr_Adversarial(b *testing.B) {
 	})
 	customStat(b)
 }
+func makeBatch(b *testing.B, n, maxKey uint) ([]uint, []*uint) {
+	b.Helper()
+	keys, vals := make([]uint, n), make([]*uint, n)
+	for i := range keys {
+		keys[i] = uint(rand.Intn(int(maxKey)))
+		vals[i] = &keys[i]
+	}
+	return keys, vals
+}
+
+// the batch benchmarks compare a batch call with calling the single key version for each key. batching pays off when the batch covers a large part of the map, as the list is then traversed mostly sequentially.
+func BenchmarkStorePtr_Batch(b *testing.B) {
+	const batch, maxHash = 1 << 14, 1 << 18
+	keys, vals := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		for i := range keys {
+			vp.StorePtr(keys[i], vals[i])
+		}
+	}
+}
+func BenchmarkStoreMany_Batch(b *testing.B) {
+	const batch, maxHash = 1 << 14, 1 << 18
+	keys, vals := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		vp.StoreMany(keys, vals)
+	}
+}
+func BenchmarkLoadPtr_Batch(b *testing.B) {
+	const batch, maxHash = 1 << 14, 1 << 18
+	keys, _ := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		for _, k := range keys {
+			sideEffUintptr = uintptr(unsafe.Pointer(vp.LoadPtr(k)))
+		}
+	}
+}
+func BenchmarkLoadMany_Batch(b *testing.B) {
+	const batch, maxHash = 1 << 14, 1 << 18
+	keys, _ := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		sideEffUintptr = uintptr(unsafe.Pointer(vp.LoadMany(keys)[0]))
+	}
+}
+func BenchmarkStoreMany_DenseBatch(b *testing.B) { //most keys of the map are in the batch, so the walk between 2 keys is short.
+	const batch, maxHash = 1 << 20, 1 << 20
+	keys, vals := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		vp.StoreMany(keys, vals)
+	}
+}
+func BenchmarkStorePtr_DenseBatch(b *testing.B) {
+	const batch, maxHash = 1 << 20, 1 << 20
+	keys, vals := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		for i := range keys {
+			vp.StorePtr(keys[i], vals[i])
+		}
+	}
+}
+func BenchmarkLoadMany_DenseBatch(b *testing.B) {
+	const batch, maxHash = 1 << 20, 1 << 20
+	keys, _ := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		sideEffUintptr = uintptr(unsafe.Pointer(vp.LoadMany(keys)[0]))
+	}
+}
+func BenchmarkLoadPtr_DenseBatch(b *testing.B) {
+	const batch, maxHash = 1 << 20, 1 << 20
+	keys, _ := makeBatch(b, batch, maxHash)
+	vp := makeWithKeys(b, maxHash, maxHash-1)
+	b.ResetTimer()
+	for range b.N {
+		for _, k := range keys {
+			sideEffUintptr = uintptr(unsafe.Pointer(vp.LoadPtr(k)))
+		}
+	}
+}
+
+// overwriting a key of ValAny reuses the box that's swapped out, so it should report 0 allocs/op once the pool is warm.
+func BenchmarkValAny_Store_Overwrite(b *testing.B) {
+	const maxKey = 1 << 10
+	va := NewValAny[uint, [4]uint](benchMinBucketSize, benchMaxBucketSize, maxKey-1, benchHashF)
+	for i := range uint(maxKey) {
+		va.Store(i, [4]uint{i})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range uint(b.N) {
+		va.Store(i%maxKey, [4]uint{i})
+	}
+}
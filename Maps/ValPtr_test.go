@@ -1,10 +1,15 @@
 package Maps
 
 import (
+	"maps"
 	"math/rand"
+	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 const (
@@ -476,90 +481,179 @@ func TestValPtr_CompareAndSwap(t *testing.T) {
 	}
 }
 
-/*
-	func TestValPtr_ComparePtrAndDelete(t *testing.T) {
-		vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 16, testHashF)
-		if vp.ComparePtrAndDelete(0, nil) != NULL {
-			t.Fail()
-		}
-		vs := make([]testVPT, 5)
-		results := make([]CASResult, 4)
-		for range rand.Intn(testAddN) {
-			vp.StorePtr(0, &vs[0])
-			wg := sync.WaitGroup{}
-			wg.Add(3)
-			go func() {
-				results[0] = vp.ComparePtrAndDelete(0, &vs[0])
-				wg.Done()
-			}()
-			go func() {
-				results[1] = vp.ComparePtrAndDelete(0, &vs[0])
-				wg.Done()
-			}()
-			go func() {
-				if vp.StorePtr(0, &vs[1]) {
-					results[2] = NULL
-				} else {
-					results[2] = SUCCESS
-				}
-				wg.Done()
-			}()
-			wg.Wait()
-			if results[2] == NULL {
-				if (results[0]+results[1])&1 == 0 {
-					t.Fatal("0 and 1 should contain 1 NULL/FAILED and 1 SUCCESS", results)
-				}
+func TestValPtr_ComparePtrAndDelete(t *testing.T) {
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.ComparePtrAndDelete(0, nil) != NULL {
+		t.Fail()
+	}
+	vs := make([]testVPT, 5)
+	results := make([]CASResult, 4)
+	for range rand.Intn(testAddN) {
+		vp.StorePtr(0, &vs[0])
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			results[0] = vp.ComparePtrAndDelete(0, &vs[0])
+			wg.Done()
+		}()
+		go func() {
+			results[1] = vp.ComparePtrAndDelete(0, &vs[0])
+			wg.Done()
+		}()
+		go func() {
+			if vp.StorePtr(0, &vs[1]) {
+				results[2] = NULL
 			} else {
-				if results[0] == SUCCESS && results[1] == SUCCESS {
-					t.Fatal("0 and 1 mustn't all SUCCESS if node is changed.", results)
-				}
+				results[2] = SUCCESS
+			}
+			wg.Done()
+		}()
+		wg.Wait()
+		if results[2] == NULL {
+			if (results[0]+results[1])&1 == 0 {
+				t.Fatal("0 and 1 should contain 1 NULL/FAILED and 1 SUCCESS", results)
+			}
+		} else {
+			if results[0] == SUCCESS && results[1] == SUCCESS {
+				t.Fatal("0 and 1 mustn't all SUCCESS if node is changed.", results)
 			}
 		}
 	}
+}
 
-	func TestValPtr_CompareAndDelete(t *testing.T) {
-		vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 16, testHashF)
-		if vp.CompareAndDelete(0, func(*testVPT) bool { return true }) != NULL {
-			t.Fail()
-		}
-		vs := make([]testVPT, 5)
-		for i := range vs {
-			vs[i] = testVPT(i)
+func TestValPtr_CompareAndDelete(t *testing.T) {
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.CompareAndDelete(0, func(*testVPT) bool { return true }) != NULL {
+		t.Fail()
+	}
+	vs := make([]testVPT, 5)
+	for i := range vs {
+		vs[i] = testVPT(i)
+	}
+	results := make([]CASResult, 4)
+	for range rand.Intn(testAddN) {
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		vp.StorePtr(0, &vs[0])
+		go func() {
+			results[0] = vp.CompareAndDelete(0, func(val *testVPT) bool { return *val == vs[0] })
+			wg.Done()
+		}()
+		go func() {
+			results[1] = vp.CompareAndDelete(0, func(val *testVPT) bool { return *val == vs[0] })
+			wg.Done()
+		}()
+		go func() {
+			if vp.StorePtr(0, &vs[1]) {
+				results[2] = NULL
+			} else {
+				results[2] = SUCCESS
+			}
+			wg.Done()
+		}()
+		wg.Wait()
+		if results[2] == NULL {
+			if (results[0]+results[1])&1 == 0 {
+				t.Fatal("0 and 1 should contain 1 NULL/FAILED and 1 SUCCESS", results)
+			}
+		} else {
+			if results[0] == SUCCESS && results[1] == SUCCESS {
+				t.Fatal("0 and 1 mustn't all SUCCESS if node is changed.", results)
+			}
 		}
-		results := make([]CASResult, 4)
-		for range rand.Intn(testAddN) {
-			wg := sync.WaitGroup{}
-			wg.Add(3)
-			vp.StorePtr(0, &vs[0])
-			go func() {
-				results[0] = vp.CompareAndDelete(0, func(val *testVPT) bool { return *val == vs[0] })
-				wg.Done()
-			}()
-			go func() {
-				results[1] = vp.CompareAndDelete(0, func(val *testVPT) bool { return *val == vs[0] })
-				wg.Done()
-			}()
-			go func() {
-				if vp.StorePtr(0, &vs[1]) {
-					results[2] = NULL
-				} else {
-					results[2] = SUCCESS
+	}
+}
+func TestValPtr_ComparePtrAndDelete_Lease(t *testing.T) { //each key is a lease; only the holder of the token may release it.
+	const keys = 16
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	tokens := make([]testVPT, testThrdsN)
+	holders := make([]atomic.Int32, keys)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j*(i+1)) % keys
+				if vp.LoadOrStorePtr(k, &tokens[i]) != nil {
+					if vp.ComparePtrAndDelete(k, &tokens[i]) == SUCCESS {
+						t.Error("released a lease held by another.")
+					}
+					continue
 				}
-				wg.Done()
-			}()
-			wg.Wait()
-			if results[2] == NULL {
-				if (results[0]+results[1])&1 == 0 {
-					t.Fatal("0 and 1 should contain 1 NULL/FAILED and 1 SUCCESS", results)
+				if holders[k].Add(1) != 1 {
+					t.Error("lease held by more than 1.")
 				}
-			} else {
-				if results[0] == SUCCESS && results[1] == SUCCESS {
-					t.Fatal("0 and 1 mustn't all SUCCESS if node is changed.", results)
+				holders[k].Add(-1)
+				if a := vp.ComparePtrAndDelete(k, &tokens[i]); a != SUCCESS {
+					t.Error("failed to release own lease:", a)
 				}
 			}
+		}()
+	}
+	wg.Wait()
+	if vp.Size() != 0 {
+		t.Fatal("leases left:", vp.Size())
+	}
+	vp.Range(func(testVPT, *testVPT) bool {
+		t.Fatal("range found released lease.")
+		return false
+	})
+}
+func TestValPtr_Compute(t *testing.T) {
+	const keys = 16
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	if v, ok := vp.Compute(0, func(*testVPT, bool) (*testVPT, ComputeOp) { return nil, DELETE }); v != nil || ok || vp.Size() != 0 {
+		t.Fatal("DELETE on absent key.")
+	}
+	if v, ok := vp.Compute(0, func(*testVPT, bool) (*testVPT, ComputeOp) { return new(testVPT), KEEP }); v != nil || ok || vp.Size() != 0 {
+		t.Fatal("KEEP on absent key.")
+	}
+	incr := func(old *testVPT, loaded bool) (*testVPT, ComputeOp) {
+		a := new(testVPT)
+		if loaded {
+			*a = *old + 1
 		}
+		return a, STORE
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for j := range testAddNEach {
+				vp.Compute(testVPT(j%keys), incr)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVPT(keys) {
+		if v := vp.LoadPtr(i); v == nil || *v != testThrdsN*testAddNEach/keys-1 {
+			t.Fatal("lost update on", i)
+		}
+	}
+	evicted := atomic.Int32{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(keys) {
+				if _, ok := vp.Compute(i, func(old *testVPT, loaded bool) (*testVPT, ComputeOp) {
+					if loaded && *old == testThrdsN*testAddNEach/keys-1 {
+						return nil, DELETE
+					}
+					return old, KEEP
+				}); !ok {
+					evicted.Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if evicted.Load() != keys*testThrdsN || vp.Size() != 0 {
+		t.Fatal("conditional eviction failed.", evicted.Load(), vp.Size())
 	}
-*/
+}
 func TestValPtr_TakePtr(t *testing.T) {
 	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 16, testHashF)
 	if _, v := vp.TakePtr(); v != nil {
@@ -596,6 +690,114 @@ func TestValPtr_Range(t *testing.T) {
 		count++
 	}
 }
+func TestValPtr_All_Keys_Values(t *testing.T) {
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	vs := make([]testVPT, testAddN)
+	for i := range vs {
+		vs[i] = testVPT(i)
+	}
+	vp.Insert(func(yield func(testVPT, *testVPT) bool) {
+		for i := range vs {
+			if !yield(testVPT(i), &vs[i]) {
+				return
+			}
+		}
+	})
+	m := maps.Collect(vp.All())
+	if len(m) != testAddN || uint(len(m)) != vp.Size() {
+		t.Fatal("size mismatch.", len(m), vp.Size())
+	}
+	for k, v := range m {
+		if v != &vs[k] {
+			t.Fatal("wrong value for", k)
+		}
+	}
+	keys, values := slices.Collect(vp.Keys()), slices.Collect(vp.Values())
+	for i := range testAddN {
+		if keys[i] != testVPT(i) || values[i] != &vs[i] {
+			t.Fatal("wrong order at", i)
+		}
+	}
+	for k := range vp.Keys() {
+		if k == 10 {
+			break
+		}
+	}
+	copied := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	copied.Insert(maps.All(m))
+	if copied.Size() != vp.Size() {
+		t.Fatal("Insert from maps.All failed.")
+	}
+}
+func TestValPtr_RangeFrom(t *testing.T) {
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	vs := make([]testVPT, testAddN)
+	for i := range vs {
+		vp.StorePtr(testVPT(i), &vs[i])
+	}
+	from := testVPT(rand.Intn(testAddN))
+	next := from
+	vp.RangeFrom(uint(from), func(k testVPT, v *testVPT) bool {
+		if k != next || v != &vs[k] {
+			t.Fatal("expected", next, "got", k)
+		}
+		next++
+		return true
+	})
+	if next != testAddN {
+		t.Fatal("stopped at", next)
+	}
+}
+func TestValPtr_Scan(t *testing.T) {
+	const pageSize = 7
+	collide := func(a testVPT) uint { return uint(a) >> 2 } //every 4 keys share a hash.
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testAddN>>2, collide)
+	vs := make([]testVPT, testAddN)
+	for i := 0; i < testAddN; i += 2 { //even keys stay, odd keys are added and deleted during the scan.
+		vp.StorePtr(testVPT(i), &vs[i])
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for !stop.Load() {
+				for i := 1; i < testAddN; i += 2 {
+					vp.StorePtr(testVPT(i), &vs[i])
+				}
+				for i := 1; i < testAddN; i += 2 {
+					vp.Delete(testVPT(i))
+				}
+			}
+			wg.Done()
+		}()
+	}
+	visited := make([]byte, testAddN)
+	var c Cursor
+	for lastHash := uint(0); !c.Done(); {
+		n := 0
+		vp.Scan(&c, func(k testVPT, _ *testVPT) bool {
+			if collide(k) < lastHash {
+				t.Fatal("hash isn't ordered.")
+			}
+			lastHash = collide(k)
+			visited[k]++
+			n++
+			return n < pageSize
+		})
+	}
+	stop.Store(true)
+	wg.Wait()
+	for i, v := range visited {
+		if i&1 == 0 && v != 1 { //odd keys sharing the hash of the last visited key can be repeated.
+			t.Fatal(i, "is visited", v, "times.")
+		}
+	}
+	vp.Scan(&c, func(testVPT, *testVPT) bool {
+		t.Fatal("finished cursor still scans.")
+		return false
+	})
+}
 func TestValPtr_Copy(t *testing.T) {
 	vp0 := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
 	for range rand.Intn(testAddN) {
@@ -615,6 +817,310 @@ func TestValPtr_Copy(t *testing.T) {
 			t.Fail()
 		}
 	}
+	vp0 = NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVPT(testAddN / 2) { //the buckets of the upper half are empty, but the copy must still have their relays.
+		vp0.StorePtr(i, new(testVPT))
+	}
+	vp1 = vp0.Copy()
+	for i := range testVPT(testAddN) {
+		if vp1.StorePtr(i, new(testVPT)) != (i >= testAddN/2) {
+			t.Fatal("wrong store to copy", i)
+		}
+	}
+}
+
+func TestValPtr_FromSlice(t *testing.T) {
+	keys, vals := make([]testVPT, testAddN), make([]*testVPT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(i%(testAddN/4)), new(testVPT) //every key repeats 4 times; the last is kept.
+	}
+	rand.Shuffle(len(keys)/2, func(i, j int) { //shuffle the first half only, so that the last of each key stays in place.
+		keys[i], keys[j], vals[i], vals[j] = keys[j], keys[i], vals[j], vals[i]
+	})
+	vp := NewValPtrFromSlice(testMinBSz, testMaxBSz, testMaxHash, testHashF, keys, vals)
+	if vp.Size() != testAddN/4 {
+		t.Fatal("wrong size", vp.Size())
+	}
+	for i := testAddN * 3 / 4; i < testAddN; i++ {
+		if vp.LoadPtr(keys[i]) != vals[i] {
+			t.Fatal("the last value isn't kept", keys[i])
+		}
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := testVPT(i * testAddNEach); j < testVPT((i+1)*testAddNEach); j++ {
+				v := j
+				if vp.StorePtr(j, &v) != (j >= testAddN/4) || vp.LoadPtr(j) != &v {
+					t.Error("wrong store", j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if fromSeq := NewValPtrFromSeq(testMinBSz, testMaxBSz, testMaxHash, testHashF, vp.All()); fromSeq.Size() != vp.Size() || fromSeq.Stats().Keys != vp.Size() {
+		t.Fatal("wrong size from seq", fromSeq.Size(), vp.Size())
+	}
+}
+func TestValPtr_Snapshot(t *testing.T) { //each writer stores the same step to x then y, so any linearizable view has y<=x<=y+1. a copy that isn't linearizable can see the new y with the old x.
+	const writers, gap = 4, 1 << 8 //keys between x and y make the window larger.
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, gap+writers-1, testHashF)
+	vp.TrackWrites()
+	for i := range testVPT(gap + writers) {
+		vp.StorePtr(i, new(testVPT))
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(writers)
+	for w := range testVPT(writers) {
+		go func() {
+			for step := testVPT(1); !stop.Load(); step++ {
+				a := step
+				vp.StorePtr(w, &a)
+				vp.StorePtr(gap+w, &a)
+				if step&7 == 0 {
+					time.Sleep(time.Microsecond)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	check := func(s ValPtrSnapshot[testVPT, testVPT], ok bool) {
+		if !ok {
+			t.Fatal("Snapshot of a tracked map failed.")
+		}
+		if s.Size() != gap+writers {
+			t.Fatal("wrong size", s.Size())
+		}
+		for w := range testVPT(writers) {
+			if x, y := *s.LoadPtr(w), *s.LoadPtr(gap + w); x != y && x != y+1 {
+				t.Fatal("inconsistent snapshot", x, y)
+			}
+		}
+		n := uint(0)
+		s.Range(func(testVPT, *testVPT) bool {
+			n++
+			return true
+		})
+		if n != s.Size() {
+			t.Fatal("Range doesn't match Size.")
+		}
+	}
+	for range testAddNEach {
+		check(vp.Snapshot())
+	}
+	stop.Store(true)
+	wg.Wait()
+	s, ok := vp.Snapshot()
+	check(s, ok)
+	vp.Delete(0)
+	if s.LoadPtr(0) == nil || s.Size() != gap+writers {
+		t.Fatal("snapshot changed by later writes.")
+	}
+	if _, ok := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 0, testHashF).Snapshot(); ok {
+		t.Fatal("Snapshot of a map whose writes aren't tracked succeeded.")
+	}
+}
+func TestValPtr_Snapshot_Busy(t *testing.T) { //writers never pause, which Snapshot mustn't wait for. the snapshot must still have y<=x<=y+1.
+	const writers, gap = testThrdsN, 1 << 8
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, gap+writers-1, testHashF)
+	vp.TrackWrites()
+	for i := range testVPT(gap + writers) {
+		vp.StorePtr(i, new(testVPT))
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(writers)
+	for w := range testVPT(writers) {
+		go func() {
+			for step := testVPT(1); !stop.Load(); step++ {
+				a := step
+				vp.StorePtr(w, &a)
+				vp.StorePtr(gap+w, &a)
+			}
+			wg.Done()
+		}()
+	}
+	for range testAddNEach / 4 {
+		s, _ := vp.Snapshot()
+		for w := range testVPT(writers) {
+			if x, y := *s.LoadPtr(w), *s.LoadPtr(gap + w); x != y && x != y+1 {
+				t.Fatal("inconsistent snapshot", x, y)
+			}
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+}
+func TestValPtr_Snapshot_Writes(t *testing.T) { //writes made while a snapshot is copying must finish without it, and mustn't be seen by it.
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	vp.TrackWrites()
+	vp.PoolNodes()
+	for i := range testVPT(testAddNEach) {
+		vp.StorePtr(i, &i)
+	}
+	var copied *ValPtr[testVPT, testVPT]
+	vp.snapshot(func(moment uint64) {
+		done := make(chan struct{})
+		go func() {
+			for i := range testVPT(testAddNEach) {
+				switch i % 3 {
+				case 0:
+					vp.Delete(i)
+				case 1:
+					vp.StorePtr(i, new(testVPT))
+				default:
+					vp.Delete(i)
+					vp.StorePtr(i, new(testVPT))
+				}
+				vp.StorePtr(testAddNEach+i, &i)
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Minute):
+			t.Fatal("writes wait for the snapshot.")
+		}
+		copied = vp.copy(func(n *ptrNode[testVPT]) unsafe.Pointer {
+			if v := at[unsafe.Pointer](vp.writes, &n.val, moment); v != nil {
+				return v.val
+			}
+			return tomb
+		})
+	})
+	if copied.Size() != testAddNEach {
+		t.Fatal("wrong size", copied.Size())
+	}
+	for i := range testVPT(testAddNEach) {
+		if v := copied.LoadPtr(i); v == nil || *v != i {
+			t.Fatal("snapshot sees a later write to", i)
+		}
+	}
+	if vp.Size() != 2*testAddNEach-(testAddNEach+2)/3 || vp.Stats().Keys != vp.Size() { //the keys deleted meanwhile are removed once the snapshot ends.
+		t.Fatal("wrong size after the snapshot", vp.Size(), vp.Stats().Keys)
+	}
+}
+func TestValPtr_Size_Tracked(t *testing.T) { //Size of a map near empty mustn't underflow when writes are tracked.
+	const keys = 1
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	vp.TrackWrites()
+	running := atomic.Int32{}
+	running.Store(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			a := testVPT(i)
+			for j := range testAddN {
+				if k := testVPT(j % keys); j&1 == 0 {
+					vp.StorePtr(k, &a)
+				} else {
+					vp.Delete(k)
+				}
+			}
+			running.Add(-1)
+		}()
+	}
+	for running.Load() != 0 {
+		if s := vp.Size(); s > keys+testThrdsN { //a size read while writing can be off by the number of writers.
+			t.Fatal("wrong size", s)
+		}
+	}
+	n := uint(0)
+	for range vp.Keys() {
+		n++
+	}
+	if vp.Size() != n {
+		t.Fatal("size is", vp.Size(), "instead of", n)
+	}
+}
+func TestValPtr_Size_Compute(t *testing.T) { //the write of f is in progress while f calls Size, which then can't wait for writes to end.
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	vp.TrackWrites()
+	for i := range testVPT(3) {
+		vp.StorePtr(i, new(testVPT))
+	}
+	vp.Compute(3, func(*testVPT, bool) (*testVPT, ComputeOp) {
+		if n := vp.Size(); n != 3 {
+			t.Error("wrong size in Compute", n)
+		}
+		return new(testVPT), STORE
+	})
+	if vp.Size() != 4 {
+		t.Fatal("wrong size", vp.Size())
+	}
+}
+func TestValPtr_StoreMany_LoadMany_DeleteMany(t *testing.T) {
+	collided := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, 0, func(testVPT) uint { return 0 })
+	for i := range testVPT(3) {
+		collided.StorePtr(i, new(testVPT))
+	}
+	if added := collided.StoreMany([]testVPT{2, 0}, []*testVPT{new(testVPT), new(testVPT)}); added[0] || added[1] || collided.Size() != 3 { //0 is before 2 in the list, so it mustn't be searched from 2.
+		t.Fatal("equal hashes are added again.", added)
+	}
+	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	keys, vals := make([]testVPT, testAddN), make([]*testVPT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(rand.Intn(testAddN>>1)), new(testVPT) //about half are duplicates.
+	}
+	added, want := vp.StoreMany(keys, vals), make(map[testVPT]*testVPT)
+	for i, k := range keys {
+		if _, ok := want[k]; ok == added[i] {
+			t.Fatal("wrong added for", k)
+		}
+		want[k] = vals[i]
+	}
+	if vp.Size() != uint(len(want)) {
+		t.Fatal("wrong size", vp.Size(), len(want))
+	}
+	for i, v := range vp.LoadMany(keys) {
+		if v != want[keys[i]] {
+			t.Fatal("wrong value for", keys[i])
+		}
+	}
+	deleted, seen := vp.DeleteMany(keys), make(map[testVPT]bool)
+	for i, k := range keys {
+		if deleted[i] == seen[k] {
+			t.Fatal("wrong deleted for", k)
+		}
+		seen[k] = true
+	}
+	if vp.Size() != 0 {
+		t.Fatal("keys left", vp.Size())
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			keys, vals := make([]testVPT, testAddNEach), make([]*testVPT, testAddNEach)
+			for j := range keys {
+				keys[j] = testVPT(i + j*testThrdsN)
+				vals[j] = &keys[j]
+			}
+			rand.Shuffle(len(keys), func(a, b int) { keys[a], keys[b] = keys[b], keys[a] })
+			for _, a := range vp.StoreMany(keys, vals) {
+				if !a {
+					t.Error("key isn't added.")
+				}
+			}
+			for j, v := range vp.LoadMany(keys) {
+				if v != vals[j] {
+					t.Error("wrong value.")
+				}
+			}
+			for _, d := range vp.DeleteMany(keys[:testAddNEach/2]) {
+				if !d {
+					t.Error("key isn't deleted.")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if vp.Size() != testThrdsN*testAddNEach/2 {
+		t.Fatal("wrong size", vp.Size())
+	}
 }
 func TestValPtr_Delete(t *testing.T) {
 	vp := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
@@ -664,3 +1170,394 @@ func TestValPtr_invalidSplit(t *testing.T) { //don't split into chunks more than
 		vp.Delete(i)
 	}
 }
+func TestValPtr_Reserve(t *testing.T) {
+	all := make([]testVPT, testAddNEach*testThrdsN)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Reserve(uint(len(all)))
+	reserved := mq.Stats()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.StorePtr(all[j], &all[j])
+				if v := mq.LoadPtr(all[j]); &all[j] != v {
+					t.Error("should have", all[j], v)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	mq.Reserve(uint(len(all))) //concurrent with stores, and there's nothing left to split.
+	wg.Wait()
+	if s := mq.Stats(); s.Splits != reserved.Splits || s.Buckets != reserved.Buckets || s.Keys != uint(len(all)) {
+		t.Fatal("split after Reserve", reserved.Splits, s.Splits, s.Keys)
+	}
+}
+func TestValPtr_Shrink(t *testing.T) {
+	all := make([]testVPT, testAddNEach*testThrdsN)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](1, testMaxBSz, testMaxHash, testHashF) //deletions alone hardly merge.
+	for i, k := range all {
+		mq.StorePtr(k, &all[i])
+	}
+	grown := mq.Stats()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN + 1)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				if j%16 != 0 {
+					mq.LoadPtrAndDelete(all[j])
+					if v := mq.LoadPtr(all[j]); v != nil {
+						t.Error("can't delete", all[j], v)
+					}
+				} else if v := mq.LoadPtr(all[j]); &all[j] != v {
+					t.Error("should have", all[j], v)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	go func() {
+		for range testThrdsN {
+			mq.Shrink()
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+	mq.Shrink()
+	s := mq.Stats()
+	if logChunks := mq.maxLogChunkSize - s.LogChunkSize; s.Buckets >= grown.Buckets || logChunks > 0 && s.Keys>>(logChunks-1) < testMaxBSz {
+		t.Fatal("didn't shrink", grown.Buckets, s.Buckets, s.Keys)
+	}
+	for j := 0; j < len(all); j += 16 {
+		if v := mq.LoadPtr(all[j]); &all[j] != v {
+			t.Fatal("lost after Shrink", all[j], v)
+		}
+	}
+}
+func TestValPtr_Clear1(t *testing.T) {
+	all := make([]testVPT, testAddN)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if mq.StorePtr(all[0], &all[0]); mq.Clear() || mq.Size() != 1 {
+		t.Fatal("cleared without tracking writes")
+	}
+	mq.TrackWrites()
+	for range 2 {
+		for i, k := range all {
+			mq.StorePtr(k, &all[i])
+		}
+		if !mq.Clear() || mq.Size() != 0 || mq.Stats().Buckets != 1 {
+			t.Fatal("not cleared", mq.Size())
+		}
+		for i := range all {
+			if mq.LoadPtr(all[i]) != nil {
+				t.Fatal("can't clear", all[i])
+			}
+		}
+		for range mq.Range {
+			t.Fatal("not empty")
+		}
+	}
+}
+func TestValPtr_Clear2(t *testing.T) {
+	all := make([]testVPT, testAddNEach*testThrdsN)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	var done atomic.Bool
+	cleared := make(chan struct{})
+	go func() {
+		for !done.Load() {
+			mq.Clear()
+		}
+		close(cleared)
+	}()
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.StorePtr(all[j], &all[j])
+				if v := mq.LoadPtr(all[j]); v != nil && &all[j] != v {
+					t.Error("wrong value", all[j], v)
+				}
+				if j%2 == 0 {
+					mq.LoadPtrAndDelete(all[j])
+					if v := mq.LoadPtr(all[j]); v != nil {
+						t.Error("can't delete", all[j], v)
+					}
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	<-cleared
+	n := uint(0)
+	for k, v := range mq.Range {
+		if k%2 == 0 || *v != k {
+			t.Fatal("wrong key", k, *v)
+		}
+		n++
+	}
+	if n != mq.Size() {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+	mq.Clear()
+	if mq.Size() != 0 {
+		t.Fatal("not cleared", mq.Size())
+	}
+}
+func TestValPtr_Clear_Fence(t *testing.T) { //when writes are tracked, Clear waits for the write in progress, so the key it stores is cleared.
+	all := make([]testVPT, testAddNEach)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites()
+	for i := range all[:len(all)-1] {
+		mq.StorePtr(all[i], &all[i])
+	}
+	var cleared atomic.Bool
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	mq.Compute(all[len(all)-1], func(old *testVPT, loaded bool) (*testVPT, ComputeOp) {
+		if !cleared.Load() {
+			go func() {
+				mq.Clear()
+				cleared.Store(true)
+				wg.Done()
+			}()
+			for range testAddNEach {
+				runtime.Gosched()
+			}
+		}
+		if cleared.Load() {
+			t.Error("Clear didn't wait for the write")
+		}
+		return &all[len(all)-1], STORE
+	})
+	wg.Wait()
+	if mq.Size() != 0 || mq.LoadPtr(all[len(all)-1]) != nil {
+		t.Fatal("not cleared", mq.Size())
+	}
+}
+func TestValPtr_PoolNodes(t *testing.T) {
+	all := make([]testVPT, testAddNEach*testThrdsN)
+	for i := range all {
+		all[i] = testVPT(i)
+	}
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.PoolNodes()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	var done atomic.Bool
+	ranged := make(chan struct{})
+	go func() { //a reused node must never be seen with the key of its last use and the value of the next.
+		for !done.Load() {
+			for k, v := range mq.Range {
+				if *v != k {
+					t.Error("wrong value", k, *v)
+				}
+			}
+			if k, v := mq.TakePtr(); k != nil && *k != *v {
+				t.Error("wrong value", *k, *v)
+			}
+		}
+		close(ranged)
+	}()
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for round := range 4 {
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					if !mq.StorePtr(all[j], &all[j]) {
+						t.Error("not added", all[j])
+						return
+					}
+					if v := mq.LoadPtr(all[j]); v != &all[j] {
+						t.Error("wrong value", all[j], v)
+						return
+					}
+					if j%4 != round && !mq.Delete(all[j]) {
+						t.Error("not deleted", all[j])
+						return
+					}
+				}
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					mq.Delete(all[j])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	<-ranged
+	if s := mq.Stats(); s.Reused == 0 || s.Keys != 0 || mq.Size() != 0 {
+		t.Fatal("nodes aren't reused", s.Reused, s.Keys, mq.Size())
+	}
+	if n := testing.AllocsPerRun(testAddNEach, func() {
+		mq.StorePtr(all[0], &all[0])
+		mq.Delete(all[0])
+	}); n >= 1 {
+		t.Fatal("nodes are allocated", n)
+	}
+}
+func TestValPtr_OnChange(t *testing.T) {
+	type change = Change[testVPT, *testVPT]
+	all := make([]testVPT, 4)
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites() //Clear requires it.
+	var got, watched []change
+	mq.OnChange(func(c change) { got = append(got, c) })
+	cancel := mq.Watch(1, func(c change) { watched = append(watched, c) })
+	mq.StorePtr(1, &all[0])
+	mq.StorePtr(2, &all[1])
+	mq.SwapPtr(1, &all[2])
+	mq.CompareAndSwapPtr(1, &all[0], &all[3]) //fails, so it isn't a change.
+	mq.LoadOrStorePtr(1, &all[3])
+	mq.LoadPtrAndDelete(1)
+	mq.Delete(1)
+	cancel()
+	mq.StorePtr(1, &all[3])
+	mq.Clear()
+	want := []change{
+		{Key: 1, New: &all[0], Stored: true},
+		{Key: 2, New: &all[1], Stored: true},
+		{Key: 1, Old: &all[0], New: &all[2], Loaded: true, Stored: true},
+		{Key: 1, Old: &all[2], Loaded: true},
+		{Key: 1, New: &all[3], Stored: true},
+		{Key: 1, Old: &all[3], Loaded: true},
+		{Key: 2, Old: &all[1], Loaded: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("wrong changes", got)
+	}
+	if want = slices.DeleteFunc(want[:4], func(c change) bool { return c.Key != 1 }); !slices.Equal(watched, want) {
+		t.Fatal("wrong watched changes", watched)
+	}
+	once := 0
+	cancel = mq.Watch(1, func(change) {
+		once++
+		cancel() //removing itself while it's called mustn't deadlock.
+	})
+	mq.StorePtr(1, &all[0])
+	mq.StorePtr(1, &all[1])
+	if ws := mq.obs.watches[1%trackerStripes].Load(); once != 1 || len(*ws) != 0 {
+		t.Fatal("watch isn't removed", once, len(*ws))
+	}
+}
+func TestValPtr_OnChange_Write(t *testing.T) { //observers may write to the map, also to the stripe whose changes they're given.
+	const n = 4
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	var got, watched []testVPT
+	mq.OnChange(func(c Change[testVPT, *testVPT]) {
+		if got = append(got, c.Key); c.Stored && c.Key < n*trackerStripes {
+			mq.StorePtr(c.Key+trackerStripes, c.New) //the same stripe.
+		}
+	})
+	mq.Watch(trackerStripes, func(c Change[testVPT, *testVPT]) {
+		watched = append(watched, c.Key)
+		mq.Delete(0)
+	})
+	v := testVPT(0)
+	//the changes made by the observers are delivered before StorePtr returns, since it's the one delivering. the deletion by the watch is queued after the store by OnChange.
+	mq.StorePtr(0, &v)
+	want := []testVPT{0, trackerStripes, 2 * trackerStripes, 0, 3 * trackerStripes, 4 * trackerStripes}
+	if !slices.Equal(got, want) || !slices.Equal(watched, []testVPT{trackerStripes}) {
+		t.Fatal("wrong changes", got, watched)
+	}
+	if mq.LoadPtr(0) != nil || mq.LoadPtr(n*trackerStripes) != &v {
+		t.Fatal("wrong writes")
+	}
+}
+func TestValPtr_OnChange_Compute(t *testing.T) { //the functions given to Compute, CompareAndSwap and CompareAndDelete are called without the lock of the stripe, so they may write to the same stripe.
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	vs := []testVPT{0, 1}
+	mq.StorePtr(trackerStripes, &vs[0]) //Compute only overwrites it, so f isn't called again for a node linked next to key.
+	var got []testVPT
+	mq.OnChange(func(c Change[testVPT, *testVPT]) { got = append(got, c.Key) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mq.Compute(0, func(*testVPT, bool) (*testVPT, ComputeOp) {
+			mq.StorePtr(trackerStripes, &vs[0])
+			return &vs[0], STORE
+		})
+		mq.CompareAndSwap(0, &vs[1], func(v *testVPT) bool {
+			return mq.Delete(trackerStripes) && v == &vs[0]
+		})
+		mq.CompareAndDelete(0, func(v *testVPT) bool {
+			return mq.StorePtr(trackerStripes, v) && v == &vs[1]
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("the functions given to the map are blocked from writing to their stripe")
+	}
+	if mq.LoadPtr(0) != nil || mq.LoadPtr(trackerStripes) != &vs[1] || !slices.Equal(got, []testVPT{trackerStripes, 0, trackerStripes, 0, trackerStripes, 0}) {
+		t.Fatal("wrong changes", got)
+	}
+}
+func TestValPtr_Watch_Order(t *testing.T) { //every change of a key must start from where the previous one ended.
+	const keys = 4
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.OnChange(nil)
+	changes := make([][]Change[testVPT, *testVPT], keys)
+	for k := range testVPT(keys) {
+		mq.Watch(k, func(c Change[testVPT, *testVPT]) {
+			runtime.Gosched() //let other writers race with the delivery.
+			changes[k] = append(changes[k], c)
+		})
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j % keys)
+				switch (i + j) % 3 {
+				case 0:
+					mq.Compute(k, func(old *testVPT, loaded bool) (*testVPT, ComputeOp) {
+						if !loaded {
+							return new(testVPT), STORE
+						}
+						v := *old + 1
+						return &v, STORE
+					})
+				case 1:
+					v := testVPT(j)
+					mq.SwapPtr(k, &v)
+				default:
+					mq.Delete(k)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for k, cs := range changes {
+		for i := 1; i < len(cs); i++ {
+			if cs[i].Loaded != cs[i-1].Stored || cs[i].Loaded && cs[i].Old != cs[i-1].New {
+				t.Fatal("changes out of order", k, i, cs[i-1], cs[i])
+			}
+		}
+		if last := cs[len(cs)-1]; last.Stored != (mq.LoadPtr(testVPT(k)) != nil) || last.Stored && last.New != mq.LoadPtr(testVPT(k)) {
+			t.Fatal("last change isn't the value", k, last)
+		}
+	}
+}
@@ -3,88 +3,323 @@
 package Maps
 
 import (
+	"bytes"
+	"io"
+	"iter"
+	"math"
 	"math/bits"
 	"sync/atomic"
 	"unsafe"
 )
 
-// ValUint32 stores keys as values and values as the respective supported type from atomic package. It saves 1 level of indirection and exerts less pressure on the GC.
-type ValUint32[K comparable, V ~uint32] struct {
+// ValUint32 stores keys as values and values as the respective supported type from atomic package, or as their bits in one for float64 and bool. It saves 1 level of indirection and exerts less pressure on the GC.
+// A write to an existing key also counts itself in the state of the node, so that a delete can compare the value and delete the key in one CAS; the deletes therefore wait for the writes to the same key in progress, which are single atomic operations. When writes are tracked by TrackWrites, the values are kept as versions instead, which are replaced by CAS by every write including the deletes, so they don't wait.
+type ValUint32[K any, V ~uint32] struct {
 	base[K]
+	obs *observers[K, V] //nil unless OnChange is called.
 }
 
 func NewValUint32[K comparable, V ~uint32](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *ValUint32[K, V] {
+	return NewValUint32Eq[K, V](minBucketSize, maxBucketSize, maxHash, hashF, equal[K])
+}
+
+// NewValUint32For is NewValUint32 with the hashF and maxHash picked by HashFor.
+func NewValUint32For[K comparable, V ~uint32](minBucketSize, maxBucketSize byte) *ValUint32[K, V] {
+	hashF, maxHash := HashFor[K]()
+	return NewValUint32[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+}
+
+// NewValUint32Eq is NewValUint32 for keys that aren't comparable, or whose equality isn't ==. eq is used the same way as NewValPtrEq.
+func NewValUint32Eq[K any, V ~uint32](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, eq func(K, K) bool) *ValUint32[K, V] {
 	vp := ValUint32[K, V]{
-		base[K]{MinAvgBucketSize: minBucketSize,
+		base: base[K]{MinAvgBucketSize: minBucketSize,
 			MaxAvgBucketSize: maxBucketSize,
 			maxLogChunkSize:  byte(bits.Len(maxHash)),
-			HashF:            hashF},
+			HashF:            hashF,
+			eq:               eq},
 	}
 	vp.buckets = newChunkArr(vp.maxLogChunkSize, vp.maxLogChunkSize)
 	vp.buckets.set(0, &vp.firstRelay)
 	return &vp
 }
 
+// NewValUint32Bytes is NewValUint32 for []byte keys, the same as NewValPtrBytes.
+func NewValUint32Bytes[V ~uint32](minBucketSize, maxBucketSize byte, hashF func([]byte) uint) *ValUint32[[]byte, V] {
+	return NewValUint32Eq[[]byte, V](minBucketSize, maxBucketSize, math.MaxUint, hashF, bytes.Equal)
+}
+
+// NewValUint32FromSlice is NewValUint32 filled with vals[i] for keys[i] for all i, built the same way as NewValPtrFromSlice.
+func NewValUint32FromSlice[K comparable, V ~uint32](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, keys []K, vals []V) *ValUint32[K, V] {
+	vv := NewValUint32[K, V](minBucketSize, maxBucketSize, maxHash, hashF)
+	vv.build(vv.sortUnique(keys), func(hash uint, i int) *relay {
+		return &(&valNode[K, uint32]{relay: relay{hash: hash}, key: keys[i], val: uint32(vals[i])}).relay
+	})
+	return vv
+}
+
+// NewValUint32FromSeq is NewValUint32FromSlice of the pairs in seq.
+func NewValUint32FromSeq[K comparable, V ~uint32](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint, seq iter.Seq2[K, V]) *ValUint32[K, V] {
+	var keys []K
+	var vals []V
+	for k, v := range seq {
+		keys, vals = append(keys, k), append(vals, v)
+	}
+	return NewValUint32FromSlice(minBucketSize, maxBucketSize, maxHash, hashF, keys, vals)
+}
+
+// PoolNodes makes the map reuse the nodes of deleted keys the same way as ValPtr.PoolNodes.
+func (vv *ValUint32[K, V]) PoolNodes() {
+	vv.poolNodes(func(n unsafe.Pointer) {
+		*(*valNode[K, uint32])(n) = valNode[K, uint32]{}
+	})
+}
+
+// OnChange makes the map observable the same way as ValPtr.OnChange.
+func (vv *ValUint32[K, V]) OnChange(f func(Change[K, V])) {
+	vv.obs = &observers[K, V]{onChange: f, eq: vv.eq}
+	vv.locks = vv.obs.locks()
+}
+
+// Watch calls f after every write to key until cancel is called, the same way as ValPtr.Watch. Writes made through the pointer returned by LoadPtr are never observed.
+func (vv *ValUint32[K, V]) Watch(key K, f func(Change[K, V])) (cancel func()) {
+	if vv.obs == nil {
+		panic("Maps: Watch requires OnChange")
+	}
+	return vv.obs.watch(vv.HashF(key), key, f)
+}
+
+// changed queues the change of key for the observers, which had old when loaded and has new when stored. A value that isn't there is given as zero.
+func (vv *ValUint32[K, V]) changed(hash uint, key K, old V, loaded bool, new V, stored bool) {
+	if vv.obs != nil {
+		var c Change[K, V]
+		if c.Key, c.Loaded, c.Stored = key, loaded, stored; loaded {
+			c.Old = old
+		}
+		if stored {
+			c.New = new
+		}
+		vv.obs.queue(hash, c)
+	}
+}
+
+// node returns a node for key, which is a free one when there is.
+func (vv *ValUint32[K, V]) node(hash uint, key K, val uint32) *valNode[K, uint32] {
+	if vv.nodes != nil {
+		if n := (*valNode[K, uint32])(vv.nodes.get()); n != nil {
+			n.hash, n.key, n.val = hash, key, val
+			return vv.first(n)
+		}
+	}
+	return vv.first(&valNode[K, uint32]{relay: relay{hash: hash}, key: key, val: val})
+}
+
+// TrackWrites makes the map count its writes and keep its values as versions the same way as ValPtr.TrackWrites.
+func (vv *ValUint32[K, V]) TrackWrites() {
+	vv.trackVersions(func(n *relay) {
+		a := (*valNode[K, uint32])(unsafe.Pointer(n))
+		v := &version[uint32]{val: a.val, gone: a.state&dead != 0}
+		v.stamp.Store(1) //the first moment of the clock, which no snapshot precedes.
+		a.ver = unsafe.Pointer(v)
+	}, func(n *relay, moment uint64) bool {
+		return at[uint32](vv.writes, &(*valNode[K, uint32])(unsafe.Pointer(n)).ver, moment) != nil
+	})
+}
+
+// first makes the value of n, which isn't shared yet, its first version when writes are tracked. The version is stamped by linked once n is linked.
+func (vv *ValUint32[K, V]) first(n *valNode[K, uint32]) *valNode[K, uint32] {
+	if vv.writes != nil {
+		n.ver = unsafe.Pointer(&version[uint32]{val: n.val})
+	}
+	return n
+}
+
+// value loads the value of n, or returns false when n is deleted, which only its versions tell.
+func (vv *ValUint32[K, V]) value(n *valNode[K, uint32]) (uint32, bool) {
+	if vv.writes == nil {
+		return atomic.LoadUint32(&n.val), true
+	}
+	h := head[uint32](vv.writes, &n.ver)
+	return h.val, !h.gone
+}
+
+// rewrite replaces the value of n with f of it by a new version unless n is deleted, which is how an existing key is written when writes are tracked. It returns the replaced value and whether it's replaced.
+func (vv *ValUint32[K, V]) rewrite(n *valNode[K, uint32], f func(old uint32) uint32) (uint32, bool) {
+	for {
+		if h := head[uint32](vv.writes, &n.ver); h.gone {
+			return h.val, false
+		} else if replace(vv.writes, &n.ver, h, f(h.val), false) {
+			return h.val, true
+		}
+	}
+}
+
+// swap val into n unless n is deleted, returning the old value.
+func (vv *ValUint32[K, V]) swap(n *valNode[K, uint32], val uint32) (uint32, bool) {
+	if vv.writes != nil {
+		return vv.rewrite(n, func(uint32) uint32 { return val })
+	} else if !n.write(&vv.base) {
+		return val, false
+	}
+	defer n.done()
+	return atomic.SwapUint32(&n.val, val), true
+}
+
+// head returns the newest version of n, or nil when n is deleted or writes aren't tracked.
+func (vv *ValUint32[K, V]) head(n *valNode[K, uint32]) *version[uint32] {
+	if vv.writes != nil {
+		if h := head[uint32](vv.writes, &n.ver); !h.gone {
+			return h
+		}
+	}
+	return nil
+}
+
+// compareAndSwap replaces the value of n with new only when it's old. Returns NULL when n is deleted.
+func (vv *ValUint32[K, V]) compareAndSwap(n *valNode[K, uint32], old, new uint32) CASResult {
+	if vv.writes != nil {
+		for h := vv.head(n); h != nil; h = vv.head(n) {
+			if h.val != old {
+				return FAILED
+			} else if replace(vv.writes, &n.ver, h, new, false) {
+				return SUCCESS
+			}
+		}
+		return NULL
+	} else if !n.write(&vv.base) {
+		return NULL
+	}
+	a := atomic.CompareAndSwapUint32(&n.val, old, new)
+	n.done()
+	return *(*CASResult)(unsafe.Pointer(&a))
+}
+
+// yield the key and value of n unless n is deleted, returning false when yield does.
+func (vv *ValUint32[K, V]) yield(n *valNode[K, uint32], yield func(K, V) bool) bool {
+	x, ok := vv.value(n)
+	return !ok || yield(n.key, V(x))
+}
+
+// drop n once delete returns SUCCESS for it.
+func (vv *ValUint32[K, V]) drop(n *valNode[K, uint32]) {
+	if vv.writes != nil {
+		vv.unlink(&n.relay)
+	} else {
+		n.drop(&vv.base)
+	}
+}
+
+// delete makes n dead when its value is old, or whatever its value is when any is true, and returns the value and SUCCESS; n is then to be dropped by drop. When writes are tracked, n is deleted by a deleted version instead. The value and FAILED are returned when it isn't old, and NULL when n is dead already.
+func (vv *ValUint32[K, V]) delete(n *valNode[K, uint32], old uint32, any bool) (uint32, CASResult) {
+	for vv.writes != nil {
+		if h := head[uint32](vv.writes, &n.ver); h.gone {
+			return old, NULL
+		} else if !any && h.val != old {
+			return h.val, FAILED
+		} else if replace(vv.writes, &n.ver, h, h.val, true) {
+			return h.val, SUCCESS
+		}
+	}
+	for {
+		s, ok := n.idle(&vv.base)
+		if !ok {
+			return old, NULL
+		}
+		if v := atomic.LoadUint32(&n.val); any || v == old {
+			if n.kill(s) {
+				return v, SUCCESS
+			}
+		} else if n.unchanged(s) { //no write started since s, so key had v when it's loaded.
+			return v, FAILED
+		}
+	}
+}
+
 func (vv *ValUint32[K, V]) LoadAndDelete(key K) (v V, loaded bool) {
 	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
-			return 0, false
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*valNode[K, uint32])(curAddr).key == key {
-			if (*relay)(curAddr).mark() {
-				vv.size.Add(^uintptr(resizingMask<<1 - 1))
-				vv.tryMerge()
-				return V(atomic.LoadUint32(&(*valNode[K, uint32])(curAddr).val)), true
+			return v, false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if x, r := vv.delete((*valNode[K, uint32])(curAddr), 0, true); r == SUCCESS {
+				vv.drop((*valNode[K, uint32])(curAddr))
+				v = V(x)
+				vv.changed(hash, key, v, true, v, false)
+				return v, true
 			}
-			return 0, false
+			return v, false
 		}
 	}
 }
 func (vv *ValUint32[K, V]) Load(key K) (v V, loaded bool) {
 	hash := vv.HashF(key)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
-			return 0, false
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*valNode[K, uint32])(curAddr).key == key {
-			return V(atomic.LoadUint32(&(*valNode[K, uint32])(curAddr).val)), true
+			return v, false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if x, ok := vv.value((*valNode[K, uint32])(curAddr)); ok {
+				return V(x), true
+			}
 		}
 	}
 }
 
-// LoadPtr to the value of the given key; returns nil when key isn't present. All operations performed on the pointer should be atomic.
-// For example,
-//
-//	  p:=m.Load(0)
-//		 atomic.AddUintptr(p,1)
+// LoadPtr to the value of the given key; returns nil when key isn't present. All operations performed on the pointer should be atomic, and writes through it aren't tracked by TrackWrites, observed by OnChange, or seen by the deletes comparing the value, so CompareAndDelete and Compute may delete a value written through it after comparing the one before it. Add, And and Or are the atomic operations on the value that don't need it. When nodes are pooled by PoolNodes, the pointer may point into the node of another key once key is deleted, so it may only be used while key is known to be present. When writes are tracked, the pointer is to the version of the value, which the next write to key replaces, so neither sees the other.
 func (vv *ValUint32[K, V]) LoadPtr(key K) *V {
 	hash := vv.HashF(key)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return nil
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*valNode[K, uint32])(curAddr).key == key {
-			return (*V)(unsafe.Pointer(&(*valNode[K, uint32])(curAddr).val))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if vv.writes == nil {
+				return (*V)(unsafe.Pointer(&(*valNode[K, uint32])(curAddr).val))
+			} else if h := head[uint32](vv.writes, &(*valNode[K, uint32])(curAddr).ver); !h.gone {
+				return (*V)(unsafe.Pointer(&h.val))
+			}
 		}
 	}
 }
+
 func (vv *ValUint32[K, V]) Store(key K, val V) (added bool) {
 	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	var new *valNode[K, uint32]
 	fb, path := func() *relay {
 		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash)
-	}, evictStack{}
+	}, vv.path()
 	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
 		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
 			if new == nil {
-				new = &valNode[K, uint32]{relay{hash: hash}, key, uint32(val)}
+				new = vv.node(hash, key, uint32(val))
 			}
 			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
-				vv.size.Add(resizingMask << 1)
+				vv.linked(&new.ver)
+				vv.added(hash, &path)
 				vv.trySplit()
+				vv.changed(hash, key, val, false, val, true)
 				return true
 			}
-		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && (*valNode[K, uint32])(rightAddr).key == key {
-			atomic.StoreUint32(&(*valNode[K, uint32])(rightAddr).val, uint32(val))
-			return false
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vv.eq((*valNode[K, uint32])(rightAddr).key, key) {
+			if x, ok := vv.swap((*valNode[K, uint32])(rightAddr), uint32(val)); ok {
+				vv.changed(hash, key, V(x), true, val, true)
+				return false
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
 		} else {
 			path.Push(rightAddr)
 			left = (*relay)(rightAddr)
@@ -93,22 +328,221 @@ func (vv *ValUint32[K, V]) Store(key K, val V) (added bool) {
 }
 func (vv *ValUint32[K, V]) LoadOrStore(key K, val V) (v V, loaded bool) {
 	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	var new *valNode[K, uint32]
 	fb, path := func() *relay {
 		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash)
-	}, evictStack{}
+	}, vv.path()
 	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
 		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
 			if new == nil {
-				new = &valNode[K, uint32]{relay{hash: hash}, key, uint32(val)}
+				new = vv.node(hash, key, uint32(val))
+			}
+			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
+				vv.linked(&new.ver)
+				vv.added(hash, &path)
+				vv.trySplit()
+				vv.changed(hash, key, val, false, val, true)
+				return v, false
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vv.eq((*valNode[K, uint32])(rightAddr).key, key) {
+			if x, ok := vv.value((*valNode[K, uint32])(rightAddr)); ok {
+				return V(x), true
+			}
+			path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+			left = (*relay)(rightAddr)
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// Add delta to the value of key, or store delta when key isn't present, and return the new value and whether key was present. Unsigned values are subtracted by adding the two's complement, the same as atomic.AddUint64.
+func (vv *ValUint32[K, V]) Add(key K, delta V) (new V, loaded bool) {
+	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var node *valNode[K, uint32]
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash)
+	}, vv.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			if node == nil {
+				node = vv.node(hash, key, uint32(delta))
+			}
+			if node.next = right; left.tryLink(right, unsafe.Pointer(node)) {
+				vv.linked(&node.ver)
+				vv.added(hash, &path)
+				vv.trySplit()
+				vv.changed(hash, key, delta, false, delta, true)
+				return delta, false
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vv.eq((*valNode[K, uint32])(rightAddr).key, key) {
+			n := (*valNode[K, uint32])(rightAddr)
+			if vv.writes != nil {
+				if x, ok := vv.rewrite(n, func(x uint32) uint32 { return uint32(V(x) + delta) }); ok {
+					new = V(x) + delta
+					vv.changed(hash, key, V(x), true, new, true)
+					return new, true
+				}
+			}
+			if vv.writes != nil || !n.write(&vv.base) {
+				path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+				left = (*relay)(rightAddr)
+				continue
+			}
+			if vv.obs == nil {
+				new = V(atomic.AddUint32(&n.val, uint32(delta)))
+				n.done()
+				return new, true
+			}
+			old := V(atomic.LoadUint32(&n.val)) //writes to key are serialized when observed, so the value can't change before delta is added.
+			new = V(atomic.AddUint32(&n.val, uint32(delta)))
+			n.done()
+			vv.changed(hash, key, old, true, new, true)
+			return new, true
+		} else {
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
+		}
+	}
+}
+
+// And replaces the value of key with its bitwise AND with mask, and returns the old value and whether key is present. Nothing is stored when key isn't present.
+func (vv *ValUint32[K, V]) And(key K, mask V) (old V, loaded bool) {
+	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return old, false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if n := (*valNode[K, uint32])(curAddr); vv.writes != nil {
+				if x, ok := vv.rewrite(n, func(x uint32) uint32 { return x & uint32(mask) }); ok {
+					old = V(x)
+					vv.changed(hash, key, old, true, old&mask, true)
+					return old, true
+				}
+			} else if n.write(&vv.base) {
+				old = V(atomic.AndUint32(&n.val, uint32(mask)))
+				n.done()
+				vv.changed(hash, key, old, true, old&mask, true)
+				return old, true
+			}
+		}
+	}
+}
+
+// Or is And with bitwise OR.
+func (vv *ValUint32[K, V]) Or(key K, mask V) (old V, loaded bool) {
+	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return old, false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if n := (*valNode[K, uint32])(curAddr); vv.writes != nil {
+				if x, ok := vv.rewrite(n, func(x uint32) uint32 { return x | uint32(mask) }); ok {
+					old = V(x)
+					vv.changed(hash, key, old, true, old|mask, true)
+					return old, true
+				}
+			} else if n.write(&vv.base) {
+				old = V(atomic.OrUint32(&n.val, uint32(mask)))
+				n.done()
+				vv.changed(hash, key, old, true, old|mask, true)
+				return old, true
+			}
+		}
+	}
+}
+
+// Compute updates key with what f returns. f is called again when key is changed concurrently, so it should be free of side effects, and it's called without any lock held like ValPtr.Compute. Returns the value of key after the call and whether key is present.
+// All of KEEP, STORE and DELETE are atomic: STORE replaces the value by CAS from the one given to f, and DELETE deletes key only when its value is still the one given to f, the same way as CompareAndDelete.
+func (vv *ValUint32[K, V]) Compute(key K, f func(old V, loaded bool) (V, ComputeOp)) (V, bool) {
+	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	var new *valNode[K, uint32]
+	var zero V
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash)
+	}, vv.path()
+	for left, right := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).crawl(&path, fb); ; left, right = left.crawl(&path, fb) {
+		if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+			val, op := callCompute(&vv.base, hash, f, zero, false)
+			if op != STORE {
+				return zero, false
+			} else if new == nil {
+				new = vv.node(hash, key, uint32(val))
+			} else {
+				new.val = uint32(val)
+				vv.first(new)
 			}
 			if new.next = right; left.tryLink(right, unsafe.Pointer(new)) {
-				vv.size.Add(resizingMask << 1)
+				vv.linked(&new.ver)
+				vv.added(hash, &path)
 				vv.trySplit()
-				return 0, false
+				vv.changed(hash, key, zero, false, val, true)
+				return val, true
+			}
+		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vv.eq((*valNode[K, uint32])(rightAddr).key, key) {
+			n := (*valNode[K, uint32])(rightAddr)
+			for h := vv.head(n); h != nil; h = vv.head(n) {
+				val, op := callCompute(&vv.base, hash, f, V(h.val), true)
+				if op == KEEP {
+					return V(h.val), true
+				} else if !replace(vv.writes, &n.ver, h, uint32(val), op == DELETE) {
+					continue
+				} else if op == DELETE {
+					vv.unlink(&n.relay)
+					vv.changed(hash, key, V(h.val), true, zero, false)
+					return zero, false
+				}
+				vv.changed(hash, key, V(h.val), true, val, true)
+				return val, true
 			}
-		} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && (*valNode[K, uint32])(rightAddr).key == key {
-			return V(atomic.LoadUint32(&(*valNode[K, uint32])(rightAddr).val)), true
+			for old := atomic.LoadUint32(&n.val); vv.writes == nil; old = atomic.LoadUint32(&n.val) {
+				if val, op := callCompute(&vv.base, hash, f, V(old), true); op == KEEP {
+					return V(old), true
+				} else if op == STORE {
+					if !n.write(&vv.base) {
+						break //the node is deleted, the key may be added again after it.
+					}
+					swapped := atomic.CompareAndSwapUint32(&n.val, old, uint32(val))
+					if n.done(); swapped {
+						vv.changed(hash, key, V(old), true, val, true)
+						return val, true
+					}
+				} else if _, r := vv.delete(n, old, false); r == SUCCESS {
+					vv.drop(n)
+					vv.changed(hash, key, V(old), true, zero, false)
+					return zero, false
+				} else if r == NULL {
+					break
+				}
+			}
+			path.Push(rightAddr)
+			left = (*relay)(rightAddr)
 		} else {
 			path.Push(rightAddr)
 			left = (*relay)(rightAddr)
@@ -117,64 +551,360 @@ func (vv *ValUint32[K, V]) LoadOrStore(key K, val V) (v V, loaded bool) {
 }
 func (vv *ValUint32[K, V]) Swap(key K, val V) (old V, swapped bool) {
 	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
-			return 0, false
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*valNode[K, uint32])(curAddr).key == key {
-			return V(atomic.SwapUint32(&(*valNode[K, uint32])(curAddr).val, uint32(val))), true
+			return old, false
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if x, ok := vv.swap((*valNode[K, uint32])(curAddr), uint32(val)); ok {
+				old = V(x)
+				vv.changed(hash, key, old, true, val, true)
+				return old, true
+			}
 		}
 	}
 }
 func (vv *ValUint32[K, V]) CompareAndSwap(key K, old, new V) CASResult {
 	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
 	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
 			return NULL
-		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && (*valNode[K, uint32])(curAddr).key == key {
-			a := atomic.CompareAndSwapUint32(&(*valNode[K, uint32])(curAddr).val, uint32(old), uint32(new))
-			return *(*CASResult)(unsafe.Pointer(&a))
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if r := vv.compareAndSwap((*valNode[K, uint32])(curAddr), uint32(old), uint32(new)); r != NULL {
+				if r == SUCCESS {
+					vv.changed(hash, key, old, true, new, true)
+				}
+				return r
+			}
 		}
 	}
 }
 
-func (vv *ValUint32[K, V]) Take() (*K, V) {
-	cur := vv.firstRelay.walk()
-	for ; isRelay(cur); cur = (*relay)(addr(cur)).walk() {
+// CompareAndDelete deletes key only when its value equals old. The value is compared and the node is made dead by one CAS on its state, so a write to key can't land in between; it waits for the writes to key in progress to make the CAS.
+func (vv *ValUint32[K, V]) CompareAndDelete(key K, old V) CASResult {
+	hash := vv.HashF(key)
+	vv.begin(hash)
+	defer vv.end(hash)
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
 	}
-	if cur == nil {
-		return nil, 0
+	for cur, curAddr := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash).walk(), unsafe.Pointer(nil); ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil || hash < (*relay)(curAddr).hash {
+			return NULL
+		} else if (*relay)(curAddr).hash == hash && !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, key) {
+			if _, r := vv.delete((*valNode[K, uint32])(curAddr), uint32(old), false); r != SUCCESS {
+				return r
+			}
+			vv.drop((*valNode[K, uint32])(curAddr))
+			vv.changed(hash, key, old, true, old, false)
+			return SUCCESS
+		}
 	}
-	a := (*valNode[K, uint32])(cur)
-	return &a.key, V(atomic.LoadUint32(&a.val))
+}
+
+func (vv *ValUint32[K, V]) Take() (key *K, val V) {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
+	for cur := vv.firstRelay.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if !isRelay(cur) {
+			a := (*valNode[K, uint32])(cur)
+			if x, ok := vv.value(a); ok {
+				if key = &a.key; vv.nodes != nil { //the node may be reused once it's deleted.
+					k := *key
+					key = &k
+				}
+				return key, V(x)
+			}
+		}
+	}
+	return nil, val
 }
 func (vv *ValUint32[K, V]) Range(yield func(K, V) bool) {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
 	for cur, curAddr := vv.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); !isRelay(cur) {
-			if a := (*valNode[K, uint32])(curAddr); !yield(a.key, V(atomic.LoadUint32(&a.val))) {
+			if a := (*valNode[K, uint32])(curAddr); !vv.yield(a, yield) {
 				break
 			}
 		}
 	}
 }
+
+// RangeFrom is Range over the keys whose hash isn't smaller than hash, in the order of hash.
+func (vv *ValUint32[K, V]) RangeFrom(hash uint, yield func(K, V) bool) {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr := vv.seek(hash), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); !isRelay(cur) {
+			if a := (*valNode[K, uint32])(curAddr); !vv.yield(a, yield) {
+				break
+			}
+		}
+	}
+}
+
+// Scan is Range from where c is, in the order of hash. c is updated to the last key given to yield, so the next Scan with c starts after it. Scan isn't linearizable.
+func (vv *ValUint32[K, V]) Scan(c *Cursor, yield func(K, V) bool) {
+	if c.done {
+		return
+	}
+	if vv.nodes != nil {
+		defer vv.nodes.pin(c.hash % trackerStripes).Add(-1)
+	}
+	for cur, curAddr, seen := vv.seek(c.hash), (unsafe.Pointer)(nil), c.skip; ; cur = (*relay)(curAddr).walk() {
+		if curAddr = addr(cur); cur == nil {
+			c.done = true
+			return
+		} else if !isRelay(cur) {
+			if a := (*valNode[K, uint32])(curAddr); c.visit(a.hash, &seen) && !vv.yield(a, yield) {
+				break
+			}
+		}
+	}
+}
+
+// All returns an iterator over the key value pairs in the map. It's the same as Range, so it isn't linearizable either.
+func (vv *ValUint32[K, V]) All() iter.Seq2[K, V] {
+	return vv.Range
+}
+
+// Keys returns an iterator over the keys in the map.
+func (vv *ValUint32[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		vv.Range(func(k K, _ V) bool { return yield(k) })
+	}
+}
+
+// Values returns an iterator over the values in the map.
+func (vv *ValUint32[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		vv.Range(func(_ K, v V) bool { return yield(v) })
+	}
+}
+
+// Insert stores the key value pairs from seq, overwriting existing keys. It's the counterpart of maps.Insert.
+func (vv *ValUint32[K, V]) Insert(seq iter.Seq2[K, V]) {
+	for k, v := range seq {
+		vv.Store(k, v)
+	}
+}
+
+// StoreMany is Store of vals[i] to keys[i] for all i, reporting whether each key is added. Keys are sorted by hash first, so the list is traversed once instead of once per key. Equal keys are stored in the order they appear.
+func (vv *ValUint32[K, V]) StoreMany(keys []K, vals []V) []bool {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
+	order := vv.sortByHash(keys)
+	added := make([]bool, len(keys))
+	var hash uint
+	var left *relay
+	fb, path := func() *relay {
+		return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).Get(hash)
+	}, vv.path()
+	for _, o := range order {
+		i := o.i
+		hash, left = o.hash, vv.nearer(left, o.hash)
+		vv.begin(hash)
+		var new *valNode[K, uint32]
+		for l, right := left.crawl(&path, fb); ; l, right = l.crawl(&path, fb) {
+			if rightAddr := addr(right); right == nil || hash < (*relay)(rightAddr).hash {
+				if new == nil {
+					new = vv.node(hash, keys[i], uint32(vals[i]))
+				}
+				if new.next = right; l.tryLink(right, unsafe.Pointer(new)) {
+					vv.linked(&new.ver)
+					vv.added(hash, &path)
+					vv.trySplit()
+					vv.changed(hash, keys[i], vals[i], false, vals[i], true)
+					added[i], left = true, l
+					break
+				}
+			} else if (*relay)(rightAddr).hash == hash && !isRelay(right) && vv.eq((*valNode[K, uint32])(rightAddr).key, keys[i]) {
+				if x, ok := vv.swap((*valNode[K, uint32])(rightAddr), uint32(vals[i])); ok {
+					vv.changed(hash, keys[i], V(x), true, vals[i], true)
+					left = l //the next key may be equal, so it must start before this node.
+					break
+				}
+				path.Push(rightAddr) //the node is deleted, the key may be added again after it.
+				l = (*relay)(rightAddr)
+			} else {
+				path.Push(rightAddr)
+				l = (*relay)(rightAddr)
+			}
+		}
+		vv.end(hash)
+	}
+	return added
+}
+
+// LoadMany is Load of all keys, traversing the list once.
+func (vv *ValUint32[K, V]) LoadMany(keys []K) ([]V, []bool) {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
+	order := vv.sortByHash(keys)
+	vals, loaded := make([]V, len(keys)), make([]bool, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = vv.nearer(from, hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
+				break
+			} else if !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, keys[i]) {
+				if x, ok := vv.value((*valNode[K, uint32])(curAddr)); ok {
+					vals[i], loaded[i] = V(x), true
+					break
+				}
+			}
+		}
+	}
+	return vals, loaded
+}
+
+// DeleteMany is LoadAndDelete of all keys without loading, traversing the list once. Reports whether each key is deleted; only the first of equal keys can be.
+func (vv *ValUint32[K, V]) DeleteMany(keys []K) []bool {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
+	order := vv.sortByHash(keys)
+	deleted := make([]bool, len(keys))
+	var from *relay
+	for _, o := range order {
+		i, hash := o.i, o.hash
+		from = vv.nearer(from, hash)
+		vv.begin(hash)
+		for cur, curAddr := from.walk(), unsafe.Pointer(nil); cur != nil; cur = (*relay)(curAddr).walk() {
+			if curAddr = addr(cur); (*relay)(curAddr).hash < hash {
+				from = (*relay)(curAddr)
+			} else if hash < (*relay)(curAddr).hash {
+				break
+			} else if !isRelay(cur) && vv.eq((*valNode[K, uint32])(curAddr).key, keys[i]) {
+				if x, r := vv.delete((*valNode[K, uint32])(curAddr), 0, true); r == SUCCESS {
+					vv.drop((*valNode[K, uint32])(curAddr))
+					v := V(x)
+					vv.changed(hash, keys[i], v, true, v, false)
+					deleted[i] = true
+				}
+				break
+			}
+		}
+		vv.end(hash)
+	}
+	return deleted
+}
+
+// Clear deletes all keys the same way as ValPtr.Clear, which requires TrackWrites likewise.
+func (vv *ValUint32[K, V]) Clear() bool {
+	return vv.clear(func(n *relay) bool {
+		if !n.mark() {
+			return false
+		}
+		a := (*valNode[K, uint32])(unsafe.Pointer(n))
+		if x, ok := vv.value(a); ok {
+			v := V(x)
+			vv.changed(n.hash, a.key, v, true, v, false)
+		}
+		return true
+	})
+}
+
 func (vv *ValUint32[K, V]) Copy() *ValUint32[K, V] {
-	copied := ValUint32[K, V]{base[K]{MinAvgBucketSize: vv.MinAvgBucketSize, MaxAvgBucketSize: vv.MaxAvgBucketSize, maxLogChunkSize: vv.maxLogChunkSize, buckets: newChunkArr(vv.maxLogChunkSize, (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).logChunkSize), HashF: vv.HashF}}
-	tail := &copied.firstRelay
-	tailIndex := uint(0)
-	copied.buckets.set(tailIndex, tail)
+	return vv.copy(vv.value)
+}
+
+// copy the nodes whose value by val is present.
+func (vv *ValUint32[K, V]) copy(val func(n *valNode[K, uint32]) (uint32, bool)) *ValUint32[K, V] {
+	if vv.nodes != nil {
+		defer vv.nodes.pin(0).Add(-1)
+	}
+	copied := &ValUint32[K, V]{base: base[K]{MinAvgBucketSize: vv.MinAvgBucketSize, MaxAvgBucketSize: vv.MaxAvgBucketSize, maxLogChunkSize: vv.maxLogChunkSize, HashF: vv.HashF, eq: vv.eq}}
+	b := copied.builder((*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vv.buckets)))).logChunkSize)
 	for cur, curAddr := vv.firstRelay.walk(), (unsafe.Pointer)(nil); cur != nil; cur = (*relay)(curAddr).walk() {
 		if curAddr = addr(cur); !isRelay(cur) {
 			a := (*valNode[K, uint32])(curAddr)
-			if index := copied.buckets.Index(a.hash); index != tailIndex {
-				new := &relay{hash: index * (1 << copied.buckets.logChunkSize)}
-				tail.next = unsafe.Pointer(uintptr(unsafe.Pointer(new)) | relayMask)
-				tail = new
-				copied.buckets.set(index, new)
-				tailIndex = index
+			if x, ok := val(a); ok {
+				b.link(&(&valNode[K, uint32]{relay: relay{hash: a.hash}, key: a.key, val: x}).relay)
 			}
-			tail.next = unsafe.Pointer(&valNode[K, uint32]{relay{hash: a.hash}, a.key, atomic.LoadUint32(&(*valNode[K, uint32])(curAddr).val)})
-			tail = (*relay)(tail.next)
-			copied.size.Add(resizingMask << 1)
 		}
 	}
-	return &copied
+	b.done()
+	return copied
+}
+
+// Encode writes the keys and values in the map to w, converting keys to bytes by keys. Values are written in little-endian in their own size. Like Copy, Encode isn't linearizable. It returns the first error of w.
+func (vv *ValUint32[K, V]) Encode(w io.Writer, keys Codec[K]) error {
+	size := unsafe.Sizeof(uint32(0))
+	e := newEncoder(w, kindValUint32)
+	for k, v := range vv.Range {
+		e.entry()
+		encodeField(e, keys, k, 0)
+		if e.fixed(uint64(uint32(v)), size); e.err != nil {
+			break
+		}
+	}
+	return e.done()
+}
+
+// Decode replaces the contents of the map with what Encode of a ValUint32 wrote to r, the same way as ValPtr.Decode.
+func (vv *ValUint32[K, V]) Decode(r io.Reader, keys Codec[K]) error {
+	size := unsafe.Sizeof(uint32(0))
+	d, err := newDecoder(r, kindValUint32)
+	if err != nil {
+		return err
+	}
+	ks, vs, err := decodeEntries(d, keys, func(d *decoder) (V, error) {
+		x, err := d.fixed(size)
+		return V(uint32(x)), err
+	})
+	if err != nil {
+		return err
+	}
+	return vv.load(ks, func(hash uint, i int) *relay {
+		return &(&valNode[K, uint32]{relay: relay{hash: hash}, key: ks[i], val: uint32(vs[i])}).relay
+	})
+}
+
+// Snapshot copies the map at a single moment without blocking writes the same way as ValPtr.Snapshot, reporting false unless writes are tracked by TrackWrites. Writes through LoadPtr aren't versioned, so they may be seen by a snapshot taken before them.
+func (vv *ValUint32[K, V]) Snapshot() (ValUint32Snapshot[K, V], bool) {
+	var copied *ValUint32[K, V]
+	ok := vv.snapshot(func(moment uint64) {
+		copied = vv.copy(func(n *valNode[K, uint32]) (uint32, bool) {
+			if h := at[uint32](vv.writes, &n.ver, moment); h != nil {
+				return h.val, true
+			}
+			return 0, false
+		})
+	})
+	return ValUint32Snapshot[K, V]{copied}, ok
+}
+
+// ValUint32Snapshot is a read-only view of a ValUint32 taken by Snapshot. All of its methods are linearizable since it never changes.
+type ValUint32Snapshot[K any, V ~uint32] struct {
+	m *ValUint32[K, V]
+}
+
+func (s ValUint32Snapshot[K, V]) Load(key K) (V, bool) {
+	return s.m.Load(key)
+}
+func (s ValUint32Snapshot[K, V]) Range(yield func(K, V) bool) {
+	s.m.Range(yield)
+}
+func (s ValUint32Snapshot[K, V]) Size() uint {
+	return s.m.Size()
 }
@@ -0,0 +1,1040 @@
+// Code generated by go generate; DO NOT EDIT.
+// Generated specializations of ValVal maps that exhausts atomicXXX functions based on ValUintptr.go and ValUintptr_test.go.
+package Maps
+
+import (
+	"maps"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testVUintT uint
+
+func TestValUint_LoadOrStore2(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testVUintT(testThrdsN) {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.LoadOrStore(testVPT(j), j)
+				if a, b := mq.LoadOrStore(testVPT(j), j); !b || a != j {
+					t.Fail()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVUintT(testThrdsN * testAddNEach) {
+		av, l := mq.LoadOrStore(testVPT(i), i)
+		if !l || av != i {
+			t.Fail()
+		}
+	}
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+}
+func TestValUint_LoadOrStore3(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	counts := make([]atomic.Uint32, testThrdsN*testAddNEach)
+	for range testThrdsN {
+		go func() {
+			for i := range testVUintT(testThrdsN * testAddNEach) {
+				if _, b := mq.LoadOrStore(testVPT(i), i); !b {
+					counts[i].Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range counts {
+		if counts[i].Load() != 1 {
+			t.Fail()
+		}
+	}
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+}
+func TestValUint_LoadOrStore1(t *testing.T) {
+	std := make(map[testVPT]testVUintT, testAddN/2)
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVUintT(rand.Intn(testAddN)) {
+		k := testVPT(i)
+		if _, a := mq.LoadOrStore(k, i); a {
+			t.Fail()
+		}
+		if mq.Size() != uint(i)+1 {
+			t.Fail()
+		}
+		std[k] = i
+	}
+	for k, ev := range std {
+		av, b := mq.LoadOrStore(k, 0)
+		if !b || av != ev {
+			t.Fatal(av, ev)
+		}
+	}
+	if mq.Size() != uint(len(std)) {
+		t.Fail()
+	}
+}
+func TestValUint_Load_Store1(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVUintT(testAddN) {
+		if !mq.Store(testVPT(i), i) {
+			t.Fail()
+		}
+		if mq.Size() != uint(i)+1 {
+			t.Fail()
+		}
+	}
+	for k := range testVUintT(testAddN) {
+		if a, b := mq.Load(testVPT(k)); a != k || !b {
+			t.Fail()
+		}
+	}
+}
+func TestValUint_Load_Store2(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				if !mq.Store(testVPT(j), testVUintT(j)) {
+					t.Fail()
+				}
+				if a, b := mq.Load(testVPT(j)); !b || a != testVUintT(j) {
+					t.Fail()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testThrdsN*testAddNEach {
+		t.Fail()
+	}
+	for i := range testVUintT(testThrdsN * testAddNEach) {
+		if a, b := mq.Load(testVPT(i)); a != i || !b {
+			t.Fail()
+		}
+	}
+}
+func TestValUint_Load_Store_Delete(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.Store(testVPT(j), testVUintT(j))
+				if a, b := mq.Load(testVPT(j)); a != testVUintT(j) || !b {
+					t.Error("didn't store", j, a)
+				}
+				mq.LoadAndDelete(testVPT(j))
+				if _, b := mq.Load(testVPT(j)); b {
+					t.Error("didn't delete", j)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != 0 {
+		t.Fail()
+	}
+}
+func TestValUint_Clear(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if mq.Store(1, 1); mq.Clear() || mq.Size() != 1 {
+		t.Fatal("cleared without tracking writes")
+	}
+	mq.TrackWrites()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.Store(testVPT(j), testVUintT(j))
+				if a, b := mq.Load(testVPT(j)); b && a != testVUintT(j) {
+					t.Error("wrong value", j, a)
+				}
+				if j%(testAddNEach/4) == 0 {
+					mq.Clear()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	n := uint(0)
+	for k, v := range mq.Range {
+		if testVUintT(k) != v {
+			t.Fatal("wrong value", k, v)
+		}
+		n++
+	}
+	if n != mq.Size() {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+	if !mq.Clear() || mq.Size() != 0 || mq.Stats().Keys != 0 {
+		t.Fatal("not cleared", mq.Size())
+	}
+}
+func TestValUint_FromSlice(t *testing.T) {
+	keys, vals := make([]testVPT, testAddN), make([]testVUintT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(i%(testAddN/4)), testVUintT(i) //every key repeats 4 times; the last is kept.
+	}
+	mq := NewValUintFromSlice(testMinBSz, testMaxBSz, testMaxHash, testHashF, keys, vals)
+	if mq.Size() != testAddN/4 {
+		t.Fatal("wrong size", mq.Size())
+	}
+	for k, v := range mq.Range {
+		if v != testVUintT(k)+testAddN*3/4 {
+			t.Fatal("wrong value", k, v)
+		}
+	}
+	for i := range testVPT(testAddN) { //the buckets of the upper 3/4 are empty, but they must still have their relays.
+		if mq.Store(i, 0) != (i >= testAddN/4) {
+			t.Fatal("wrong store", i)
+		}
+	}
+	if fromSeq := NewValUintFromSeq(testMinBSz, testMaxBSz, testMaxHash, testHashF, mq.Range); fromSeq.Size() != testAddN {
+		t.Fatal("wrong size from seq", fromSeq.Size())
+	}
+}
+
+func TestValUint_Add(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	var inserted atomic.Int64
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for k := range testVPT(testAddNEach) {
+				if _, loaded := mq.Add(k, 1); !loaded {
+					inserted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted.Load() != testAddNEach || mq.Size() != testAddNEach {
+		t.Fatal("wrong number of keys added", inserted.Load(), mq.Size())
+	}
+	for k, v := range mq.Range {
+		if v != testThrdsN {
+			t.Fatal("wrong count", k, v)
+		}
+	}
+	if v, loaded := mq.Add(0, 2); v != testThrdsN+2 || !loaded {
+		t.Fatal("wrong add", v, loaded)
+	}
+}
+
+func TestValUint_And_Or(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	if _, loaded := mq.Or(0, 1); loaded || mq.Size() != 0 {
+		t.Fatal("stored by Or")
+	}
+	mq.Store(0, 0)
+	for _, set := range []bool{true, false} { //every goroutine sets its own bit, then clears it.
+		wg := sync.WaitGroup{}
+		wg.Add(testThrdsN)
+		for i := range testThrdsN {
+			go func() {
+				defer wg.Done()
+				if set {
+					if old, loaded := mq.Or(0, 1<<i); !loaded || old&(1<<i) != 0 {
+						t.Error("wrong Or", i, old)
+					}
+				} else if old, loaded := mq.And(0, ^testVUintT(1<<i)); !loaded || old&(1<<i) == 0 {
+					t.Error("wrong And", i, old)
+				}
+			}()
+		}
+		wg.Wait()
+		if v, _ := mq.Load(0); set && v != 1<<testThrdsN-1 || !set && v != 0 {
+			t.Fatal("wrong bits", v)
+		}
+	}
+}
+
+func TestValUint_LoadAndDelete1(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	for i := range testVUintT(testAddN) {
+		if a, b := mq.LoadAndDelete(testVPT(i)); a != i || !b {
+			t.Fatal("wrong delete", a, i)
+		}
+		if _, b := mq.LoadAndDelete(testVPT(i)); b {
+			t.Fatal("can't delete")
+		}
+		if mq.Size() != uint(testAddN-i)-1 {
+			t.Fail()
+		}
+	}
+}
+func TestValUint_LoadPtrAndDelete2(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testThrdsN * testAddNEach {
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				if a, b := mq.LoadAndDelete(testVPT(j)); a != testVUintT(j) || !b {
+					t.Error("wrong delete", a, j)
+				}
+				if _, b := mq.LoadAndDelete(testVPT(j)); b {
+					t.Error("can't delete")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+func TestValUint_LoadPtrAndDelete3(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testThrdsN * testAddNEach {
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	count := make([]atomic.Uint32, testThrdsN*testAddNEach)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(testThrdsN * testAddNEach) {
+				if _, a := mq.LoadAndDelete(i); a {
+					count[i].Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range count {
+		if count[i].Load() != 1 {
+			t.Fail()
+		}
+	}
+	if mq.Size() != 0 {
+		t.Fail()
+	}
+}
+func TestValUint_Swap(t *testing.T) {
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	if _, b := vp.Swap(0, 0); b {
+		t.Fail()
+	}
+	v1, v2 := testVUintT(0), testVUintT(1)
+	vp.Store(0, v1)
+	if a, b := vp.Swap(0, v2); !b || a != v1 {
+		t.Fail()
+	}
+	if a, b := vp.Load(0); !b || a != v2 {
+		t.Fail()
+	}
+}
+func TestValUint_LoadOrStore_Delete(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				mq.LoadOrStore(testVPT(j), testVUintT(j))
+				if a, b := mq.LoadOrStore(testVPT(j), testVUintT(j)); !b || a != testVUintT(j) {
+					t.Error("can't store", j)
+				}
+				if a, b := mq.LoadAndDelete(testVPT(j)); a != testVUintT(j) || !b {
+					t.Error("wrong delete", a, j)
+				}
+				if _, b := mq.LoadAndDelete(testVPT(j)); b {
+					t.Error("can't delete")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValUint_CompareAndSwap(t *testing.T) {
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.CompareAndSwap(0, 0, 0) != NULL {
+		t.Fail()
+	}
+	vp.Store(0, 0)
+	results := make([]bool, 4)
+	for range rand.Intn(testAddN) {
+		wg := sync.WaitGroup{}
+		wg.Add(4)
+		go func() {
+			if a := vp.CompareAndSwap(0, 0, 1); a == NULL {
+				t.Fail()
+			} else {
+				results[0] = a == SUCCESS
+			}
+			wg.Done()
+		}()
+		go func() {
+			if a := vp.CompareAndSwap(0, 0, 4); a == NULL {
+				t.Fail()
+			} else {
+				results[3] = a == SUCCESS
+			}
+			wg.Done()
+		}()
+		go func() {
+			if a := vp.CompareAndSwap(0, 1, 2); a == NULL {
+				t.Fail()
+			} else {
+				results[1] = a == SUCCESS
+			}
+			wg.Done()
+		}()
+		go func() {
+			if a := vp.CompareAndSwap(0, 1, 3); a == NULL {
+				t.Fail()
+			} else {
+				results[2] = a == SUCCESS
+			}
+			wg.Done()
+		}()
+		wg.Wait()
+		vp.Store(0, 0)
+		if results[1] && results[2] {
+			t.Fatal("1 2 are exclusive")
+		}
+		if (results[1] || results[2]) && !results[0] {
+			t.Fatal("1 2 depends on 0")
+		}
+		if results[0] == results[3] {
+			t.Fatal("0 3 are exclusive")
+		}
+	}
+}
+func TestValUint_CompareAndDelete(t *testing.T) {
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.CompareAndDelete(0, 0) != NULL {
+		t.Fail()
+	}
+	vp.Store(0, 0)
+	if vp.CompareAndDelete(0, 1) != FAILED {
+		t.Fail()
+	}
+	results := make([]CASResult, 2)
+	for range rand.Intn(testAddN) {
+		vp.Store(0, 0)
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			results[0] = vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			results[1] = vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			vp.LoadOrStore(0, 1)
+			wg.Done()
+		}()
+		wg.Wait()
+		if (results[0] == SUCCESS) == (results[1] == SUCCESS) {
+			t.Fatal("exactly 1 of 0 and 1 should SUCCESS", results)
+		}
+	}
+}
+func TestValUint_CompareAndDelete_Lease(t *testing.T) { //each key is a lease; only the holder of the token may release it.
+	const keys = 16
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	holders := make([]atomic.Int32, keys)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testVUintT(testThrdsN) {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j*int(i+1)) % keys
+				if _, loaded := vp.LoadOrStore(k, i); loaded {
+					if vp.CompareAndDelete(k, i) == SUCCESS {
+						t.Error("released a lease held by another.")
+					}
+					continue
+				}
+				if holders[k].Add(1) != 1 {
+					t.Error("lease held by more than 1.")
+				}
+				holders[k].Add(-1)
+				if a := vp.CompareAndDelete(k, i); a != SUCCESS {
+					t.Error("failed to release own lease:", a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if vp.Size() != 0 {
+		t.Fatal("leases left:", vp.Size())
+	}
+	vp.Range(func(testVPT, testVUintT) bool {
+		t.Fatal("range found released lease.")
+		return false
+	})
+}
+func TestValUint_CompareAndDelete_Store(t *testing.T) { //a Store racing CompareAndDelete is never deleted with the old value.
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	for range testAddN {
+		vp.Store(0, 0)
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			vp.CompareAndDelete(0, 0)
+			wg.Done()
+		}()
+		go func() {
+			vp.Store(0, 1)
+			wg.Done()
+		}()
+		wg.Wait()
+		if v, ok := vp.Load(0); !ok || v != 1 {
+			t.Fatal("lost the store", v, ok)
+		}
+	}
+}
+func TestValUint_Compute(t *testing.T) {
+	const keys = 16
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	if _, ok := vp.Compute(0, func(testVUintT, bool) (testVUintT, ComputeOp) { return 0, DELETE }); ok || vp.Size() != 0 {
+		t.Fatal("DELETE on absent key.")
+	}
+	if _, ok := vp.Compute(0, func(testVUintT, bool) (testVUintT, ComputeOp) { return 1, KEEP }); ok || vp.Size() != 0 {
+		t.Fatal("KEEP on absent key.")
+	}
+	incr := func(old testVUintT, loaded bool) (testVUintT, ComputeOp) {
+		if loaded {
+			return old + 1, STORE
+		}
+		return 1, STORE
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for j := range testAddNEach {
+				vp.Compute(testVPT(j%keys), incr)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for i := range testVPT(keys) {
+		if v, ok := vp.Load(i); !ok || v != testThrdsN*testAddNEach/keys {
+			t.Fatal("lost update on", i)
+		}
+	}
+	evicted := atomic.Int32{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for i := range testVPT(keys) {
+				if _, ok := vp.Compute(i, func(old testVUintT, loaded bool) (testVUintT, ComputeOp) {
+					if loaded && old == testThrdsN*testAddNEach/keys {
+						return 0, DELETE
+					}
+					return old, KEEP
+				}); !ok {
+					evicted.Add(1)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if evicted.Load() != keys*testThrdsN || vp.Size() != 0 {
+		t.Fatal("conditional eviction failed.", evicted.Load(), vp.Size())
+	}
+}
+func TestValUint_Take(t *testing.T) {
+	vp := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	if kp, _ := vp.Take(); kp != nil {
+		t.Fail()
+	}
+	a := testVUintT(15)
+	vp.Store(15, a)
+	if kp, v := vp.Take(); v != a || *kp != 15 {
+		t.Fail()
+	}
+	b := testVUintT(0)
+	vp.Store(0, b)
+	if kp, v := vp.Take(); v != b || *kp != 0 {
+		t.Fail()
+	}
+}
+func TestValUint_Range(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	count := 0
+	for k, v := range mq.Range {
+		if k != testVPT(count) {
+			t.Fail()
+		}
+		if v != testVUintT(count) {
+			t.Fail()
+		}
+		count++
+	}
+}
+func TestValUint_All_Keys_Values(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	m := make(map[testVPT]testVUintT, testAddN)
+	for i := range testAddN {
+		m[testVPT(i)] = testVUintT(i)
+	}
+	mq.Insert(maps.All(m))
+	if !maps.Equal(m, maps.Collect(mq.All())) {
+		t.Fatal("All doesn't match inserted.")
+	}
+	keys, values := slices.Collect(mq.Keys()), slices.Collect(mq.Values())
+	if len(keys) != testAddN || len(values) != testAddN {
+		t.Fatal("size mismatch.", len(keys), len(values))
+	}
+	for i := range testAddN {
+		if keys[i] != testVPT(i) || values[i] != testVUintT(i) {
+			t.Fatal("wrong order at", i)
+		}
+	}
+	for k := range mq.Keys() {
+		if k == 10 {
+			break
+		}
+	}
+}
+func TestValUint_RangeFrom(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testAddN {
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	from := testVPT(rand.Intn(testAddN))
+	next := from
+	mq.RangeFrom(uint(from), func(k testVPT, v testVUintT) bool {
+		if k != next || v != testVUintT(k) {
+			t.Fatal("expected", next, "got", k)
+		}
+		next++
+		return true
+	})
+	if next != testAddN {
+		t.Fatal("stopped at", next)
+	}
+}
+func TestValUint_Scan(t *testing.T) {
+	const pageSize = 7
+	collide := func(a testVPT) uint { return uint(a) >> 2 } //every 4 keys share a hash.
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testAddN>>2, collide)
+	for i := 0; i < testAddN; i += 2 { //even keys stay, odd keys are added and deleted during the scan.
+		mq.Store(testVPT(i), testVUintT(i))
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for range testThrdsN {
+		go func() {
+			for !stop.Load() {
+				for i := 1; i < testAddN; i += 2 {
+					mq.Store(testVPT(i), testVUintT(i))
+				}
+				for i := 1; i < testAddN; i += 2 {
+					mq.LoadAndDelete(testVPT(i))
+				}
+			}
+			wg.Done()
+		}()
+	}
+	visited := make([]byte, testAddN)
+	var c Cursor
+	for lastHash := uint(0); !c.Done(); {
+		n := 0
+		mq.Scan(&c, func(k testVPT, v testVUintT) bool {
+			if collide(k) < lastHash || v != testVUintT(k) {
+				t.Fatal("hash isn't ordered.")
+			}
+			lastHash = collide(k)
+			visited[k]++
+			n++
+			return n < pageSize
+		})
+	}
+	stop.Store(true)
+	wg.Wait()
+	for i, v := range visited {
+		if i&1 == 0 && v != 1 { //odd keys sharing the hash of the last visited key can be repeated.
+			t.Fatal(i, "is visited", v, "times.")
+		}
+	}
+}
+func TestValUint_Copy(t *testing.T) {
+	vp0 := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for range rand.Intn(testAddN) {
+		vp0.Store(testVPT(rand.Uint32()%testMaxHash), testVUintT(rand.Intn(testAddN)))
+	}
+	vp1 := vp0.Copy()
+	if vp0.Size() != vp1.Size() {
+		t.Fail()
+	}
+	for k, v := range vp0.Range {
+		if a, _ := vp1.Load(k); a != v {
+			t.Fail()
+		}
+	}
+	for k, v := range vp1.Range {
+		if a, _ := vp0.Load(k); a != v {
+			t.Fail()
+		}
+	}
+}
+func TestValUint_Snapshot(t *testing.T) { //each writer stores the same step to x then y, so any linearizable view has y<=x<=y+1. a copy that isn't linearizable can see the new y with the old x.
+	const writers, gap = 4, 1 << 8 //keys between x and y make the window larger.
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, gap+writers-1, testHashF)
+	mq.TrackWrites()
+	for i := range testVPT(gap + writers) {
+		mq.Store(i, 0)
+	}
+	stop := atomic.Bool{}
+	wg := sync.WaitGroup{}
+	wg.Add(writers)
+	for w := range testVPT(writers) {
+		go func() {
+			for step := testVUintT(1); !stop.Load(); step++ {
+				mq.Store(w, step)
+				mq.Store(gap+w, step)
+				if step&7 == 0 {
+					time.Sleep(time.Microsecond)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	check := func(s ValUintSnapshot[testVPT, testVUintT], ok bool) {
+		if !ok {
+			t.Fatal("Snapshot of a tracked map failed.")
+		}
+		if s.Size() != gap+writers {
+			t.Fatal("wrong size", s.Size())
+		}
+		for w := range testVPT(writers) {
+			x, _ := s.Load(w)
+			if y, _ := s.Load(gap + w); x != y && x != y+1 {
+				t.Fatal("inconsistent snapshot", x, y)
+			}
+		}
+		n := uint(0)
+		s.Range(func(testVPT, testVUintT) bool {
+			n++
+			return true
+		})
+		if n != s.Size() {
+			t.Fatal("Range doesn't match Size.")
+		}
+	}
+	for range testAddNEach {
+		check(mq.Snapshot())
+	}
+	stop.Store(true)
+	wg.Wait()
+	s, ok := mq.Snapshot()
+	check(s, ok)
+	mq.LoadAndDelete(0)
+	if _, ok := s.Load(0); !ok || s.Size() != gap+writers {
+		t.Fatal("snapshot changed by later writes.")
+	}
+	if _, ok := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 0, testHashF).Snapshot(); ok {
+		t.Fatal("Snapshot of a map whose writes aren't tracked succeeded.")
+	}
+}
+func TestValUint_Size_Tracked(t *testing.T) { //Size of a map near empty mustn't underflow when writes are tracked.
+	const keys = 1
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, keys-1, testHashF)
+	mq.TrackWrites()
+	running := atomic.Int32{}
+	running.Store(testThrdsN)
+	for i := range testVUintT(testThrdsN) {
+		go func() {
+			for j := range testAddN {
+				if k := testVPT(j % keys); j&1 == 0 {
+					mq.Store(k, i)
+				} else {
+					mq.LoadAndDelete(k)
+				}
+			}
+			running.Add(-1)
+		}()
+	}
+	for running.Load() != 0 {
+		if s := mq.Size(); s > keys+testThrdsN { //a size read while writing can be off by the number of writers.
+			t.Fatal("wrong size", s)
+		}
+	}
+	n := uint(0)
+	for range mq.Keys() {
+		n++
+	}
+	if mq.Size() != n {
+		t.Fatal("size is", mq.Size(), "instead of", n)
+	}
+}
+func TestValUint_StoreMany_LoadMany_DeleteMany(t *testing.T) {
+	collided := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 0, func(testVPT) uint { return 0 })
+	for i := range testVPT(3) {
+		collided.Store(i, 1)
+	}
+	if added := collided.StoreMany([]testVPT{2, 0}, []testVUintT{1, 1}); added[0] || added[1] || collided.Size() != 3 { //0 is before 2 in the list, so it mustn't be searched from 2.
+		t.Fatal("equal hashes are added again.", added)
+	}
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	keys, vals := make([]testVPT, testAddN), make([]testVUintT, testAddN)
+	for i := range keys {
+		keys[i], vals[i] = testVPT(rand.Intn(testAddN>>1)), testVUintT(i) //about half are duplicates.
+	}
+	added, want := mq.StoreMany(keys, vals), make(map[testVPT]testVUintT)
+	for i, k := range keys {
+		if _, ok := want[k]; ok == added[i] {
+			t.Fatal("wrong added for", k)
+		}
+		want[k] = vals[i]
+	}
+	if mq.Size() != uint(len(want)) {
+		t.Fatal("wrong size", mq.Size(), len(want))
+	}
+	loadedVals, loaded := mq.LoadMany(append(keys, testAddN))
+	for i, v := range loadedVals[:len(keys)] {
+		if !loaded[i] || v != want[keys[i]] {
+			t.Fatal("wrong value for", keys[i])
+		}
+	}
+	if loaded[len(keys)] {
+		t.Fatal("loaded absent key.")
+	}
+	deleted, seen := mq.DeleteMany(keys), make(map[testVPT]bool)
+	for i, k := range keys {
+		if deleted[i] == seen[k] {
+			t.Fatal("wrong deleted for", k)
+		}
+		seen[k] = true
+	}
+	if mq.Size() != 0 {
+		t.Fatal("keys left", mq.Size())
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			keys, vals := make([]testVPT, testAddNEach), make([]testVUintT, testAddNEach)
+			for j := range keys {
+				keys[j] = testVPT(i + j*testThrdsN)
+				vals[j] = testVUintT(keys[j])
+			}
+			rand.Shuffle(len(keys), func(a, b int) {
+				keys[a], keys[b] = keys[b], keys[a]
+				vals[a], vals[b] = vals[b], vals[a]
+			})
+			for _, a := range mq.StoreMany(keys, vals) {
+				if !a {
+					t.Error("key isn't added.")
+				}
+			}
+			loadedVals, loaded := mq.LoadMany(keys)
+			for j, v := range loadedVals {
+				if !loaded[j] || v != vals[j] {
+					t.Error("wrong value.")
+				}
+			}
+			for _, d := range mq.DeleteMany(keys[:testAddNEach/2]) {
+				if !d {
+					t.Error("key isn't deleted.")
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if mq.Size() != testThrdsN*testAddNEach/2 {
+		t.Fatal("wrong size", mq.Size())
+	}
+}
+func TestValUint_LoadPtr(t *testing.T) {
+	vu := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, 16, testHashF)
+	if vu.LoadPtr(0) != nil {
+		t.Fail()
+	}
+	vu.Store(0, 0)
+	*vu.LoadPtr(0)++
+	if *vu.LoadPtr(0) != 1 {
+		t.Fail()
+	}
+}
+
+func TestValUint_PoolNodes(t *testing.T) {
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.PoolNodes()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	var done atomic.Bool
+	ranged := make(chan struct{})
+	go func() { //a reused node must never be seen with the key of its last use and the value of the next.
+		for !done.Load() {
+			for k, v := range mq.Range {
+				if testVPT(v) != k {
+					t.Error("wrong value", k, v)
+				}
+			}
+		}
+		close(ranged)
+	}()
+	for i := range testVUintT(testThrdsN) {
+		go func() {
+			defer wg.Done()
+			for range 4 {
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					if !mq.Store(testVPT(j), j) {
+						t.Error("not added", j)
+						return
+					}
+					if v, ok := mq.LoadAndDelete(testVPT(j)); !ok || v != j {
+						t.Error("wrong value", j, v)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	<-ranged
+	if s := mq.Stats(); s.Reused == 0 || s.Keys != 0 || mq.Size() != 0 {
+		t.Fatal("nodes aren't reused", s.Reused, s.Keys, mq.Size())
+	}
+}
+
+func TestValUint_OnChange(t *testing.T) {
+	type change = Change[testVPT, testVUintT]
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites() //Clear requires it.
+	var got, watched []change
+	mq.OnChange(func(c change) { got = append(got, c) })
+	cancel := mq.Watch(1, func(c change) { watched = append(watched, c) })
+	mq.Store(1, 1)
+	mq.Store(2, 2)
+	mq.Swap(1, 3)
+	mq.CompareAndSwap(1, 1, 4) //fails, so it isn't a change.
+	mq.LoadOrStore(1, 4)
+	mq.LoadAndDelete(1)
+	cancel()
+	mq.Store(1, 5)
+	mq.Clear()
+	want := []change{
+		{Key: 1, New: 1, Stored: true},
+		{Key: 2, New: 2, Stored: true},
+		{Key: 1, Old: 1, New: 3, Loaded: true, Stored: true},
+		{Key: 1, Old: 3, Loaded: true},
+		{Key: 1, New: 5, Stored: true},
+		{Key: 1, Old: 5, Loaded: true},
+		{Key: 2, Old: 2, Loaded: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("wrong changes", got)
+	}
+	if want = slices.DeleteFunc(want[:4], func(c change) bool { return c.Key != 1 }); !slices.Equal(watched, want) {
+		t.Fatal("wrong watched changes", watched)
+	}
+}
+func TestValUint_OnChange_Compute(t *testing.T) { //f of Compute is called without the lock of the stripe, so it may write to the same stripe.
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Store(trackerStripes, 0) //f only overwrites it, so f isn't called again for a node linked next to key.
+	var got []testVPT
+	mq.OnChange(func(c Change[testVPT, testVUintT]) { got = append(got, c.Key) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, loaded := range []bool{false, true} {
+			mq.Compute(0, func(old testVUintT, ok bool) (testVUintT, ComputeOp) {
+				if ok != loaded {
+					t.Error("wrong loaded", ok)
+				}
+				mq.Store(trackerStripes, old+1)
+				return old + 1, STORE
+			})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("Compute blocks f from writing to its stripe")
+	}
+	if v, _ := mq.Load(0); v != 2 || !slices.Equal(got, []testVPT{trackerStripes, 0, trackerStripes, 0}) {
+		t.Fatal("wrong changes", v, got)
+	}
+}
+func TestValUint_Watch_Order(t *testing.T) { //every change of a key must start from where the previous one ended.
+	const keys = 4
+	mq := NewValUint[testVPT, testVUintT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.OnChange(nil)
+	changes := make([][]Change[testVPT, testVUintT], keys)
+	for k := range testVPT(keys) {
+		mq.Watch(k, func(c Change[testVPT, testVUintT]) {
+			runtime.Gosched() //let other writers race with the delivery.
+			changes[k] = append(changes[k], c)
+		})
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j % keys)
+				switch (i + j) % 3 {
+				case 0:
+					mq.Add(k, 1)
+				case 1:
+					mq.Swap(k, testVUintT(j))
+				default:
+					mq.LoadAndDelete(k)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for k, cs := range changes {
+		for i := 1; i < len(cs); i++ {
+			if cs[i].Loaded != cs[i-1].Stored || cs[i].Old != cs[i-1].New {
+				t.Fatal("changes out of order", k, i, cs[i-1], cs[i])
+			}
+		}
+		if v, ok := mq.Load(testVPT(k)); cs[len(cs)-1].Stored != ok || cs[len(cs)-1].New != v {
+			t.Fatal("last change isn't the value", k, cs[len(cs)-1])
+		}
+	}
+}
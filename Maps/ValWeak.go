@@ -0,0 +1,93 @@
+package Maps
+
+import (
+	"weak"
+)
+
+// ValWeak is a ValPtr that holds its values by weak pointers, so the GC reclaims a value once nothing else refers to it, which suits caching large objects that are also kept elsewhere while in use. A collected value is treated as absent, and its key is deleted by the first call that finds it, or by Sweep, which unlinks the node like Delete. Deleting a collected key only succeeds when it isn't stored again meanwhile.
+// Values should be allocated by themselves; a value that shares its allocation with others, such as a small value without pointers or an element of a slice, is only collected with all of them.
+type ValWeak[K comparable, V any] struct {
+	m *ValPtr[K, weak.Pointer[V]] //a weak.Pointer is never modified once stored, so replacing it by pointer tells whether the key is stored again.
+}
+
+// NewValWeak is the constructor for ValWeak. The parameters are the same as NewValPtr.
+func NewValWeak[K comparable, V any](minBucketSize, maxBucketSize byte, maxHash uint, hashF func(K) uint) *ValWeak[K, V] {
+	return &ValWeak[K, V]{NewValPtr[K, weak.Pointer[V]](minBucketSize, maxBucketSize, maxHash, hashF)}
+}
+
+// live returns the value of key when it's present and not collected. A collected value is deleted.
+func (w *ValWeak[K, V]) live(key K) *V {
+	if p := w.m.LoadPtr(key); p != nil {
+		if v := p.Value(); v != nil {
+			return v
+		}
+		w.m.ComparePtrAndDelete(key, p)
+	}
+	return nil
+}
+
+// Load the value of key. Returns nil when key is absent or its value is collected.
+func (w *ValWeak[K, V]) Load(key K) *V {
+	return w.live(key)
+}
+
+// Store val to key. Returns whether key is added, which includes replacing a collected value. Storing nil is storing a value that's already collected. Storing the value key already has keeps its weak pointer, so it doesn't allocate.
+func (w *ValWeak[K, V]) Store(key K, val *V) bool {
+	added := false
+	w.m.Compute(key, func(old *weak.Pointer[V], loaded bool) (*weak.Pointer[V], ComputeOp) {
+		if added = !loaded || old.Value() == nil; !added && old.Value() == val {
+			return old, KEEP
+		}
+		new := weak.Make(val)
+		return &new, STORE
+	})
+	return added
+}
+
+// LoadOrStore returns the value of key and true when key is present and its value isn't collected. Otherwise, it stores val to key like Store and returns val and false.
+func (w *ValWeak[K, V]) LoadOrStore(key K, val *V) (actual *V, loaded bool) {
+	w.m.Compute(key, func(old *weak.Pointer[V], ok bool) (*weak.Pointer[V], ComputeOp) {
+		if ok {
+			if actual = old.Value(); actual != nil {
+				loaded = true
+				return old, KEEP
+			}
+		}
+		actual, loaded = val, false
+		new := weak.Make(val)
+		return &new, STORE
+	})
+	return
+}
+
+// Delete key, reporting whether it was present and its value wasn't collected.
+func (w *ValWeak[K, V]) Delete(key K) bool {
+	p := w.m.LoadPtrAndDelete(key)
+	return p != nil && p.Value() != nil
+}
+
+// Range over the keys whose values aren't collected. Collected keys found are deleted. Range isn't linearizable.
+func (w *ValWeak[K, V]) Range(yield func(K, *V) bool) {
+	for k, p := range w.m.Range {
+		if v := p.Value(); v == nil {
+			w.m.ComparePtrAndDelete(k, p)
+		} else if !yield(k, v) {
+			break
+		}
+	}
+}
+
+// Sweep deletes all keys whose values are collected and returns the number of keys deleted.
+func (w *ValWeak[K, V]) Sweep() (n int) {
+	for k, p := range w.m.Range {
+		if p.Value() == nil && w.m.ComparePtrAndDelete(k, p) == SUCCESS {
+			n++
+		}
+	}
+	return
+}
+
+// Size includes the keys whose values are collected but aren't deleted yet.
+func (w *ValWeak[K, V]) Size() uint {
+	return w.m.Size()
+}
@@ -0,0 +1,139 @@
+package Maps
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// testWeakV is large enough to be allocated by itself, so it's collected as soon as it's unreachable.
+type testWeakV struct {
+	k   testVPT
+	pad [64]byte
+}
+
+// testWeakStore stores a new value for every key in [from, to), keeping those of even keys in kept.
+//
+//go:noinline
+func testWeakStore(mq *ValWeak[testVPT, testWeakV], from, to testVPT, kept map[testVPT]*testWeakV) {
+	for i := from; i < to; i++ {
+		v := &testWeakV{k: i}
+		if i%2 == 0 {
+			kept[i] = v
+		}
+		if !mq.Store(i, v) {
+			panic("not added")
+		}
+	}
+}
+
+func testGC() {
+	runtime.GC()
+	runtime.GC()
+}
+
+func TestValWeak(t *testing.T) {
+	mq := NewValWeak[testVPT, testWeakV](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	kept := map[testVPT]*testWeakV{}
+	testWeakStore(mq, 0, testAddNEach, kept)
+	if v := mq.Load(0); v != kept[0] {
+		t.Fatal("wrong load before GC", v)
+	}
+	testGC()
+	if s := mq.Size(); s != testAddNEach {
+		t.Fatal("collected keys are deleted before they're found", s)
+	}
+	for i := range testVPT(testAddNEach) {
+		if v := mq.Load(i); v != kept[i] {
+			t.Fatal("wrong load after GC", i, v)
+		}
+	}
+	if s, stats := mq.Size(), mq.m.Stats(); s != testAddNEach/2 || stats.Keys != s {
+		t.Fatal("collected keys are not unlinked lazily", s, stats.Keys)
+	}
+
+	testWeakStore(mq, testAddNEach, 2*testAddNEach, kept)
+	testGC()
+	if n := mq.Sweep(); n != testAddNEach/2 {
+		t.Fatal("wrong sweep count", n)
+	}
+	n := 0
+	for k, v := range mq.Range {
+		if v != kept[k] {
+			t.Fatal("wrong range", k, v)
+		}
+		n++
+	}
+	if n != testAddNEach || mq.Size() != testAddNEach {
+		t.Fatal("wrong size", n, mq.Size())
+	}
+
+	delete(kept, 0)
+	delete(kept, 2)
+	testGC()
+	if mq.Delete(0) || !mq.Delete(4) {
+		t.Fatal("Delete should report only values that aren't collected")
+	}
+	if v, loaded := mq.LoadOrStore(6, &testWeakV{}); !loaded || v != kept[6] {
+		t.Fatal("wrong LoadOrStore of a kept value", v)
+	}
+	v := &testWeakV{k: 2}
+	if actual, loaded := mq.LoadOrStore(2, v); loaded || actual != v {
+		t.Fatal("LoadOrStore should replace a collected value", actual)
+	} else if mq.Store(2, v) || !mq.Store(0, nil) {
+		t.Fatal("wrong store")
+	}
+	for range mq.Range {
+	}
+	if s := mq.Size(); s != testAddNEach-2 || mq.Load(0) != nil {
+		t.Fatal("Range should delete collected keys", s)
+	}
+	runtime.KeepAlive(v)
+}
+
+func TestValWeak_StoreAllocs(t *testing.T) { //storing the value a key already has reuses its weak pointer.
+	mq := NewValWeak[testVPT, testWeakV](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	v := &testWeakV{k: 1}
+	mq.Store(1, v)
+	if a := testing.AllocsPerRun(testAddNEach, func() {
+		if mq.Store(1, v) {
+			t.Fatal("storing the same value is an add")
+		}
+	}); a != 0 {
+		t.Fatal("storing the same value allocates", a)
+	}
+	if mq.Load(1) != v {
+		t.Fatal("wrong value")
+	}
+	runtime.KeepAlive(v)
+}
+
+func TestValWeak_Concurrent(t *testing.T) {
+	mq := NewValWeak[testVPT, testWeakV](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := testVPT(i * testAddNEach); j < testVPT((i+1)*testAddNEach); j++ {
+				mq.Store(j, &testWeakV{k: j})
+				//a value stored again must not be deleted as collected by other loads.
+				v := &testWeakV{k: j}
+				mq.Store(j, v)
+				if j%64 == 0 {
+					runtime.GC()
+				}
+				if got := mq.Load(j); got != v {
+					t.Error("lost", j, got)
+					return
+				}
+				runtime.KeepAlive(v)
+			}
+		}()
+	}
+	wg.Wait()
+	testGC()
+	if n := mq.Sweep(); n != testAddNEach*testThrdsN-int(mq.Size()) || mq.Size() != 0 {
+		t.Fatal("collected keys remain", n, mq.Size())
+	}
+}
@@ -0,0 +1,304 @@
+package Maps
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ValAny tests are generated from ValUintptr_test.go; these are of what ValVal maps don't have or do differently.
+
+// testIs returns the function given to CompareAndSwap and CompareAndDelete of ValAny that expects v.
+func testIs[V comparable](v V) func(V) bool {
+	return func(a V) bool { return a == v }
+}
+
+func TestValAny_CompareAndSwap(t *testing.T) { //values are slices, which aren't comparable.
+	vp := NewValAny[testVPT, []int](testMinBSz, testMaxBSz, 16, testHashF)
+	head := func(v int) func([]int) bool {
+		return func(a []int) bool { return a[0] == v }
+	}
+	if vp.CompareAndSwap(0, nil, head(0)) != NULL {
+		t.Fail()
+	}
+	vp.Store(0, []int{0})
+	results := make([]bool, 4)
+	for range rand.Intn(testAddN) {
+		wg := sync.WaitGroup{}
+		wg.Add(4)
+		for i, arg := range [][2]int{{0, 1}, {1, 2}, {1, 3}, {0, 4}} {
+			go func() {
+				if a := vp.CompareAndSwap(0, []int{arg[1]}, head(arg[0])); a == NULL {
+					t.Fail()
+				} else {
+					results[i] = a == SUCCESS
+				}
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		vp.Store(0, []int{0})
+		if results[1] && results[2] {
+			t.Fatal("1 2 are exclusive")
+		}
+		if (results[1] || results[2]) && !results[0] {
+			t.Fatal("1 2 depends on 0")
+		}
+		if results[0] == results[3] {
+			t.Fatal("0 3 are exclusive")
+		}
+	}
+}
+func TestValAny_CompareAndDelete(t *testing.T) {
+	vp := NewValAny[testVPT, int](testMinBSz, testMaxBSz, 16, testHashF)
+	if vp.CompareAndDelete(0, testIs(0)) != NULL {
+		t.Fail()
+	}
+	vp.Store(0, 0)
+	if vp.CompareAndDelete(0, testIs(1)) != FAILED {
+		t.Fail()
+	}
+	results := make([]CASResult, 2)
+	for range rand.Intn(testAddN) {
+		vp.Store(0, 0)
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		go func() {
+			results[0] = vp.CompareAndDelete(0, testIs(0))
+			wg.Done()
+		}()
+		go func() {
+			results[1] = vp.CompareAndDelete(0, testIs(0))
+			wg.Done()
+		}()
+		go func() {
+			vp.LoadOrStore(0, 1)
+			wg.Done()
+		}()
+		wg.Wait()
+		if (results[0] == SUCCESS) == (results[1] == SUCCESS) {
+			t.Fatal("exactly 1 of 0 and 1 should SUCCESS", results)
+		}
+	}
+}
+func TestValAny_CompareAndDelete_Lease(t *testing.T) { //each key is a lease; only the holder of the token may release it.
+	const keys = 16
+	vp := NewValAny[testVPT, int](testMinBSz, testMaxBSz, keys-1, testHashF)
+	holders := make([]atomic.Int32, keys)
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range int(testThrdsN) {
+		go func() {
+			defer wg.Done()
+			for j := range testAddNEach {
+				k := testVPT(j*int(i+1)) % keys
+				if _, loaded := vp.LoadOrStore(k, i); loaded {
+					if vp.CompareAndDelete(k, testIs(i)) == SUCCESS {
+						t.Error("released a lease held by another.")
+					}
+					continue
+				}
+				if holders[k].Add(1) != 1 {
+					t.Error("lease held by more than 1.")
+				}
+				holders[k].Add(-1)
+				if a := vp.CompareAndDelete(k, testIs(i)); a != SUCCESS {
+					t.Error("failed to release own lease:", a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if vp.Size() != 0 {
+		t.Fatal("leases left:", vp.Size())
+	}
+	vp.Range(func(testVPT, int) bool {
+		t.Fatal("range found released lease.")
+		return false
+	})
+}
+
+// testAnyVal is wider than a machine word, and its elements are always equal, so a torn copy of it is detected.
+type testAnyVal [4]int
+
+func TestValAny_ReuseBoxes(t *testing.T) { //boxes are reused while readers may still copy from them.
+	const keys = 16
+	mq := NewValAny[testVPT, testAnyVal](testMinBSz, testMaxBSz, keys-1, testHashF)
+	check := func(k testVPT, v testAnyVal) bool {
+		if v[0]%keys != int(k) || v != (testAnyVal{v[0], v[0], v[0], v[0]}) {
+			t.Error("torn value", k, v)
+			return false
+		}
+		return true
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := range testAddN {
+				k, x := testVPT(j%keys), j*keys+j%keys
+				switch v := (testAnyVal{x, x, x, x}); (i + j) % 4 {
+				case 0:
+					mq.Store(k, v)
+				case 1:
+					if old, ok := mq.Swap(k, v); ok && !check(k, old) {
+						return
+					}
+				case 2:
+					if old, ok := mq.Load(k); ok {
+						if !check(k, old) {
+							return
+						}
+						mq.CompareAndSwap(k, v, testIs(old))
+					}
+				default:
+					for k, v := range mq.Range {
+						if !check(k, v) {
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValAny_StoreAllocs(t *testing.T) { //overwriting a key reuses the box it swaps out.
+	mq := NewValAny[testVPT, testAnyVal](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Store(0, testAnyVal{})
+	mq.Store(0, testAnyVal{1})
+	if a := testing.AllocsPerRun(testAddNEach, func() {
+		mq.Store(0, testAnyVal{2})
+	}); a != 0 {
+		t.Fatal("overwriting allocates", a)
+	}
+	if v, ok := mq.Load(0); !ok || v != (testAnyVal{2}) {
+		t.Fatal("wrong value", v, ok)
+	}
+}
+
+func TestValAny_PoolNodes(t *testing.T) {
+	mq := NewValAny[testVPT, testAnyVal](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.PoolNodes()
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	var done atomic.Bool
+	ranged := make(chan struct{})
+	go func() { //a reused node must never be seen with the key of its last use and the value of the next.
+		for !done.Load() {
+			for k, v := range mq.Range {
+				if v != (testAnyVal{int(k), int(k), int(k), int(k)}) {
+					t.Error("wrong value", k, v)
+				}
+			}
+		}
+		close(ranged)
+	}()
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for range 4 {
+				for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+					v := testAnyVal{j, j, j, j}
+					if !mq.Store(testVPT(j), v) {
+						t.Error("not added", j)
+						return
+					}
+					if old, ok := mq.LoadAndDelete(testVPT(j)); !ok || old != v {
+						t.Error("wrong value", j, old)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Store(true)
+	<-ranged
+	if s := mq.Stats(); s.Reused == 0 || s.Keys != 0 || mq.Size() != 0 {
+		t.Fatal("nodes aren't reused", s.Reused, s.Keys, mq.Size())
+	}
+}
+func TestValAny_PoolNodes_LoadPtr(t *testing.T) { //the pointer of LoadPtr stays valid after its node is reused.
+	mq := NewValAny[testVPT, testAnyVal](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.PoolNodes()
+	mq.Store(0, testAnyVal{1, 1, 1, 1})
+	p := mq.LoadPtr(0)
+	for j := range testAddN {
+		mq.LoadAndDelete(testVPT(j))
+		mq.Store(testVPT(j+1), testAnyVal{j, j, j, j})
+	}
+	if *p != (testAnyVal{1, 1, 1, 1}) {
+		t.Fatal("the value of LoadPtr is overwritten", *p)
+	}
+	if mq.Stats().Reused == 0 {
+		t.Fatal("nodes aren't reused")
+	}
+}
+
+func TestValAny_OnChange(t *testing.T) {
+	type change = Change[testVPT, testAnyVal]
+	mq := NewValAny[testVPT, testAnyVal](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.TrackWrites() //Clear requires it.
+	var got, watched []change
+	mq.OnChange(func(c change) { got = append(got, c) })
+	cancel := mq.Watch(1, func(c change) { watched = append(watched, c) })
+	mq.Store(1, testAnyVal{1})
+	mq.Store(2, testAnyVal{2})
+	mq.Swap(1, testAnyVal{3})
+	mq.CompareAndSwap(1, testAnyVal{4}, testIs(testAnyVal{1})) //fails, so it isn't a change.
+	mq.CompareAndSwap(1, testAnyVal{4}, testIs(testAnyVal{3}))
+	mq.LoadOrStore(1, testAnyVal{5})
+	mq.Compute(1, func(old testAnyVal, _ bool) (testAnyVal, ComputeOp) { return old, DELETE })
+	cancel()
+	mq.Store(1, testAnyVal{5})
+	mq.CompareAndDelete(1, testIs(testAnyVal{5}))
+	mq.Clear()
+	want := []change{
+		{Key: 1, New: testAnyVal{1}, Stored: true},
+		{Key: 2, New: testAnyVal{2}, Stored: true},
+		{Key: 1, Old: testAnyVal{1}, New: testAnyVal{3}, Loaded: true, Stored: true},
+		{Key: 1, Old: testAnyVal{3}, New: testAnyVal{4}, Loaded: true, Stored: true},
+		{Key: 1, Old: testAnyVal{4}, Loaded: true},
+		{Key: 1, New: testAnyVal{5}, Stored: true},
+		{Key: 1, Old: testAnyVal{5}, Loaded: true},
+		{Key: 2, Old: testAnyVal{2}, Loaded: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("wrong changes", got)
+	}
+	if want = slices.DeleteFunc(want[:5], func(c change) bool { return c.Key != 1 }); !slices.Equal(watched, want) {
+		t.Fatal("wrong watched changes", watched)
+	}
+}
+func TestValAny_OnChange_Compute(t *testing.T) { //the functions given to Compute and CompareAndSwap are called without the lock of the stripe, so they may write to the same stripe.
+	mq := NewValAny[testVPT, int](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	mq.Store(trackerStripes, 0) //they only overwrite it, so they aren't called again for a node linked next to key.
+	var got []testVPT
+	mq.OnChange(func(c Change[testVPT, int]) { got = append(got, c.Key) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mq.Compute(0, func(int, bool) (int, ComputeOp) {
+			mq.Store(trackerStripes, 1)
+			return 1, STORE
+		})
+		mq.CompareAndSwap(0, 2, func(v int) bool {
+			mq.Store(trackerStripes, 2)
+			return v == 1
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("the functions given to the map are blocked from writing to their stripe")
+	}
+	if v, _ := mq.Load(0); v != 2 || !slices.Equal(got, []testVPT{trackerStripes, 0, trackerStripes, 0}) {
+		t.Fatal("wrong changes", v, got)
+	}
+}
@@ -2,13 +2,13 @@
 Package Maps implements linearizable, wait-free general-purpose concurrent hashmap. Multiple variants are offered to take advantage of all supported types in the atomic package.
 
 # Linearizability
-The effect of all calls can be squashed down to a point, so there is no intermediate states during operations. Implementations here are nearly 100% linearizable except for size, range, and copy.
+The effect of all calls can be squashed down to a point, so there is no intermediate states during operations. Implementations here are nearly 100% linearizable except for size, range, and copy. Use Snapshot when a linearizable view of the whole map is needed.
 
 # Sequential Consistency
 All calls will see the results of all calls that finished before it started. This is a weaker version of linearizability. In go terminology, it's basically the synchronize before thing, so any write operation synchronize before any read operation. All implementations here are sequentially consistent.
 
 # Wait Free
-A stronger version of Lock-Free. All operations, regardless of the number of threads calling them, must finish within bounded time and procedures. Wait-free means lock-free. All implementations here are wait-free. A typical example that violates wait-free is spin lock. Basically, wait-free means no busy waiting.
+A stronger version of Lock-Free. All operations, regardless of the number of threads calling them, must finish within bounded time and procedures. Wait-free means lock-free. All implementations here are wait-free, except that writing the value of an existing key in ValPtr and ValAny retries when it races with other writes to the same key, which is only lock-free, that deleting from a map whose nodes are pooled by PoolNodes takes a lock to retire the node, that writes to a map observed by OnChange are serialized in each stripe of hashes, and that writes to a map whose writes are tracked by TrackWrites wait while Clear detaches the list, or in Set and Multi while Size sums the counts after failing to find a moment without writes. Snapshot never holds off writes. A typical example that violates wait-free is spin lock. Basically, wait-free means no busy waiting.
 
 # Usage
 It's recommended to use your own hash function whenever possible instead of just using the general hash function offered by go. A good hash function with its lower maxHash bound can increase performance by up to 50%.
@@ -17,10 +17,16 @@ Unlike usual hashmap implementation where the underlying backing array only expa
 */
 package Maps
 
-// Generates all other ValVal map variants using ValUintptr.go and ValUintptr_test.go as templates.
-//go:generate go run gen.go -implTmpl "ValUintptr.go" -testTmpl "ValUintptr_test.go" -- int64 uint64 int32 uint32
+// Generates all other ValVal map variants using ValUintptr.go and ValUintptr_test.go as templates. The tests of ValFloat64 and ValBool are written by hand, since their values aren't integers. Set MAPS_GEN_VERIFY to check that the generated files are up to date instead.
+//go:generate go run gen.go -implTmpl "ValUintptr.go" -testTmpl "ValUintptr_test.go" -- int64 uint64 int32 uint32 int uint
+//go:generate go run gen.go -implTmpl "ValUintptr.go" -- float64 bool
+// Generates the tests of ValAny, whose implementation is written by hand, using ValUintptr_test.go as template.
+//go:generate go run gen.go -testTmpl "ValUintptr_test.go" -- Any=int
 import (
+	"fmt"
 	"math"
+	"runtime"
+	"slices"
 	"sync/atomic"
 	"unsafe"
 )
@@ -37,64 +43,525 @@ const (
 	NULL                     //indicates that the key doesn't exist and the CAS isn't performed. A CaD operation on the same key that SUCCESS before the current operation started guarantees NULL while happening at the same time may result in either FAILED or NULL.
 )
 
+// ComputeOp is returned by the function passed to Compute to decide what happens to the key.
+type ComputeOp byte
+
+const (
+	KEEP   ComputeOp = iota //leaves the key as it is.
+	STORE                   //stores the returned value to the key, adding the key when it isn't present.
+	DELETE                  //deletes the key when it's present.
+)
+
+// Cursor records where Scan stopped, so a later Scan continues from there. The zero value starts from the smallest hash. Since the position is kept as a hash, resizing and concurrent writes don't make Scan skip or repeat keys that stay in the map; only when keys sharing the hash of the last visited key are deleted between 2 Scan calls, keys of that hash may be skipped or repeated.
+type Cursor struct {
+	hash, skip uint //skip is the number of visited keys whose hash is hash.
+	done       bool
+}
+
+// Done reports whether the scan has passed the largest hash.
+func (c *Cursor) Done() bool {
+	return c.done
+}
+
+// visit is called by Scan for every present node from where c is, reporting whether the node wasn't visited before. seen is the number of nodes of c.hash that are still to be skipped.
+func (c *Cursor) visit(hash uint, seen *uint) bool {
+	if hash != c.hash {
+		c.hash, c.skip, *seen = hash, 0, 0
+	} else if *seen > 0 {
+		*seen--
+		return false
+	}
+	c.skip++
+	return true
+}
+
 // base is the shared parts of ValPtr and all other ValVal maps.
-type base[K comparable] struct {
+type base[K any] struct {
 	MinAvgBucketSize, MaxAvgBucketSize, maxLogChunkSize byte
 	firstRelay                                          relay
 	size                                                atomic.Uintptr //LS bit is used to indicate whether a resize is happening. Therefore, this should be changed by 2 each time.
 	buckets                                             *chunkArr      //bucket referring to ordered linked list as table.
 	HashF                                               func(K) uint
+	eq                                                  func(K, K) bool    //used in place of == to match keys in ValPtr and ValVal maps, and to find equal keys when building a map.
+	writes                                              *tracker           //nil unless TrackWrites is called.
+	splits, merges                                      atomic.Uint64      //reported by Stats.
+	collisions                                          *collisionDetector //nil unless DetectCollisions is called.
+	nodes                                               *reclaimer         //nil unless PoolNodes is called.
+	locks                                               *stripeLocks       //nil unless OnChange is called.
 }
 
+// resizeHook is called between the steps of split and merge when it isn't nil. Tests set it to yield, so that other operations run in the middle of a resize.
+var resizeHook func()
+
 func (vp *base[K]) trySplit() {
 	if size := vp.size.Or(resizingMask); size&resizingMask == 0 { //we acquired the exclusive right to change vp.buckets, so we can read it non-atomically since we know no one else will change it.
 		size >>= 1
 		if logChunks := vp.maxLogChunkSize - vp.buckets.logChunkSize; vp.buckets.logChunkSize > 0 && byte(size>>logChunks) >= vp.MaxAvgBucketSize {
-			newBuckets, newRelays := newChunkArr(vp.maxLogChunkSize, vp.buckets.logChunkSize-1), make([]relay, 1<<logChunks)
-			for i := range uint(len(newRelays)) {
-				left := vp.buckets.Fetch(i)
-				newBuckets.set(i<<1, left)
-				newRelays[i].hash = i*(1<<vp.buckets.logChunkSize) | 1<<newBuckets.logChunkSize
-				newBuckets.set(i<<1|1, &newRelays[i])
-				path, fb := evictStack{}, func() *relay {
-					return vp.buckets.Fetch(i)
-				}
-				left, right := left.crawl(&path, fb)
-				for nrAddr := unsafe.Pointer(uintptr(unsafe.Pointer(&newRelays[i])) | relayMask); ; left, right = left.crawl(&path, fb) {
-					if rightAddr := addr(right); right == nil || newRelays[i].hash <= (*relay)(rightAddr).hash {
-						if newRelays[i].next = right; left.tryLink(right, nrAddr) {
-							break
-						}
-					} else {
-						path.Push(rightAddr)
-						left = (*relay)(rightAddr)
-					}
+			vp.split()
+		}
+		vp.size.And(^resizingMask)
+	}
+}
+
+// split doubles the buckets by linking a new relay in the middle of each bucket. The caller must hold resizingMask.
+func (vp *base[K]) split() {
+	logChunks := vp.maxLogChunkSize - vp.buckets.logChunkSize
+	newBuckets, newRelays := newChunkArr(vp.maxLogChunkSize, vp.buckets.logChunkSize-1), make([]relay, 1<<logChunks)
+	for i := range uint(len(newRelays)) {
+		left := vp.buckets.Fetch(i)
+		newBuckets.set(i<<1, left)
+		newRelays[i].hash = i*(1<<vp.buckets.logChunkSize) | 1<<newBuckets.logChunkSize
+		newBuckets.set(i<<1|1, &newRelays[i])
+		if resizeHook != nil {
+			resizeHook()
+		}
+		path, fb := evictStack{}, func() *relay {
+			return vp.buckets.Fetch(i)
+		}
+		left, right := left.crawl(&path, fb)
+		for nrAddr := unsafe.Pointer(uintptr(unsafe.Pointer(&newRelays[i])) | relayMask); ; left, right = left.crawl(&path, fb) {
+			if rightAddr := addr(right); right == nil || newRelays[i].hash <= (*relay)(rightAddr).hash {
+				if newRelays[i].next = right; left.tryLink(right, nrAddr) {
+					break
 				}
+			} else {
+				path.Push(rightAddr)
+				left = (*relay)(rightAddr)
 			}
-			atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)), unsafe.Pointer(newBuckets))
 		}
-		vp.size.And(^resizingMask)
 	}
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)), unsafe.Pointer(newBuckets))
+	vp.splits.Add(1)
 }
 func (vp *base[K]) tryMerge() {
 	if size := vp.size.Or(resizingMask); size&resizingMask == 0 {
 		size >>= 1
-		b := vp.buckets
-		if logChunks := vp.maxLogChunkSize - b.logChunkSize; logChunks > 0 && byte(size>>logChunks) < vp.MinAvgBucketSize {
-			newBuckets := newChunkArr(vp.maxLogChunkSize, b.logChunkSize+1)
-			for i := range uint(1) << (logChunks - 1) {
-				newBuckets.set(i, b.Fetch(i<<1))
+		if logChunks := vp.maxLogChunkSize - vp.buckets.logChunkSize; logChunks > 0 && byte(size>>logChunks) < vp.MinAvgBucketSize {
+			vp.merge()
+		}
+		vp.size.And(^resizingMask)
+	}
+}
+
+// merge halves the buckets by marking the relays of the odd ones. The caller must hold resizingMask.
+func (vp *base[K]) merge() {
+	b, logChunks := vp.buckets, vp.maxLogChunkSize-vp.buckets.logChunkSize
+	newBuckets := newChunkArr(vp.maxLogChunkSize, b.logChunkSize+1)
+	for i := range uint(1) << (logChunks - 1) {
+		newBuckets.set(i, b.Fetch(i<<1))
+	}
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)), unsafe.Pointer(newBuckets))
+	for i := uint(1); i < 1<<logChunks; i += 2 {
+		if resizeHook != nil {
+			resizeHook()
+		}
+		b.Fetch(i).mark()
+	}
+	vp.merges.Add(1)
+}
+
+// lockResize waits for the resize in progress to finish and acquires resizingMask, so the buckets can be changed.
+func (vp *base[K]) lockResize() {
+	for vp.size.Or(resizingMask)&resizingMask != 0 {
+		runtime.Gosched()
+	}
+}
+func (vp *base[K]) unlockResize() {
+	vp.size.And(^resizingMask)
+}
+
+// Reserve splits the buckets in advance, so that n keys can be added without splitting them again. Deleting keys can still merge the buckets when the average bucket size falls below MinAvgBucketSize. It's safe to call concurrently with other methods.
+func (vp *base[K]) Reserve(n uint) {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0).Add(-1)
+	}
+	vp.lockResize()
+	defer vp.unlockResize()
+	for vp.buckets.logChunkSize > 0 && n>>(vp.maxLogChunkSize-vp.buckets.logChunkSize) >= uint(vp.MaxAvgBucketSize) {
+		vp.split()
+	}
+}
+
+// Shrink merges the buckets as long as the average bucket size stays below MaxAvgBucketSize, which gives the fewest buckets that adding a key doesn't split right away. It's safe to call concurrently with other methods.
+func (vp *base[K]) Shrink() {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0).Add(-1)
+	}
+	vp.lockResize()
+	defer vp.unlockResize()
+	for logChunks := vp.maxLogChunkSize - vp.buckets.logChunkSize; logChunks > 0 && uint(vp.size.Load()>>1)>>(logChunks-1) < uint(vp.MaxAvgBucketSize); logChunks-- {
+		vp.merge()
+	}
+}
+
+// clear detaches the list from firstRelay and resets the buckets to 1, so operations starting afterward see an empty map. It then walks the detached list in order, marking the relays and deleting the nodes by del, which reports whether it marked the node itself. It returns false without doing anything when writes aren't tracked, since the writes in progress on the detached list couldn't be told apart from the ones that are done.
+// The writes are fenced until the list is detached, so no write is in progress on the detached list and clear is linearized at detaching it, where the counts of keys drop to 0. The buckets are reset before, so operations that still start from the old buckets started before clear is linearized, and reads on the detached list see the values at detaching. Snapshots walk the list, so clear waits for the snapshots in progress and holds off new ones until the list is detached.
+func (vp *base[K]) clear(del func(n *relay) bool) bool {
+	t := vp.writes
+	if t == nil {
+		return false
+	}
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0).Add(-1)
+	}
+	t.fence()
+	t.clears.Lock() //after the fence, so a snapshot taken by a write in progress doesn't wait for clear.
+	vp.lockAll()
+	for i := range t.stripes {
+		t.stripes[i].begun.Add(1) //size mustn't sum the counts while they're reset.
+	}
+	vp.lockResize()
+	buckets := newChunkArr(vp.maxLogChunkSize, vp.maxLogChunkSize)
+	buckets.set(0, &vp.firstRelay)
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)), unsafe.Pointer(buckets))
+	old := atomic.LoadPointer(&vp.firstRelay.next)
+	for ; !vp.firstRelay.tryLink(old, nil); old = atomic.LoadPointer(&vp.firstRelay.next) {
+	}
+	vp.unlockResize()
+	for i := range t.stripes {
+		t.stripes[i].count.Store(0)
+		t.stripes[i].ended.Add(1)
+	}
+	t.unfence()
+	t.clears.Unlock()
+	for cur := old; cur != nil; {
+		n := (*relay)(addr(cur))
+		if isRelay(cur) {
+			n.mark()
+		} else if del(n) {
+			if vp.size.Add(^uintptr(resizingMask<<1 - 1)); vp.nodes != nil {
+				vp.nodes.retire(unsafe.Pointer(n), n.hash) //the detached list can't be reached by operations starting afterward, so n needn't be removed from it.
 			}
-			atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)), unsafe.Pointer(newBuckets))
-			for i := uint(1); i < 1<<logChunks; i += 2 {
-				b.Fetch(i).mark()
+		}
+		cur = unsafe.Pointer(uintptr(atomic.LoadPointer(&n.next)) &^ deletedMask) //n is marked, so next doesn't change anymore.
+	}
+	vp.unlockAll()
+	return true
+}
+
+// equal is the eq of comparable keys.
+func equal[K comparable](a, b K) bool {
+	return a == b
+}
+
+// listBuilder appends nodes in the order of hash to a map that isn't shared yet, adding the relays of the buckets on the way. The relays are allocated together like in split, and the size is added once by done.
+type listBuilder[K any] struct {
+	vp        *base[K]
+	tail      *relay
+	relays    []relay //relays[i] is the relay of bucket i+1.
+	tailIndex uint
+	n         uintptr
+}
+
+// builder makes the buckets of an empty map with logChunkSize and returns a listBuilder to fill it.
+func (vp *base[K]) builder(logChunkSize byte) listBuilder[K] {
+	vp.buckets = newChunkArr(vp.maxLogChunkSize, logChunkSize)
+	vp.buckets.set(0, &vp.firstRelay)
+	return listBuilder[K]{vp: vp, tail: &vp.firstRelay, relays: make([]relay, 1<<(vp.maxLogChunkSize-logChunkSize)-1)}
+}
+
+// link n after the last node. n's hash mustn't be smaller than the last one.
+func (l *listBuilder[K]) link(n *relay) {
+	l.relaysTo(l.vp.buckets.Index(n.hash))
+	l.tail.next = unsafe.Pointer(n)
+	l.tail = n
+	if l.n++; l.vp.writes != nil {
+		if l.vp.writes.stripes[n.hash%trackerStripes].count.Add(1); l.vp.writes.version != nil {
+			l.vp.writes.version(n)
+		}
+	}
+}
+
+// relaysTo appends the relays of the buckets up to index, including the empty ones.
+func (l *listBuilder[K]) relaysTo(index uint) {
+	for ; l.tailIndex < index; l.tailIndex++ {
+		new := &l.relays[l.tailIndex]
+		new.hash = (l.tailIndex + 1) * (1 << l.vp.buckets.logChunkSize)
+		l.tail.next = unsafe.Pointer(uintptr(unsafe.Pointer(new)) | relayMask)
+		l.tail = new
+		l.vp.buckets.set(l.tailIndex+1, new)
+	}
+}
+
+// done appends the relays of the remaining buckets, so that every bucket has its relay, and adds the nodes to the size.
+func (l *listBuilder[K]) done() {
+	l.relaysTo(uint(len(l.relays)))
+	l.vp.size.Add(l.n * (resizingMask << 1))
+}
+
+// load replaces the contents of a map that isn't used concurrently with a node for each of keys, which node makes from the hash and index of a key. Equal keys are reported as ErrFormat before anything is changed.
+func (vp *base[K]) load(keys []K, node func(hash uint, i int) *relay) error {
+	order := vp.sortUnique(keys)
+	if len(order) != len(keys) {
+		return fmt.Errorf("%w: duplicate key", ErrFormat)
+	}
+	vp.build(order, node)
+	return nil
+}
+
+// sortUnique is sortByHash that keeps only the last of equal keys, so later keys win like they do when stored in order.
+func (vp *base[K]) sortUnique(keys []K) []hashedKey {
+	order := vp.sortByHash(keys)
+	unique := order[:0] //never catches up with the group being checked.
+	for start, end := 0, 0; start < len(order); start = end {
+		for end = start + 1; end < len(order) && order[end].hash == order[start].hash; end++ {
+		}
+		for i := start; i < end; i++ {
+			if i+1 == end || !slices.ContainsFunc(order[i+1:end], func(o hashedKey) bool { return vp.eq(keys[o.i], keys[order[i].i]) }) {
+				unique = append(unique, order[i])
 			}
 		}
-		vp.size.And(^resizingMask)
 	}
+	return unique
+}
+
+// build replaces the contents of a map that isn't used concurrently with a node for each of order, which must be sorted by hash and free of equal keys. The nodes are laid out in order like Copy, in as many buckets as Reserve would make for them.
+func (vp *base[K]) build(order []hashedKey, node func(hash uint, i int) *relay) {
+	logChunkSize := vp.maxLogChunkSize
+	for ; logChunkSize > 0 && uint(len(order))>>(vp.maxLogChunkSize-logChunkSize) >= uint(vp.MaxAvgBucketSize); logChunkSize-- {
+	}
+	vp.firstRelay.next = nil
+	vp.size.Store(0)
+	if vp.writes != nil {
+		vp.writes = newTracker(vp.writes.version, vp.writes.present)
+	}
+	b := vp.builder(logChunkSize)
+	for _, o := range order {
+		b.link(node(o.hash, o.i))
+	}
+	b.done()
+}
+
+// seek returns the first node whose hash isn't smaller than hash in the same tagged form as next.
+func (vp *base[K]) seek(hash uint) unsafe.Pointer {
+	cur := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash).walk()
+	for ; cur != nil && (*relay)(addr(cur)).hash < hash; cur = (*relay)(addr(cur)).walk() {
+	}
+	return cur
+}
+
+// hashedKey is the index of a key in a batch with its hash.
+type hashedKey struct {
+	hash uint
+	i    int
+}
+
+// sortByHash returns the hashes and indexes of keys sorted by hash, so that batch operations can visit keys in the order of the list. It's a radix sort that skips the bytes shared by all hashes, and it's stable, so equal hashes keep the order of keys.
+func (vp *base[K]) sortByHash(keys []K) []hashedKey {
+	order, diff := make([]hashedKey, len(keys)), uint(0)
+	for i := range keys {
+		order[i] = hashedKey{vp.HashF(keys[i]), i}
+		diff |= order[i].hash ^ order[0].hash
+	}
+	buf := make([]hashedKey, len(keys))
+	for shift := 0; diff>>shift != 0; shift += 8 {
+		if diff>>shift&0xff == 0 {
+			continue
+		}
+		var starts [1 << 8]int
+		for _, o := range order {
+			starts[o.hash>>shift&0xff]++
+		}
+		for d, sum := 0, 0; d < len(starts); d++ {
+			starts[d], sum = sum, sum+starts[d]
+		}
+		for _, o := range order {
+			buf[starts[o.hash>>shift&0xff]] = o
+			starts[o.hash>>shift&0xff]++
+		}
+		order, buf = buf, order
+	}
+	return order
+}
+
+// nearer returns from when it's between the bucket of hash and hash in the list, or the bucket otherwise. from must have a smaller hash than the nodes of hash, since a key of hash may be before a node of the same hash.
+func (vp *base[K]) nearer(from *relay, hash uint) *relay {
+	if b := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(hash); from == nil || b.hash > from.hash || from.hash >= hash {
+		return b
+	}
+	return from
+}
+
+// unlink physically removes a node after its value is replaced by tomb, or by a deleted version when writes are tracked. Only the one who wrote it may call it. A deleted version is counted here, and its node is left in the list while a snapshot is in progress, since the snapshot may still need the versions before it; the last snapshot to end marks the node instead.
+func (vp *base[K]) unlink(n *relay) {
+	if t := vp.writes; t != nil && t.version != nil {
+		if t.stripes[n.hash%trackerStripes].count.Add(-1); t.snapshots.Load() != 0 {
+			vp.leave(n)
+			return
+		}
+	}
+	n.mark()
+	vp.deleted(n)
+}
+
+// leave n in the list for the snapshots in progress. n is marked right away when they all end before it's left, since the last of them may have looked for the nodes left already.
+func (vp *base[K]) leave(n *relay) {
+	vp.writes.push(&leftNode{n: n})
+	vp.drain()
+}
+
+// drain marks the nodes left in the list while no snapshot is in progress. Marking a node is safe once no snapshot is in progress after its deleted version is stamped, since the snapshots beginning afterward find it deleted anyway. The nodes found while a snapshot begins are left again for it.
+func (vp *base[K]) drain() {
+	t := vp.writes
+	for t.snapshots.Load() == 0 {
+		l := t.left.Swap(nil)
+		if l == nil {
+			return
+		}
+		for next := l; l != nil; l = next {
+			if next = l.next; t.snapshots.Load() != 0 {
+				t.push(l)
+			} else if l.n.mark() {
+				vp.deleted(l.n)
+			}
+		}
+	}
+}
+
+// path returns the stack an insert records the nodes it crosses in, which counts the runs of equal hashes only when collisions are detected.
+func (vp *base[K]) path() evictStack {
+	return evictStack{runs: vp.collisions != nil}
+}
+
+// added and removed count a node with hash that's linked or marked. path is what the insert crossed to link the node, which is checked for collisions; it's nil when runs of equal hashes are expected.
+func (vp *base[K]) added(hash uint, path *evictStack) {
+	vp.size.Add(resizingMask << 1)
+	if vp.writes != nil {
+		vp.writes.stripes[hash%trackerStripes].count.Add(1)
+	}
+	if vp.collisions != nil && path != nil && path.runHash == hash && path.run > vp.collisions.limit {
+		vp.collisions.found(hash, path.run)
+	}
+}
+func (vp *base[K]) removed(hash uint) {
+	vp.size.Add(^uintptr(resizingMask<<1 - 1))
+	if vp.writes != nil && vp.writes.version == nil { //versions are counted as deleted by unlink.
+		vp.writes.stripes[hash%trackerStripes].count.Add(-1)
+	}
+}
+
+// TrackWrites makes the map count its writes, which makes Size exact and Clear possible. It must be called before the map is used concurrently. Writes get slightly slower, and maps made by Copy don't track writes.
+func (vp *base[K]) TrackWrites() {
+	vp.writes = newTracker(nil, nil)
+}
+
+// trackVersions is TrackWrites of a map whose values are versions when writes are tracked, which Snapshot relies on. version makes the value of a node that isn't shared yet its first version, which is applied to the nodes already in the map, and present reports whether the key of a node is present at a moment of the clock.
+func (vp *base[K]) trackVersions(version func(n *relay), present func(n *relay, moment uint64) bool) {
+	vp.writes = newTracker(version, present)
+	for cur := vp.firstRelay.next; addr(cur) != nil; cur = (*relay)(addr(cur)).next {
+		if !isRelay(cur) {
+			version((*relay)(addr(cur)))
+		}
+	}
+}
+
+// linked stamps the version at p, which is of a node the caller linked, when writes are tracked. Adding a key is linearized at stamping the first version of its node, which must be done before the insert returns.
+func (vp *base[K]) linked(p *unsafe.Pointer) {
+	if vp.writes != nil {
+		vp.writes.stamp((*atomic.Uint64)(atomic.LoadPointer(p))) //stamp is the first field of a version of any type.
+	}
+}
+
+// begin and end bracket every write to the map when writes are tracked, and hold the lock of the stripe of hashes when the map is observed. end delivers the changes after releasing the lock.
+func (vp *base[K]) begin(hash uint) {
+	if vp.writes != nil {
+		vp.writes.begin(hash % trackerStripes)
+	}
+	if vp.locks != nil {
+		vp.locks.stripes[hash%trackerStripes].Lock()
+	}
+}
+func (vp *base[K]) end(hash uint) {
+	if vp.writes != nil {
+		vp.writes.stripes[hash%trackerStripes].ended.Add(1)
+	}
+	if vp.locks != nil {
+		vp.locks.stripes[hash%trackerStripes].Unlock()
+		vp.locks.deliver(hash % trackerStripes)
+	}
+}
+
+// lockAll and unlockAll hold the locks of all stripes of hashes when the map is observed. unlockAll delivers the changes after releasing them.
+func (vp *base[K]) lockAll() {
+	if vp.locks != nil {
+		for i := range vp.locks.stripes {
+			vp.locks.stripes[i].Lock()
+		}
+	}
+}
+func (vp *base[K]) unlockAll() {
+	if vp.locks != nil {
+		for i := range vp.locks.stripes {
+			vp.locks.stripes[i].Unlock()
+		}
+		for i := range vp.locks.stripes {
+			vp.locks.deliver(uint(i))
+		}
+	}
+}
+
+// callCompute calls f of Compute with the lock of the stripe of hash released, which the caller holds by begin, so f may write to an observed map, even to keys of the same stripe, without waiting for the caller. What f returns is applied by CAS after the lock is taken again, which fails when key is changed meanwhile.
+func callCompute[K any, V any](vp *base[K], hash uint, f func(V, bool) (V, ComputeOp), old V, loaded bool) (V, ComputeOp) {
+	if vp.locks == nil {
+		return f(old, loaded)
+	}
+	l := &vp.locks.stripes[hash%trackerStripes]
+	l.Unlock()
+	defer l.Lock() //end unlocks it even when f panics.
+	return f(old, loaded)
+}
+
+// callEq calls eq of CompareAndSwap or CompareAndDelete the same way as callCompute.
+func callEq[K any, V any](vp *base[K], hash uint, eq func(V) bool, v V) bool {
+	if vp.locks == nil {
+		return eq(v)
+	}
+	l := &vp.locks.stripes[hash%trackerStripes]
+	l.Unlock()
+	defer l.Lock()
+	return eq(v)
+}
+
+// snapshot calls copy with the moment to copy the map at, which is read from the clock as it's ticked, so the writes stamped afterward aren't copied. The nodes deleted while copy runs stay in the list for it, and the last snapshot to end marks them. It returns false without calling copy when writes aren't tracked.
+func (vp *base[K]) snapshot(copy func(moment uint64)) bool {
+	t := vp.writes
+	if t == nil {
+		return false
+	}
+	t.clears.RLock()
+	defer t.clears.RUnlock()
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0).Add(-1)
+	}
+	t.snapshots.Add(1)
+	copy(t.clock.Add(1) - 1)
+	if t.snapshots.Add(-1) == 0 {
+		vp.drain()
+	}
+	return true
 }
 
 // Size isn't linearizable. Calling Size during any Store and Delete calls can result in it returning intermediate values. This isn't a big deal when the size of the map is >0 but can cause underflow when the size of map is 0. As a result, be careful when calling size on a map whose initial size is 0 and while a Store and Delete operation are happening simultaneously.
+// When writes are tracked by TrackWrites, Size is exact and never underflows: it sums the counts of keys at a moment without writes in progress, and when it can't find one in a few tries, it counts the keys in a snapshot of ValPtr, ValAny and ValVal maps, or holds off new writes until the ones in progress end in the other maps.
 func (vp *base[K]) Size() uint {
+	if t := vp.writes; t != nil {
+		if n, ok := t.size(t.present == nil); ok {
+			return n
+		}
+		return vp.count()
+	}
 	return uint(vp.size.Load()) >> 1 //LS bit is resizingMask bit.
 }
+
+// count counts the keys present in a snapshot of a map whose values are versions, which never holds off writes, unlike fencing them.
+func (vp *base[K]) count() (n uint) {
+	present := vp.writes.present
+	vp.snapshot(func(moment uint64) {
+		for cur := vp.firstRelay.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+			if !isRelay(cur) && present((*relay)(addr(cur)), moment) {
+				n++
+			}
+		}
+	})
+	return
+}
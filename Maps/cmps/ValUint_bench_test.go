@@ -130,3 +130,102 @@ func BenchmarkValUintptr_Case2(b *testing.B) {
 		}
 	})
 }
+
+// Size: goroutines store and delete keys of a small map and read its size every few operations, comparing the plain counter with the exact one of TrackWrites.
+
+func benchValUintptrSize(b *testing.B, tracked bool) {
+	const mapSize, readRatio = 1024, 16
+	m := Maps.NewValUintptr[uint, uint](2, 8, mapSize-1, HashUint)
+	if tracked {
+		m.TrackWrites()
+	}
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			switch a := uint(count.Add(1) - 1); {
+			case a%readRatio == 0:
+				sideEff = m.Size() > mapSize
+			case a&1 == 0:
+				m.Store(a%mapSize, a)
+			default:
+				m.LoadAndDelete(a % mapSize)
+			}
+		}
+	})
+}
+func BenchmarkValUintptr_Size_Untracked(b *testing.B) {
+	benchValUintptrSize(b, false)
+}
+func BenchmarkValUintptr_Size_Tracked(b *testing.B) {
+	benchValUintptrSize(b, true)
+}
+
+// Churn: goroutines add keys and delete them right after, so every store allocates a node unless PoolNodes reuses the nodes of deleted keys.
+
+func benchValUintptrChurn(b *testing.B, pooled bool) {
+	const mapSize = 1 << 16
+	m := fillValUint(b, mapSize/2, mapSize-1)
+	if pooled {
+		m.PoolNodes()
+	}
+	var count atomic.Uintptr
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			a := mapSize/2 + uint(count.Add(1)-1)%(mapSize/2)
+			m.Store(a, a)
+			m.LoadAndDelete(a)
+		}
+	})
+}
+func BenchmarkValUintptr_Churn(b *testing.B) {
+	benchValUintptrChurn(b, false)
+}
+func BenchmarkValUintptr_Churn_Pooled(b *testing.B) {
+	benchValUintptrChurn(b, true)
+}
+
+// Build: a map of shuffled keys is built from scratch, either by Store one key at a time or in bulk by FromSlice and FromSeq.
+
+const buildN = 1 << 20
+
+func buildInput() ([]uint, []uint) {
+	keys := make([]uint, buildN)
+	for i := range keys {
+		keys[i] = uint(i)
+	}
+	rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	return keys, keys
+}
+func BenchmarkValUintptr_Build_Store(b *testing.B) {
+	keys, vals := buildInput()
+	b.ResetTimer()
+	for range b.N {
+		m := Maps.NewValUintptr[uint, uint](2, 8, buildN-1, HashUint)
+		for i, k := range keys {
+			m.Store(k, vals[i])
+		}
+	}
+}
+func BenchmarkValUintptr_Build_FromSlice(b *testing.B) {
+	keys, vals := buildInput()
+	b.ResetTimer()
+	for range b.N {
+		Maps.NewValUintptrFromSlice(2, 8, buildN-1, HashUint, keys, vals)
+	}
+}
+func BenchmarkValUintptr_Build_FromSeq(b *testing.B) {
+	keys, vals := buildInput()
+	b.ResetTimer()
+	for range b.N {
+		Maps.NewValUintptrFromSeq(2, 8, buildN-1, HashUint, func(yield func(uint, uint) bool) {
+			for i, k := range keys {
+				if !yield(k, vals[i]) {
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package cmps
+
+import (
+	"github.com/g-m-twostay/go-utils/Maps"
+	"math"
+	"sync/atomic"
+	"testing"
+)
+
+// Cache: goroutines read through a cache of a quarter of the keys, storing the missed keys. The keys are skewed towards the small ones, which are the ones worth keeping. The maps without a capacity are run with the same reads and stores, growing to hold all keys, as the cost of not bounding the memory.
+
+const cacheCapacity, cacheKeyRange = 1 << 12, 1 << 14
+
+// cacheKey gives the a-th key, which is the product of 2 uniformly scattered numbers so that small keys are more frequent.
+func cacheKey(a uint) uint {
+	x := uint64(a) * 0x9E3779B97F4A7C15
+	return uint((x>>32)%cacheKeyRange*(x&0xFFFFFFFF%cacheKeyRange)) / cacheKeyRange
+}
+
+func BenchmarkCache_ReadThrough(b *testing.B) {
+	var evicted, count atomic.Uintptr
+	m := Maps.NewCache[uint, uint](2, 8, math.MaxUint, hasher.HashUint, cacheCapacity, func(uint, uint) { evicted.Add(1) })
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			k := cacheKey(uint(count.Add(1) - 1))
+			if _, ok := m.Load(k); !ok {
+				m.Store(k, k)
+			}
+		}
+	})
+	b.ReportMetric(float64(evicted.Load())/float64(b.N), "evictions/op")
+}
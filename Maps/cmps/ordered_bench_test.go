@@ -0,0 +1,172 @@
+package cmps
+
+import (
+	"github.com/g-m-twostay/go-utils/Maps"
+	"github.com/g-m-twostay/go-utils/Trees"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// lockedTree is Trees.Tree behind a sync.RWMutex, which is how ordered keys are shared without Maps.Ordered. The tree holds keys only, which saves it the values.
+type lockedTree struct {
+	sync.RWMutex
+	t *Trees.Tree[uint, uint32]
+}
+
+const orderedRange = 1 << 14 //keys are in [0, orderedRange), and half of them are present.
+
+func fillOrdered(b *testing.B) *Maps.Ordered[uint, uint] {
+	b.Helper()
+	m := Maps.NewOrdered[uint, uint]()
+	for i := uint(0); i < orderedRange; i += 2 {
+		m.StorePtr(i, &i)
+	}
+	return m
+}
+func fillLockedTree(b *testing.B) *lockedTree {
+	b.Helper()
+	m := &lockedTree{t: Trees.New[uint, uint32](orderedRange)}
+	for i := uint(0); i < orderedRange; i += 2 {
+		m.t.Add(i, nil)
+	}
+	return m
+}
+
+func BenchmarkOrdered_Load_Balanced(b *testing.B) {
+	m := fillOrdered(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sideEff = m.LoadPtr(uint(count.Add(1)-1)%orderedRange) != nil
+		}
+	})
+}
+func BenchmarkLockedTree_Load_Balanced(b *testing.B) {
+	m := fillLockedTree(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.RLock()
+			sideEff = m.t.Get(uint(count.Add(1)-1)%orderedRange) != nil
+			m.RUnlock()
+		}
+	})
+}
+
+func BenchmarkOrdered_StoreAndDelete(b *testing.B) {
+	m := fillOrdered(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if a := uint(count.Add(1)-1) % orderedRange; a&2 == 0 {
+				m.StorePtr(a, &a)
+			} else {
+				m.Delete(a)
+			}
+		}
+	})
+}
+func BenchmarkLockedTree_StoreAndDelete(b *testing.B) {
+	m := fillLockedTree(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		st := make([]uintptr, 0, 64)
+		for pb.Next() {
+			a := uint(count.Add(1)-1) % orderedRange
+			m.Lock()
+			if a&2 == 0 {
+				_, st = m.t.Add(a, st[:0])
+			} else {
+				_, st = m.t.Del(a, st[:0])
+			}
+			m.Unlock()
+		}
+	})
+}
+
+// Mostly reads: 1 in 16 operations writes.
+func BenchmarkOrdered_Mixed(b *testing.B) {
+	m := fillOrdered(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if a := uint(count.Add(1)-1) % orderedRange; a%16 == 0 {
+				m.StorePtr(a+1, &a)
+			} else if a%16 == 8 {
+				m.Delete(a - 7)
+			} else {
+				_, _, sideEff = m.Ceiling(a)
+			}
+		}
+	})
+}
+func BenchmarkLockedTree_Mixed(b *testing.B) {
+	m := fillLockedTree(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		st := make([]uintptr, 0, 64)
+		for pb.Next() {
+			if a := uint(count.Add(1)-1) % orderedRange; a%16 == 0 {
+				m.Lock()
+				_, st = m.t.Add(a+1, st[:0])
+				m.Unlock()
+			} else if a%16 == 8 {
+				m.Lock()
+				_, st = m.t.Del(a-7, st[:0])
+				m.Unlock()
+			} else {
+				m.RLock()
+				sideEff = m.t.Successor(a, false) != nil
+				m.RUnlock()
+			}
+		}
+	})
+}
+
+// Range queries of 16 keys while 1 in 16 operations writes.
+func BenchmarkOrdered_RangeBetween(b *testing.B) {
+	m := fillOrdered(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if a := uint(count.Add(1)-1) % orderedRange; a%16 == 0 {
+				m.StorePtr(a+1, &a)
+				m.Delete(a + 1)
+			} else {
+				for k := range m.Between(a, a+32) {
+					sideEff = k == 0
+				}
+			}
+		}
+	})
+}
+func BenchmarkLockedTree_RangeBetween(b *testing.B) {
+	m := fillLockedTree(b)
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		st := make([]uintptr, 0, 64)
+		for pb.Next() {
+			if a := uint(count.Add(1)-1) % orderedRange; a%16 == 0 {
+				m.Lock()
+				_, st = m.t.Add(a+1, st[:0])
+				_, st = m.t.Del(a+1, st[:0])
+				m.Unlock()
+			} else {
+				m.RLock()
+				for k := m.t.Successor(a, false); k != nil && *k < a+32; k = m.t.Successor(*k, true) {
+					sideEff = *k == 0
+				}
+				m.RUnlock()
+			}
+		}
+	})
+}
@@ -113,3 +113,16 @@ func BenchmarkSyncMap_Case2(b *testing.B) {
 		}
 	})
 }
+func BenchmarkSyncMap_ReadThrough(b *testing.B) {
+	m := sync.Map{}
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			k := cacheKey(uint(count.Add(1) - 1))
+			if _, ok := m.Load(k); !ok {
+				m.Store(k, k)
+			}
+		}
+	})
+}
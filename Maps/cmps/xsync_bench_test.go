@@ -118,3 +118,16 @@ func BenchmarkXSyncMap_Case2(b *testing.B) {
 		}
 	})
 }
+func BenchmarkXSyncMap_ReadThrough(b *testing.B) {
+	m := xsync.NewMapOf[uint, uint]()
+	var count atomic.Uintptr
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			k := cacheKey(uint(count.Add(1) - 1))
+			if _, ok := m.Load(k); !ok {
+				m.Store(k, k)
+			}
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package Maps
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// The format written by Encode is a header of formatMagic, formatVersion and the kind of the map, followed by the entries in the order of hash. Each entry starts with 1, and the map ends with 0. A key is its length in uvarint followed by its bytes. A value of ValPtr is 0 for nil, or its length plus 1 in uvarint followed by its bytes. A value of ValVal maps is little-endian in the size of the value. Version 1 wrote the size of the values as the kind, so maps of values of the same size could be decoded into each other; it isn't supported.
+const (
+	formatMagic    = "MAPS"
+	formatVersion  = 2
+	encodeBufSize  = 1 << 12 //Encode writes to w in pieces of about this size.
+	decodeReadSize = 1 << 16 //Decode reads a key or value in pieces of at most this size.
+)
+
+// The kinds of maps in the header, one for each type of map, so that a map is only decoded into a map of the same type.
+const (
+	kindValPtr byte = iota
+	kindValUintptr
+	kindValInt
+	kindValUint
+	kindValInt32
+	kindValUint32
+	kindValInt64
+	kindValUint64
+	kindValFloat64
+	kindValBool
+)
+
+// ErrFormat is returned by Decode when the input isn't a map written by Encode of the same kind of map. Errors of a Codec and of the reader are returned as they are.
+var ErrFormat = errors.New("Maps: invalid map encoding")
+
+// Codec converts keys or values of type T to bytes and back for Encode and Decode. Append appends the bytes of v to dst and returns the extended slice. Decode returns the value whose bytes are src; src is only valid during the call, so it must be copied if it's kept.
+type Codec[T any] struct {
+	Append func(dst []byte, v T) []byte
+	Decode func(src []byte) (T, error)
+}
+
+// StringCodec encodes strings as their bytes.
+var StringCodec = Codec[string]{
+	Append: func(dst []byte, s string) []byte { return append(dst, s...) },
+	Decode: func(src []byte) (string, error) { return string(src), nil },
+}
+
+// BytesCodec encodes byte slices as themselves. Nil and empty slices are both decoded as empty slices.
+var BytesCodec = Codec[[]byte]{
+	Append: func(dst []byte, b []byte) []byte { return append(dst, b...) },
+	Decode: func(src []byte) ([]byte, error) { return append([]byte{}, src...), nil },
+}
+
+// IntCodec encodes integers as varints, so small ones take few bytes.
+func IntCodec[T ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr]() Codec[T] {
+	return Codec[T]{
+		Append: func(dst []byte, v T) []byte { return binary.AppendVarint(dst, int64(v)) },
+		Decode: func(src []byte) (T, error) {
+			if x, n := binary.Varint(src); n == len(src) && n > 0 && int64(T(x)) == x {
+				return T(x), nil
+			}
+			return 0, fmt.Errorf("%w: bad integer", ErrFormat)
+		},
+	}
+}
+
+// encoder buffers the encoding of a map and writes it to w, keeping the first error of w.
+type encoder struct {
+	w        io.Writer
+	buf, tmp []byte
+	err      error
+}
+
+func newEncoder(w io.Writer, kind byte) *encoder {
+	e := &encoder{w: w, buf: make([]byte, 0, encodeBufSize+encodeBufSize/2)}
+	e.buf = append(append(e.buf, formatMagic...), formatVersion, kind)
+	return e
+}
+
+// entry starts an entry, writing out what's buffered when it's large.
+func (e *encoder) entry() {
+	if len(e.buf) >= encodeBufSize {
+		e.flush()
+	}
+	e.buf = append(e.buf, 1)
+}
+
+// fixed appends the lowest size bytes of x.
+func (e *encoder) fixed(x uint64, size uintptr) {
+	n := len(e.buf)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, x)[:n+int(size)]
+}
+
+func (e *encoder) flush() {
+	if e.err == nil {
+		_, e.err = e.w.Write(e.buf)
+	}
+	e.buf = e.buf[:0]
+}
+
+// done ends the map and returns the first error of w.
+func (e *encoder) done() error {
+	e.buf = append(e.buf, 0)
+	e.flush()
+	return e.err
+}
+
+// encodeField appends the bytes of v by c, preceded by their length plus off.
+func encodeField[T any](e *encoder, c Codec[T], v T, off uint64) {
+	e.tmp = c.Append(e.tmp[:0], v)
+	e.buf = append(binary.AppendUvarint(e.buf, uint64(len(e.tmp))+off), e.tmp...)
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// decoder reads the encoding of a map. buf holds the last field read.
+type decoder struct {
+	r   byteReader
+	buf []byte
+}
+
+// newDecoder reads the header from r and checks that it's of the current version and kind. r is read a byte at a time, so it's buffered unless it's an io.ByteReader already.
+func newDecoder(r io.Reader, kind byte) (*decoder, error) {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	d := &decoder{r: br}
+	header, err := d.field(uint64(len(formatMagic) + 2))
+	if err != nil {
+		return nil, err
+	} else if string(header[:len(formatMagic)]) != formatMagic {
+		return nil, fmt.Errorf("%w: not an encoded map", ErrFormat)
+	} else if version := header[len(formatMagic)]; version != formatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFormat, version)
+	} else if got := header[len(formatMagic)+1]; got != kind {
+		return nil, fmt.Errorf("%w: map of kind %d instead of %d", ErrFormat, got, kind)
+	}
+	return d, nil
+}
+
+// unexpected turns reaching the end of r before the end of the map into ErrFormat.
+func unexpected(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(d.r)
+	return x, unexpected(err)
+}
+
+// field reads n bytes into buf. A corrupt n can't make it allocate much more than what r has, since buf grows by at most decodeReadSize at a time.
+func (d *decoder) field(n uint64) ([]byte, error) {
+	d.buf = d.buf[:0]
+	for n > 0 {
+		read := int(min(n, decodeReadSize))
+		d.buf = slices.Grow(d.buf, read)
+		if _, err := io.ReadFull(d.r, d.buf[len(d.buf):len(d.buf)+read]); err != nil {
+			return nil, unexpected(err)
+		}
+		d.buf, n = d.buf[:len(d.buf)+read], n-uint64(read)
+	}
+	return d.buf, nil
+}
+
+// fixed reads a value of size bytes written by encoder.fixed.
+func (d *decoder) fixed(size uintptr) (uint64, error) {
+	b, err := d.field(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var x [8]byte
+	copy(x[:], b)
+	return binary.LittleEndian.Uint64(x[:]), nil
+}
+
+// decodeField reads a field of n bytes and decodes it by c.
+func decodeField[T any](d *decoder, c Codec[T], n uint64) (T, error) {
+	b, err := d.field(n)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.Decode(b)
+}
+
+// decodeEntries reads the entries of a map until its end, decoding keys by keys and values by val, which reads the rest of an entry after its key.
+func decodeEntries[K any, V any](d *decoder, keys Codec[K], val func(d *decoder) (V, error)) (ks []K, vs []V, err error) {
+	for {
+		switch tag, err := d.r.ReadByte(); {
+		case err != nil:
+			return nil, nil, unexpected(err)
+		case tag == 0:
+			return ks, vs, nil
+		case tag != 1:
+			return nil, nil, fmt.Errorf("%w: bad entry tag %d", ErrFormat, tag)
+		}
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, nil, err
+		}
+		k, err := decodeField(d, keys, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := val(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		ks, vs = append(ks, k), append(vs, v)
+	}
+}
@@ -0,0 +1,164 @@
+package Maps
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestValPtr_Encode(t *testing.T) {
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := testVPT(0); i < testAddN; i += 3 { //leave buckets empty at the end, which must still get relays when decoded.
+		v := i
+		if i%2 == 0 {
+			mq.StorePtr(i, &v)
+		} else {
+			mq.StorePtr(i, nil)
+		}
+	}
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, IntCodec[testVPT](), IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	decoded := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	decoded.TrackWrites()
+	old := testVPT(1)
+	decoded.StorePtr(1, &old)
+	if err := decoded.Decode(bytes.NewReader(encoded), IntCodec[testVPT](), IntCodec[testVPT]()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size() != mq.Size() {
+		t.Fatal("wrong size", decoded.Size(), mq.Size())
+	}
+	for i := range testVPT(testAddN) {
+		if v, ok := decoded.LoadPtr(i), decoded.Has(i); ok != (i%3 == 0) || ok && (v != nil) != (i%2 == 0) || v != nil && *v != i {
+			t.Fatal("wrong load", i, v)
+		}
+	}
+	for i := range testVPT(testAddN) {
+		v := i
+		if decoded.StorePtr(i, &v) != (i%3 != 0) || !decoded.Delete(i) {
+			t.Fatal("wrong store after decoding", i)
+		}
+	}
+	if decoded.Size() != 0 {
+		t.Fatal("wrong size after deleting", decoded.Size())
+	}
+
+	for name, r := range map[string][]byte{
+		"truncated": encoded[:len(encoded)/2],
+		"magic":     append([]byte("SPAM"), encoded[4:]...),
+		"version":   append([]byte("MAPS\x01"), encoded[5:]...),
+		"kind":      append([]byte("MAPS\x02\x04"), encoded[6:]...),
+		"duplicate": []byte("MAPS\x02\x00\x01\x01\x00\x00\x01\x01\x00\x00\x00"), //key 0 with nil value twice.
+		"tag":       append(append([]byte{}, encoded[:len(encoded)-1]...), 2),
+	} {
+		kept := testVPT(0)
+		decoded.StorePtr(0, &kept)
+		if err := decoded.Decode(bytes.NewReader(r), IntCodec[testVPT](), IntCodec[testVPT]()); !errors.Is(err, ErrFormat) {
+			t.Fatal(name, "wrong error", err)
+		} else if decoded.LoadPtr(0) != &kept || decoded.Size() != 1 {
+			t.Fatal(name, "changed by failed decode")
+		}
+	}
+}
+
+func TestValUintptr_Encode(t *testing.T) {
+	mq := NewValInt32[string, int32](testMinBSz, testMaxBSz, 1<<11, func(s string) uint { return uint(len(s))<<8 | uint(s[0]) }) //many keys of the same hash.
+	for i := range testAddNEach {
+		mq.Store(strconv.Itoa(i), -int32(i))
+	}
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, StringCodec); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewValInt64[string, int64](testMinBSz, testMaxBSz, 1<<11, mq.HashF).Decode(bytes.NewReader(buf.Bytes()), StringCodec); !errors.Is(err, ErrFormat) {
+		t.Fatal("decoded values of another size", err)
+	}
+	if err := NewValUint32[string, uint32](testMinBSz, testMaxBSz, 1<<11, mq.HashF).Decode(bytes.NewReader(buf.Bytes()), StringCodec); !errors.Is(err, ErrFormat) {
+		t.Fatal("decoded values of another type of the same size", err)
+	}
+	if err := NewValBool[string, bool](testMinBSz, testMaxBSz, 1<<11, mq.HashF).Decode(bytes.NewReader(buf.Bytes()), StringCodec); !errors.Is(err, ErrFormat) {
+		t.Fatal("decoded values of another type of the same size", err)
+	}
+	decoded := NewValInt32[string, int32](testMinBSz, testMaxBSz, 1<<11, mq.HashF)
+	if err := decoded.Decode(&buf, StringCodec); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size() != testAddNEach {
+		t.Fatal("wrong size", decoded.Size())
+	}
+	for k, v := range mq.Range {
+		if got, ok := decoded.Load(k); !ok || got != v {
+			t.Fatal("wrong load", k, got, v)
+		}
+	}
+}
+
+func FuzzValPtr_Decode(f *testing.F) {
+	mq := NewValPtrFor[string, []byte](testMinBSz, testMaxBSz)
+	for _, k := range []string{"", "a", "bc", "def"} {
+		v := []byte(k + k)
+		mq.StorePtr(k, &v)
+	}
+	mq.StorePtr("nil", nil)
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, StringCodec, BytesCodec); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add([]byte("MAPS\x02\x00\x01\xff\xff\xff\xff\x0f"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		decoded := NewValPtrFor[string, []byte](testMinBSz, testMaxBSz)
+		if err := decoded.Decode(bytes.NewReader(b), StringCodec, BytesCodec); err != nil {
+			if decoded.Size() != 0 {
+				t.Fatal("changed by failed decode", err)
+			}
+			return
+		}
+		n := uint(0)
+		for k, v := range decoded.Range {
+			if decoded.LoadPtr(k) != v {
+				t.Fatal("wrong load", k)
+			}
+			n++
+		}
+		if n != decoded.Size() {
+			t.Fatal("wrong size", n, decoded.Size())
+		}
+		decoded.Clear()
+	})
+}
+
+func FuzzValUintptr_Decode(f *testing.F) {
+	mq := NewValUintptr[testVPT, uintptr](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	for i := range testVPT(testMaxBSz * 4) {
+		mq.Store(i, uintptr(i))
+	}
+	var buf bytes.Buffer
+	if err := mq.Encode(&buf, IntCodec[testVPT]()); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, b []byte) {
+		decoded := NewValUintptr[testVPT, uintptr](testMinBSz, testMaxBSz, testMaxHash, func(k testVPT) uint { return testHashF(k) % (testMaxHash + 1) })
+		if err := decoded.Decode(bytes.NewReader(b), IntCodec[testVPT]()); err != nil {
+			return
+		}
+		n := uint(0)
+		for k, v := range decoded.Range {
+			if got, ok := decoded.Load(k); !ok || got != v {
+				t.Fatal("wrong load", k)
+			}
+			n++
+		}
+		if n != decoded.Size() {
+			t.Fatal("wrong size", n, decoded.Size())
+		}
+		for k := range testVPT(testMaxBSz * 8) {
+			decoded.Store(k, 0)
+		}
+	})
+}
@@ -10,9 +10,19 @@ const (
 type evictStack struct {
 	vs         [deqSize]unsafe.Pointer
 	head, tail byte
+	runs       bool //whether runs are counted, which is only needed by DetectCollisions, so other pushes don't read the hash.
+	runHash    uint
+	run        uint //number of nodes of runHash pushed in a row, which is the length of the run of equal hashes crossed by an insert, give or take a node when backtracking.
 }
 
 func (es *evictStack) Push(v unsafe.Pointer) {
+	if es.runs {
+		if hash := (*relay)(v).hash; hash == es.runHash {
+			es.run++
+		} else {
+			es.runHash, es.run = hash, 1
+		}
+	}
 	es.vs[es.head&(deqSize-1)] = v
 	es.head++
 	if es.head-es.tail > deqSize {
@@ -3,24 +3,58 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"go/format"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-func newImplR(typeName, fTypeName string) *strings.Replacer {
+// variant describes how a value type is kept in valNode. Values of raw are accessed by the atomic functions named after atomic. toRaw and fromRaw convert between V and raw; they're plain conversions unless the values are kept as bits.
+type variant struct {
+	raw, atomic    string
+	toRaw, fromRaw string
+	add            string //function that adds to *raw and returns the sum.
+	blocks         []string
+}
+
+// variants are keyed by value type. Parts of the templates between //gen:block and //gen:end are kept only by the variants with block in blocks: ptr is LoadPtr, cas are the tests of CompareAndSwap and CompareAndDelete by the old value, which ValAny takes a function for instead, add is Add, bitwise are And and Or, pool is PoolNodes, and observe are OnChange and Watch. Tests generated for maps implemented by hand keep none of them.
+var variants = map[string]variant{
+	"int64":   {raw: "int64", atomic: "Int64", blocks: []string{"ptr", "cas", "add", "pool", "observe"}},
+	"uint64":  {raw: "uint64", atomic: "Uint64", blocks: []string{"ptr", "cas", "add", "bitwise", "pool", "observe"}},
+	"int32":   {raw: "int32", atomic: "Int32", blocks: []string{"ptr", "cas", "add", "pool", "observe"}},
+	"uint32":  {raw: "uint32", atomic: "Uint32", blocks: []string{"ptr", "cas", "add", "bitwise", "pool", "observe"}},
+	"int":     {raw: "uintptr", atomic: "Uintptr", blocks: []string{"ptr", "cas", "add", "pool", "observe"}},
+	"uint":    {raw: "uintptr", atomic: "Uintptr", blocks: []string{"ptr", "cas", "add", "bitwise", "pool", "observe"}},
+	"float64": {raw: "uint64", atomic: "Uint64", toRaw: "float64Bits", fromRaw: "fromFloat64Bits[V]", add: "addFloat64", blocks: []string{"ptr", "cas", "add", "pool", "observe"}},
+	"bool":    {raw: "uint32", atomic: "Uint32", toRaw: "boolBits", fromRaw: "fromBoolBits[V]", blocks: []string{"cas", "pool", "observe"}}, //a pointer to the bits isn't a *bool.
+}
+
+func newImplR(typeName, fTypeName string, v variant) *strings.Replacer {
+	toRaw, fromRaw, add := v.raw, "V", "atomic.Add"+v.atomic
+	if v.toRaw != "" {
+		toRaw, fromRaw = v.toRaw, v.fromRaw
+	}
+	if v.add != "" {
+		add = v.add
+	}
 	return strings.NewReplacer(
 		"~uintptr | ~uint | ~int", "~"+typeName,
-		".LoadUintptr", ".Load"+fTypeName,
-		".StoreUintptr", ".Store"+fTypeName,
-		".SwapUintptr", ".Swap"+fTypeName,
-		".CompareAndSwapUintptr", ".CompareAndSwap"+fTypeName,
+		"atomic.AddUintptr", add,
+		".LoadUintptr", ".Load"+v.atomic,
+		".StoreUintptr", ".Store"+v.atomic,
+		".SwapUintptr", ".Swap"+v.atomic,
+		".CompareAndSwapUintptr", ".CompareAndSwap"+v.atomic,
+		".AndUintptr", ".And"+v.atomic,
+		".OrUintptr", ".Or"+v.atomic,
 		"NewValUintptr", "NewVal"+fTypeName,
 		"ValUintptr", "Val"+fTypeName,
-		"valNode[K, uintptr]", "valNode[K, "+typeName+"]",
-		"uintptr /*typeCast*/", typeName,
+		"valNode[K, uintptr]", "valNode[K, "+v.raw+"]",
+		"uintptr /*typeCast*/", toRaw,
+		"uintptr /*rawType*/", v.raw,
+		"V /*rawCast*/", fromRaw,
 	)
 }
 func newTestR(typeName, fTypeName string) *strings.Replacer {
@@ -28,17 +62,41 @@ func newTestR(typeName, fTypeName string) *strings.Replacer {
 		"TestValUintptr_", "TestVal"+fTypeName+"_",
 		"testVUintptrT uintptr", fmt.Sprintf("testV%sT %s", fTypeName, typeName),
 		"NewValUintptr", "NewVal"+fTypeName,
+		"ValUintptrSnapshot", "Val"+fTypeName+"Snapshot",
 		"testVUintptrT", fmt.Sprintf("testV%sT", fTypeName),
 	)
 }
 
+// keepBlocks removes the blocks of tmpl that aren't in blocks, along with all the markers.
+func keepBlocks(tmpl string, blocks []string) string {
+	var b strings.Builder
+	dropping := false
+	for _, line := range strings.SplitAfter(tmpl, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "//gen:"); !ok {
+			if !dropping {
+				b.WriteString(line)
+			}
+		} else if name == "end" {
+			dropping = false
+		} else {
+			dropping = true
+			for _, kept := range blocks {
+				dropping = dropping && kept != name
+			}
+		}
+	}
+	return b.String()
+}
+
 var (
 	implTmplPath, testTmplPath string
+	verify                     bool
 )
 
 func init() {
 	flag.StringVar(&implTmplPath, "implTmpl", "", "implementation template file path")
 	flag.StringVar(&testTmplPath, "testTmpl", "", "test template file path")
+	flag.BoolVar(&verify, "verify", os.Getenv("MAPS_GEN_VERIFY") != "", "report the generated files that differ from the templates instead of writing them; MAPS_GEN_VERIFY sets it for go generate")
 }
 
 const (
@@ -47,53 +105,70 @@ const (
 `
 )
 
-func main() {
-	wd, err := os.Getwd()
+// output formats src and writes it to path, or only compares it with path when verifying, reporting whether path is up to date.
+func output(path string, src string) bool {
+	formatted, err := format.Source([]byte(header + src))
 	if err != nil {
-		panic(err)
+		panic(fmt.Errorf("%s: %w", path, err))
 	}
-
-	flag.Parse()
-	implTmplPath = filepath.Join(wd, implTmplPath)
-	testTmplPath = filepath.Join(wd, testTmplPath)
-
-	implTmpl, err := os.ReadFile(implTmplPath)
-	if err != nil {
+	if verify {
+		old, err := os.ReadFile(path)
+		return err == nil && bytes.Equal(old, formatted)
+	}
+	if err = os.WriteFile(path, formatted, 0666); err != nil {
 		panic(err)
 	}
-	testTmpl, err := os.ReadFile(testTmplPath)
+	return true
+}
+
+func main() {
+	wd, err := os.Getwd()
 	if err != nil {
 		panic(err)
 	}
 
-	for _, tn := range flag.Args() {
-		ftn := strings.ToUpper(tn[:1]) + tn[1:]
-
-		genImpl, err := os.OpenFile(filepath.Join(wd, "Val"+ftn+".go"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
-		if err != nil {
+	flag.Parse()
+	var implTmpl, testTmpl []byte
+	if implTmplPath != "" { //without an implementation template, only the tests are generated for maps that are implemented by hand.
+		if implTmpl, err = os.ReadFile(filepath.Join(wd, implTmplPath)); err != nil {
 			panic(err)
 		}
-		genTest, err := os.OpenFile(filepath.Join(wd, "Val"+ftn+"_test.go"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
-		if err != nil {
+	}
+	if testTmplPath != "" { //without a test template, the tests are written by hand.
+		if testTmpl, err = os.ReadFile(filepath.Join(wd, testTmplPath)); err != nil {
 			panic(err)
 		}
+	}
 
-		if _, err = genImpl.WriteString(header); err != nil {
-			panic(err)
-		}
-		if _, err = genTest.WriteString(header); err != nil {
-			panic(err)
+	var stale []string
+	for _, tn := range flag.Args() {
+		ftn := strings.ToUpper(tn[:1]) + tn[1:]
+		if name, typeName, ok := strings.Cut(tn, "="); ok { //Name=type uses a map name that's different from the value type.
+			ftn, tn = name, typeName
 		}
 
-		implR, testR := newImplR(tn, ftn), newTestR(tn, ftn)
-		if _, err = implR.WriteString(genImpl, string(implTmpl)); err != nil {
-			panic(err)
+		var blocks []string
+		if implTmpl != nil {
+			v, ok := variants[tn]
+			if !ok {
+				panic("no variant for " + tn)
+			}
+			if path := filepath.Join(wd, "Val"+ftn+".go"); !output(path, newImplR(tn, ftn, v).Replace(keepBlocks(string(implTmpl), v.blocks))) {
+				stale = append(stale, path)
+			}
+			blocks = v.blocks
 		}
-		if _, err = testR.WriteString(genTest, string(testTmpl)); err != nil {
-			panic(err)
+		if testTmpl != nil {
+			if path := filepath.Join(wd, "Val"+ftn+"_test.go"); !output(path, newTestR(tn, ftn).Replace(keepBlocks(string(testTmpl), blocks))) {
+				stale = append(stale, path)
+			}
 		}
-
-		genImpl.Close()
-		genTest.Close()
+	}
+	if len(stale) > 0 {
+		fmt.Fprintln(os.Stderr, "generated files are stale, run go generate:")
+		for _, path := range stale {
+			fmt.Fprintln(os.Stderr, "\t"+path)
+		}
+		os.Exit(1)
 	}
 }
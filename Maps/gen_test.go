@@ -0,0 +1,18 @@
+package Maps
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestGenerated(t *testing.T) { //the generated files must match their templates.
+	if testing.Short() {
+		t.Skip("runs go generate")
+	}
+	cmd := exec.Command("go", "generate", ".")
+	cmd.Env = append(os.Environ(), "MAPS_GEN_VERIFY=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatal(string(out))
+	}
+}
@@ -0,0 +1,138 @@
+package Maps
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
+
+// HashFor picks a hash function for K by its kind and returns it with the maxHash to use with it. Keys of at most 16 bits hash to themselves, so maxHash is exact and every bucket gets the same number of keys. Strings and other keys that are compared by their memory, such as integers, pointers, and arrays or structs of them without padding, use a seeded hash over the whole range of uint. Each call uses a new seed.
+//
+// It panics for keys without a built-in hash, such as floats, whose +0 and -0 are equal but differ in memory, interfaces, and structs with padding or such fields; give those a hashF, wrapped in BoundHash if it's poorly distributed.
+func HashFor[K comparable]() (hashF func(K) uint, maxHash uint) {
+	t := reflect.TypeFor[K]()
+	if t.Kind() == reflect.String {
+		seed := maphash.MakeSeed()
+		return func(k K) uint {
+			return uint(maphash.String(seed, *(*string)(unsafe.Pointer(&k))))
+		}, math.MaxUint
+	} else if !plainMemory(t) {
+		panic("Maps: no built-in hash for " + t.String())
+	}
+	switch seed := rand.Uint64(); t.Size() {
+	case 0:
+		return func(K) uint { return 0 }, 0
+	case 1:
+		return func(k K) uint { return uint(*(*uint8)(unsafe.Pointer(&k))) }, math.MaxUint8
+	case 2:
+		return func(k K) uint { return uint(*(*uint16)(unsafe.Pointer(&k))) }, math.MaxUint16
+	case 4:
+		return func(k K) uint { return uint(mix(uint64(*(*uint32)(unsafe.Pointer(&k))) ^ seed)) }, math.MaxUint
+	case 8:
+		return func(k K) uint { return uint(mix(*(*uint64)(unsafe.Pointer(&k)) ^ seed)) }, math.MaxUint
+	default:
+		mapSeed := maphash.MakeSeed()
+		return func(k K) uint {
+			return uint(maphash.Bytes(mapSeed, unsafe.Slice((*byte)(unsafe.Pointer(&k)), unsafe.Sizeof(k))))
+		}, math.MaxUint
+	}
+}
+
+// plainMemory reports whether values of t are equal exactly when their memory is.
+func plainMemory(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		return true
+	case reflect.Array:
+		return plainMemory(t.Elem())
+	case reflect.Struct:
+		size := uintptr(0)
+		for i := range t.NumField() {
+			if f := t.Field(i); f.Name == "_" || !plainMemory(f.Type) { //blank fields are ignored by ==.
+				return false
+			} else {
+				size += f.Type.Size()
+			}
+		}
+		return size == t.Size() //no padding.
+	}
+	return false
+}
+
+// mix is the finalizer of MurmurHash3. It's a bijection that spreads every bit of x over the result.
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// BoundHash wraps hashF so that it returns hashes evenly spread in [0, maxHash], which makes any hashF fit a map with maxHash. hashF is mixed first, so hashes that differ only in a few bits, such as multiples of a power of 2, are spread as well.
+func BoundHash[K any](hashF func(K) uint, maxHash uint) func(K) uint {
+	if maxHash == math.MaxUint {
+		return func(k K) uint {
+			return uint(mix(uint64(hashF(k))))
+		}
+	}
+	return func(k K) uint {
+		hi, _ := bits.Mul(uint(mix(uint64(hashF(k)))), maxHash+1) //the high half of the product is in [0, maxHash+1).
+		return hi
+	}
+}
+
+// Seeded binds a random seed to hashF, which takes the seed as its first argument like the methods of Hasher in the root package: Seeded(Go_Utils.Hasher.HashString) hashes strings by a seed of its own. Keys that collide under one seed are spread by another, so a map given its own Seeded hashF can't be slowed down by keys chosen to share a hash, such as HTTP headers sent by an attacker. A hashF without a seed can't be seeded afterward, since keys of equal hashes stay equal however the hashes are mixed.
+// The hashes are in the whole range of uint, so maxHash is math.MaxUint, unless they're wrapped in BoundHash. SeedHash does the same for a map that's already made.
+func Seeded[S ~uint, K any](hashF func(S, K) uint) func(K) uint {
+	seed := S(rand.Uint())
+	return func(k K) uint {
+		return hashF(seed, k)
+	}
+}
+
+// seedable is every map built on base, whose HashF SeedHash replaces.
+type seedable[K any] interface {
+	hashed() *base[K]
+}
+
+func (vp *base[K]) hashed() *base[K] {
+	return vp
+}
+
+// SeedHash gives m a random seed of its own, which is passed to hashF as its first argument to hash every key of m, like the methods of Hasher in the root package: SeedHash(m, Go_Utils.Hasher.HashString). The hashes are bound by BoundHash to the maxHash m is made with, so m can be made with any maxHash. It replaces the HashF m is made with, so it must be called before m is used.
+// The seed is a random uint, which is what a Hasher is, rather than drawn by the root package itself, since it links to the hash functions of the runtime and can't be imported without -checklinkname=0.
+func SeedHash[S ~uint, K any](m seedable[K], hashF func(S, K) uint) {
+	vp := m.hashed()
+	if maxHash := uint(1)<<vp.maxLogChunkSize - 1; maxHash != math.MaxUint {
+		vp.HashF = BoundHash(Seeded(hashF), maxHash)
+	} else {
+		vp.HashF = Seeded(hashF)
+	}
+}
+
+// collisionDetector is set by DetectCollisions.
+type collisionDetector struct {
+	limit  uint
+	report func(hash, run uint)
+	count  atomic.Uint64 //reported by Stats.
+}
+
+func (c *collisionDetector) found(hash, run uint) {
+	c.count.Add(1)
+	if c.report != nil {
+		c.report(hash, run)
+	}
+}
+
+// DetectCollisions makes inserts count the keys of their hash that they pass, which every later operation on those keys passes as well. When an insert passes more than limit keys, report is called with the hash and the number of keys, and the insert is counted in Stats.Collisions. report can be nil to only count them; otherwise it's called by the inserting goroutine after the key is added, so it should be short. A map that finds collisions can be rebuilt from its keys with a hashF seeded by SeedHash.
+// It must be called before the map is used concurrently. Multi doesn't count collisions, since the values of a key are linked by its hash.
+func (vp *base[K]) DetectCollisions(limit uint, report func(hash, run uint)) {
+	vp.collisions = &collisionDetector{limit: limit, report: report}
+}
@@ -0,0 +1,173 @@
+package Maps
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// testBucketSizes counts the keys in each bucket of vp.
+func testBucketSizes[K any](vp *base[K]) []int {
+	sizes := make([]int, 1<<(vp.maxLogChunkSize-vp.buckets.logChunkSize))
+	for i := range sizes {
+		for cur := vp.buckets.Fetch(uint(i)).walk(); cur != nil && !isRelay(cur); cur = (*relay)(addr(cur)).walk() {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// testDispersion stores keys to a map made by NewValPtrFor and checks that the variance of bucket sizes isn't much larger than their mean, which is what a uniform hash gives.
+func testDispersion[K comparable](t *testing.T, name string, keys []K, hashF func(K) uint, maxHash uint) {
+	t.Helper()
+	mq := NewValPtr[K, K](testMinBSz, testMaxBSz, maxHash, hashF)
+	for i := range keys {
+		mq.StorePtr(keys[i], &keys[i])
+	}
+	if mq.Size() != uint(len(keys)) {
+		t.Fatal(name, "keys collide", mq.Size())
+	}
+	sizes := testBucketSizes(&mq.base)
+	mean, variance := float64(len(keys))/float64(len(sizes)), 0.
+	for _, s := range sizes {
+		variance += (float64(s) - mean) * (float64(s) - mean)
+	}
+	if variance /= float64(len(sizes)); len(sizes) < 1<<8 || variance > mean*1.5 {
+		t.Fatal(name, "uneven buckets", len(sizes), mean, variance)
+	}
+}
+
+func testKeys[K any](f func(i int) K) []K {
+	keys := make([]K, testAddN)
+	for i := range keys {
+		keys[i] = f(i)
+	}
+	return keys
+}
+
+func TestHashFor_Distribution(t *testing.T) {
+	type pair struct {
+		a int32
+		b uint32
+	}
+	f0, m0 := HashFor[int]()
+	testDispersion(t, "int", testKeys(func(i int) int { return i << 12 }), f0, m0) //only the high bits differ.
+	f1, m1 := HashFor[uint32]()
+	testDispersion(t, "uint32", testKeys(func(i int) uint32 { return uint32(i) }), f1, m1)
+	f2, m2 := HashFor[string]()
+	testDispersion(t, "string", testKeys(strconv.Itoa), f2, m2)
+	f3, m3 := HashFor[[2]uint64]()
+	testDispersion(t, "array", testKeys(func(i int) [2]uint64 { return [2]uint64{uint64(i), 1} }), f3, m3)
+	f4, m4 := HashFor[pair]()
+	testDispersion(t, "struct", testKeys(func(i int) pair { return pair{int32(i), uint32(-i)} }), f4, m4)
+	f5, m5 := HashFor[uint16]()
+	if m5 != math.MaxUint16 {
+		t.Fatal("maxHash of uint16 isn't exact", m5)
+	}
+	testDispersion(t, "uint16", testKeys(func(i int) uint16 { return uint16(i) }), f5, m5)
+
+	mq := NewValPtrFor[string, int](testMinBSz, testMaxBSz)
+	v := 1
+	if !mq.StorePtr("a", &v) || mq.LoadPtr("a") != &v || mq.HashF("b") == mq.HashF("c") {
+		t.Fatal("wrong NewValPtrFor")
+	}
+}
+
+func TestHashFor_Panics(t *testing.T) {
+	for name, f := range map[string]func(){
+		"float":     func() { HashFor[float64]() },
+		"interface": func() { HashFor[any]() },
+		"padding": func() {
+			HashFor[struct {
+				a int8
+				b int64
+			}]()
+		},
+		"string field": func() {
+			HashFor[struct {
+				a string
+			}]()
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal(name, "should panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestBoundHash(t *testing.T) {
+	const maxHash = 1<<16 - 1
+	poor := func(k int) uint { return uint(k) << 20 } //every hash is out of range and the low bits are 0.
+	bounded := BoundHash(poor, maxHash)
+	for i := range testAddN {
+		if bounded(i) > maxHash {
+			t.Fatal("out of range", i, bounded(i))
+		}
+	}
+	testDispersion(t, "bounded", testKeys(func(i int) int { return i }), bounded, maxHash)
+	testDispersion(t, "unbounded", testKeys(func(i int) int { return i }), BoundHash(poor, math.MaxUint), math.MaxUint)
+}
+
+// testWeakHash is a 16 bit seeded hash, so keys colliding under a seed are easy to find.
+func testWeakHash(seed uint, k uint) uint {
+	return uint(mix(uint64(k^seed)) >> 48)
+}
+
+// testCollidingKeys finds n keys whose testWeakHash is 0 under the seed 0, like an attacker who knows the hash function.
+func testCollidingKeys(n int) []uint {
+	keys := make([]uint, 0, n)
+	for k := uint(0); len(keys) < n; k++ {
+		if testWeakHash(0, k) == 0 {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestSeeded(t *testing.T) {
+	const maxHash, limit = 1<<16 - 1, 8
+	keys := testCollidingKeys(1 << 6)
+	for name, hashF := range map[string]func(uint) uint{
+		"unseeded": func(k uint) uint { return testWeakHash(0, k) },
+		"seeded":   Seeded(testWeakHash),
+		"SeedHash": nil,
+	} {
+		var reported []uint
+		mu := sync.Mutex{}
+		mq := NewValPtr[uint, uint](testMinBSz, testMaxBSz, maxHash, hashF)
+		if hashF == nil {
+			SeedHash(mq, testWeakHash)
+		}
+		mq.DetectCollisions(limit, func(hash, run uint) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, run)
+		})
+		for i := range keys {
+			mq.StorePtr(keys[i], &keys[i])
+		}
+		if s := mq.Stats(); name == "unseeded" && (s.LongestRun != uint(len(keys)) || s.Collisions != uint64(len(keys)-limit-1) || len(reported) != len(keys)-limit-1 || reported[0] != limit+1) {
+			t.Fatal("collisions not detected", s.LongestRun, s.Collisions, reported)
+		} else if name != "unseeded" && (s.LongestRun >= limit || s.Collisions != 0 || len(reported) != 0) {
+			t.Fatal("seed not applied", s.LongestRun, s.Collisions, reported)
+		}
+	}
+	a, b := Seeded(testWeakHash), Seeded(testWeakHash)
+	same := 0
+	for k := range uint(1 << 8) {
+		if a(k) != a(k) {
+			t.Fatal("inconsistent hash", k)
+		} else if a(k) == b(k) {
+			same++
+		}
+	}
+	if same > 1<<4 {
+		t.Fatal("seeds aren't random", same)
+	}
+}
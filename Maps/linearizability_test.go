@@ -0,0 +1,664 @@
+package Maps
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type linOp byte
+
+const (
+	linLoad linOp = iota
+	linStore
+	linDelete
+	linLoadOrStore
+	linSwap
+	linCAS
+	linCAD
+	linAdd
+	linRemove
+	linCompute
+	linUpdate
+	linClear
+	linSnapshot
+)
+
+var linOpNames = [...]string{"Load", "Store", "Delete", "LoadOrStore", "Swap", "CAS", "CAD", "Add", "Remove", "Compute", "Update", "Clear", "Snapshot"}
+
+// linEvent is an operation in a history with its arguments, its results, and the times it was called and returned. CAS swaps arg for arg2, and CAD deletes arg. Compute stores arg to an absent key, deletes arg, and replaces other values with arg2; Update is Compute that keeps arg instead of deleting it. Clear and Snapshot are of all keys, so they are put in the history of every key, where Snapshot is a load of the key.
+type linEvent struct {
+	op        linOp
+	key       testVPT
+	arg, arg2 int
+	val       int
+	ok        bool
+	res       CASResult
+	all       []linState //the results of Snapshot by key.
+	call, ret int64
+}
+
+func (e linEvent) String() string {
+	return fmt.Sprintf("[%d,%d] %s(%d, %d, %d) = %d, %t, %d", e.call, e.ret, linOpNames[e.op], e.key, e.arg, e.arg2, e.val, e.ok, e.res)
+}
+
+// linState is a key in the sequential model of a map.
+type linState struct {
+	val     int
+	present bool
+}
+
+// step performs e on s in the sequential model, reporting whether the results of e are the ones of the model.
+func (e *linEvent) step(s linState) (linState, bool) {
+	switch e.op {
+	case linLoad, linSnapshot:
+		return s, e.ok == s.present && (!e.ok || e.val == s.val)
+	case linStore:
+		return linState{e.arg, true}, e.ok != s.present
+	case linDelete:
+		return linState{}, e.ok == s.present && (!e.ok || e.val == s.val)
+	case linRemove:
+		return linState{}, e.ok == s.present
+	case linClear:
+		return linState{}, true
+	case linLoadOrStore:
+		if s.present {
+			return s, e.ok && e.val == s.val
+		}
+		return linState{e.arg, true}, !e.ok
+	case linSwap:
+		if s.present {
+			return linState{e.arg, true}, e.ok && e.val == s.val
+		}
+		return s, !e.ok
+	case linCAS, linCAD:
+		if !s.present {
+			return s, e.res == NULL
+		} else if s.val != e.arg {
+			return s, e.res == FAILED
+		} else if e.op == linCAS {
+			return linState{e.arg2, true}, e.res == SUCCESS
+		}
+		return linState{}, e.res == SUCCESS
+	case linCompute, linUpdate:
+		if !s.present {
+			return linState{e.arg, true}, e.ok && e.val == e.arg
+		} else if s.val != e.arg {
+			return linState{e.arg2, true}, e.ok && e.val == e.arg2
+		} else if e.op == linUpdate {
+			return s, e.ok && e.val == s.val
+		}
+		return linState{}, !e.ok
+	default: //linAdd
+		if s.present {
+			return linState{s.val + e.arg, true}, e.ok && e.val == s.val+e.arg
+		}
+		return linState{e.arg, true}, !e.ok && e.val == e.arg
+	}
+}
+
+// linearizable reports whether the events of a key can each take effect at a moment between its call and return, so that the results are the ones of the sequential model starting from an absent key. Maps are linearizable exactly when the events of every key are, since every operation reads or writes 1 key, except Clear and Snapshot, which are checked only to take effect on each key at a moment of its own.
+// It's the search of Wing and Gong with the cache of Lowe: the calls and returns are kept in a list ordered by time, and a call is linearized by removing it and its return from the list when the model agrees with its results. Reaching a return means the call of it can't be linearized in any order tried so far, so the last linearized call is put back and the next one is tried. The cache keeps the sets of linearized calls with the state they lead to, which are never tried twice.
+func linearizable(events []linEvent) bool {
+	type entry struct {
+		event      int
+		call       bool
+		match      int //the return of a call.
+		prev, next int
+	}
+	entries := make([]entry, 1, 2*len(events)+1) //entries[0] is the head of the list.
+	for i := range events {
+		entries = append(entries, entry{event: i, call: true}, entry{event: i})
+	}
+	slices.SortFunc(entries[1:], func(a, b entry) int {
+		return int(linTime(events[a.event], a.call) - linTime(events[b.event], b.call))
+	})
+	calls := make([]int, len(events))
+	for i := range entries {
+		entries[i].prev, entries[i].next = i-1, i+1
+		if i > 0 && entries[i].call {
+			calls[entries[i].event] = i
+		} else if i > 0 {
+			entries[calls[entries[i].event]].match = i
+		}
+	}
+	entries[len(entries)-1].next = -1
+	unlink := func(i int) {
+		if entries[entries[i].prev].next = entries[i].next; entries[i].next != -1 {
+			entries[entries[i].next].prev = entries[i].prev
+		}
+	}
+	relink := func(i int) {
+		if entries[entries[i].prev].next = i; entries[i].next != -1 {
+			entries[entries[i].next].prev = i
+		}
+	}
+
+	type frame struct {
+		call  int
+		state linState
+	}
+	var stack []frame
+	var state linState
+	linearized := make([]uint64, (len(events)+63)/64)
+	cache := map[string]bool{}
+	for cur := entries[0].next; entries[0].next != -1; {
+		if e := entries[cur]; e.call {
+			if next, ok := events[e.event].step(state); ok {
+				linearized[e.event/64] |= 1 << (e.event % 64)
+				key := binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, uint64(next.val)), uint64(linBit(next.present)))
+				for _, w := range linearized {
+					key = binary.LittleEndian.AppendUint64(key, w)
+				}
+				if !cache[string(key)] {
+					cache[string(key)] = true
+					stack = append(stack, frame{cur, state})
+					state = next
+					unlink(cur)
+					unlink(e.match)
+					cur = entries[0].next
+					continue
+				}
+				linearized[e.event/64] &^= 1 << (e.event % 64)
+			}
+			cur = e.next
+		} else if len(stack) == 0 {
+			return false
+		} else {
+			f := stack[len(stack)-1]
+			stack, state = stack[:len(stack)-1], f.state
+			linearized[entries[f.call].event/64] &^= 1 << (entries[f.call].event % 64)
+			relink(entries[f.call].match)
+			relink(f.call)
+			cur = entries[f.call].next
+		}
+	}
+	return true
+}
+
+// linAtOnce reports whether snapshot s, one of the events in byKey, takes effect on all keys at the same moment: it must be linearizable at some moment between its call and return in the history of every key. The other snapshots are left out, since they only read. The times are scaled so that s can be put between any two ticks of the clock, and the moments between the same events of a key are judged once for it.
+func linAtOnce(byKey map[testVPT][]linEvent, s linEvent) bool {
+	var moments []int64
+	for p := s.call; p < s.ret; p++ {
+		moments = append(moments, p)
+	}
+	for k := range testVPT(linKeysN) {
+		var events []linEvent
+		var ticks []int64 //the times of the events of k while s is in progress.
+		at := -1
+		for _, e := range byKey[k] {
+			if e.op == linSnapshot && e.call != s.call {
+				continue
+			} else if e.op == linSnapshot {
+				at = len(events)
+			}
+			for _, t := range [...]int64{e.call, e.ret} {
+				if s.call < t && t < s.ret {
+					ticks = append(ticks, t)
+				}
+			}
+			e.call, e.ret = 4*e.call, 4*e.ret
+			events = append(events, e)
+		}
+		if at < 0 {
+			continue
+		}
+		judged := map[int]bool{}
+		if moments = slices.DeleteFunc(moments, func(p int64) bool {
+			after := 0 //number of events of k that s is put after.
+			for _, t := range ticks {
+				after += linBit(t <= p)
+			}
+			ok, found := judged[after]
+			if !found {
+				events[at].call, events[at].ret = 4*p+1, 4*p+2
+				ok = linearizable(events)
+				judged[after] = ok
+			}
+			return !ok
+		}); len(moments) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func linTime(e linEvent, call bool) int64 {
+	if call {
+		return e.call
+	}
+	return e.ret
+}
+func linBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+const (
+	linThrdsN     = 8
+	linOpsN       = 1 << 8 //operations of each goroutine in a round.
+	linKeysN      = 1 << 6
+	linSnapshotsN = 1 //snapshots of each round checked to take effect on all keys at once, which is slow.
+)
+
+// linTarget is a kind of map under test. ops start with the way of deleting, which is picked more often. new makes an empty map, returning it and a function that performs an event on it and fills in the results. The map is nil when it has no buckets to resize.
+type linTarget struct {
+	name string
+	ops  []linOp
+	new  func() (interface{ Stats() Stats }, func(e *linEvent))
+}
+
+// testLinearizable runs rounds of random operations on small keys from several goroutines, which yield at random, also in the middle of resizes, and checks the histories. The buckets are tiny, so the map keeps resizing as keys come and go.
+func testLinearizable(t *testing.T, target linTarget) {
+	rounds := 1 << 5
+	if testing.Short() {
+		rounds = 1 << 2
+	}
+	resizeHook = func() {
+		if rand.IntN(2) == 0 {
+			runtime.Gosched()
+		}
+	}
+	defer func() { resizeHook = nil }()
+	splits, merges, resizable := uint64(0), uint64(0), true
+	for range rounds {
+		seed := rand.Uint64()
+		m, apply := target.new()
+		var clock atomic.Int64
+		histories := make([][]linEvent, linThrdsN)
+		wg := sync.WaitGroup{}
+		wg.Add(linThrdsN)
+		for i := range linThrdsN {
+			go func() {
+				defer wg.Done()
+				r := rand.New(rand.NewPCG(seed, uint64(i)))
+				for range linOpsN {
+					e := linEvent{op: target.ops[r.IntN(len(target.ops))], key: testVPT(r.IntN(linKeysN)), arg: r.IntN(3) + 1, arg2: r.IntN(3) + 1}
+					if r.IntN(4) == 0 { //so the maps shrink too.
+						e.op = target.ops[0]
+					}
+					if r.IntN(4) == 0 {
+						runtime.Gosched()
+					}
+					e.call = clock.Add(1)
+					apply(&e)
+					e.ret = clock.Add(1)
+					histories[i] = append(histories[i], e)
+				}
+			}()
+		}
+		wg.Wait()
+		byKey := map[testVPT][]linEvent{}
+		for _, h := range histories {
+			for _, e := range h {
+				if e.op != linClear && e.op != linSnapshot {
+					byKey[e.key] = append(byKey[e.key], e)
+					continue
+				}
+				for e.key = range linKeysN {
+					if e.all != nil {
+						e.val, e.ok = e.all[e.key].val, e.all[e.key].present
+					}
+					byKey[e.key] = append(byKey[e.key], e)
+				}
+			}
+		}
+		for k, events := range byKey {
+			if !linearizable(events) {
+				var b strings.Builder
+				for _, e := range events {
+					fmt.Fprintln(&b, e)
+				}
+				t.Fatalf("%s: history of key %d with seed %d isn't linearizable:\n%s", target.name, k, seed, b.String())
+			}
+		}
+		checked := 0
+		for _, h := range histories {
+			for _, e := range h {
+				if e.op == linSnapshot && checked < linSnapshotsN {
+					if checked++; !linAtOnce(byKey, e) {
+						t.Fatalf("%s: snapshot %v with seed %d doesn't take effect on all keys at once", target.name, e, seed)
+					}
+				}
+			}
+		}
+		if resizable = m != nil; resizable {
+			s := m.Stats()
+			splits, merges = splits+s.Splits, merges+s.Merges
+		}
+	}
+	if resizable && (splits == 0 || merges == 0) {
+		t.Fatal(target.name, "didn't resize", splits, merges)
+	}
+}
+
+// linValMap is the API shared by ValAny and ValVal maps.
+type linValMap[V any] interface {
+	Load(testVPT) (V, bool)
+	Store(testVPT, V) bool
+	LoadAndDelete(testVPT) (V, bool)
+	LoadOrStore(testVPT, V) (V, bool)
+	Swap(testVPT, V) (V, bool)
+	CompareAndSwap(testVPT, V, V) CASResult
+	CompareAndDelete(testVPT, V) CASResult
+	Compute(testVPT, func(V, bool) (V, ComputeOp)) (V, bool)
+	Clear() bool
+	TrackWrites()
+	Stats() Stats
+}
+
+// linAny adapts the CompareAndSwap and CompareAndDelete of ValAny, which take a function instead of the old value, to linValMap.
+type linAny struct {
+	*ValAny[testVPT, int]
+}
+
+func (m linAny) CompareAndSwap(key testVPT, old, new int) CASResult {
+	return m.ValAny.CompareAndSwap(key, new, testIs(old))
+}
+func (m linAny) CompareAndDelete(key testVPT, old int) CASResult {
+	return m.ValAny.CompareAndDelete(key, testIs(old))
+}
+
+// linLoader is the API of the snapshots of ValAny and ValVal maps.
+type linLoader[V any] interface {
+	Load(testVPT) (V, bool)
+}
+
+// linSnapshotOf fills in the results of e with the value of every key in a snapshot taken by load.
+func linSnapshotOf[V any](e *linEvent, load func(testVPT) (V, bool), val func(V) int) {
+	e.all = make([]linState, linKeysN)
+	for k := range e.all {
+		v, ok := load(testVPT(k))
+		e.all[k] = linState{val(v), ok}
+	}
+}
+
+// linComputeF is the function given to Compute by e, which acts as described by linEvent.
+func linComputeF[V comparable](e *linEvent, arg, arg2 V) func(V, bool) (V, ComputeOp) {
+	return func(old V, loaded bool) (V, ComputeOp) {
+		if !loaded {
+			return arg, STORE
+		} else if old != arg {
+			return arg2, STORE
+		} else if e.op == linUpdate {
+			return old, KEEP
+		}
+		return old, DELETE
+	}
+}
+
+func linVal[V ~int | ~uint | ~uintptr | ~int64 | ~uint64 | ~int32 | ~uint32 | ~float64](m linValMap[V], snapshot func() linLoader[V]) (interface{ Stats() Stats }, func(e *linEvent)) {
+	m.TrackWrites() //Clear and Snapshot require it.
+	return m, func(e *linEvent) {
+		var v V
+		switch e.op {
+		case linLoad:
+			v, e.ok = m.Load(e.key)
+		case linStore:
+			e.ok = m.Store(e.key, V(e.arg))
+		case linDelete:
+			v, e.ok = m.LoadAndDelete(e.key)
+		case linLoadOrStore:
+			v, e.ok = m.LoadOrStore(e.key, V(e.arg))
+		case linSwap:
+			v, e.ok = m.Swap(e.key, V(e.arg))
+		case linCAS:
+			e.res = m.CompareAndSwap(e.key, V(e.arg), V(e.arg2))
+		case linCAD:
+			e.res = m.CompareAndDelete(e.key, V(e.arg))
+		case linAdd:
+			v, e.ok = m.(interface{ Add(testVPT, V) (V, bool) }).Add(e.key, V(e.arg))
+		case linCompute, linUpdate:
+			v, e.ok = m.Compute(e.key, linComputeF(e, V(e.arg), V(e.arg2)))
+		case linClear:
+			m.Clear()
+		case linSnapshot:
+			linSnapshotOf(e, snapshot().Load, func(v V) int { return int(v) })
+			return
+		}
+		e.val = int(v)
+	}
+}
+
+func linValTarget[V ~int | ~uint | ~uintptr | ~int64 | ~uint64 | ~int32 | ~uint32 | ~float64, M linValMap[V], S linLoader[V]](name string, new func() M, snapshot func(M) (S, bool)) linTarget {
+	return linTarget{name, []linOp{linDelete, linLoad, linStore, linLoadOrStore, linSwap, linCAS, linCAD, linAdd, linCompute, linUpdate, linClear, linSnapshot}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+		m := new()
+		return linVal[V](m, func() linLoader[V] {
+			s, _ := snapshot(m)
+			return s
+		})
+	}}
+}
+
+// linPtrTarget is the ValPtr target, whose nodes are reused when pooled.
+func linPtrTarget(name string, pooled bool) linTarget {
+	return linTarget{name, []linOp{linDelete, linLoad, linStore, linLoadOrStore, linSwap, linCAS, linCAD, linCompute, linClear, linSnapshot}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+		m := NewValPtr[testVPT, int](1, 2, linKeysN-1, testHashF)
+		if m.TrackWrites(); pooled { //Clear and Snapshot require it.
+			m.PoolNodes()
+		}
+		return m, func(e *linEvent) {
+			var p *int
+			switch arg := e.arg; e.op {
+			case linLoad:
+				p = m.LoadPtr(e.key)
+			case linStore:
+				e.ok = m.StorePtr(e.key, &arg)
+			case linDelete:
+				p = m.LoadPtrAndDelete(e.key)
+			case linLoadOrStore:
+				p = m.LoadOrStorePtr(e.key, &arg)
+			case linSwap:
+				p = m.SwapPtr(e.key, &arg)
+			case linCAS:
+				arg2 := e.arg2
+				e.res = m.CompareAndSwap(e.key, &arg2, func(v *int) bool { return *v == arg })
+			case linCAD:
+				e.res = m.CompareAndDelete(e.key, func(v *int) bool { return *v == arg })
+			case linCompute:
+				arg2 := e.arg2
+				p, _ = m.Compute(e.key, func(old *int, loaded bool) (*int, ComputeOp) {
+					if !loaded {
+						return &arg, STORE
+					} else if *old != arg {
+						return &arg2, STORE
+					}
+					return old, DELETE
+				})
+			case linClear:
+				m.Clear()
+			case linSnapshot:
+				snap, _ := m.Snapshot()
+				linSnapshotOf(e, func(k testVPT) (*int, bool) {
+					p := snap.LoadPtr(k)
+					return p, p != nil
+				}, func(p *int) int {
+					if p == nil {
+						return 0
+					}
+					return *p
+				})
+			}
+			if p != nil {
+				e.val, e.ok = *p, true
+			}
+		}
+	}}
+}
+
+func TestLinearizable(t *testing.T) {
+	targets := []linTarget{
+		linPtrTarget("ValPtr", false),
+		linPtrTarget("ValPtr_Pooled", true),
+		{"ValAny", []linOp{linDelete, linLoad, linStore, linLoadOrStore, linSwap, linCAS, linCAD, linCompute, linClear, linSnapshot}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			m := NewValAny[testVPT, int](1, 2, linKeysN-1, testHashF)
+			return linVal[int](linAny{m}, func() linLoader[int] {
+				s, _ := m.Snapshot()
+				return s
+			})
+		}},
+		{"ValAny_Pooled", []linOp{linDelete, linLoad, linStore, linLoadOrStore, linSwap, linCAS, linCAD, linCompute, linClear, linSnapshot}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			m := NewValAny[testVPT, int](1, 2, linKeysN-1, testHashF)
+			m.PoolNodes()
+			return linVal[int](linAny{m}, func() linLoader[int] {
+				s, _ := m.Snapshot()
+				return s
+			})
+		}},
+		linValTarget[uintptr]("ValUintptr", func() *ValUintptr[testVPT, uintptr] {
+			return NewValUintptr[testVPT, uintptr](1, 2, linKeysN-1, testHashF)
+		}, (*ValUintptr[testVPT, uintptr]).Snapshot),
+		linValTarget[uintptr]("ValUintptr_Pooled", func() *ValUintptr[testVPT, uintptr] {
+			m := NewValUintptr[testVPT, uintptr](1, 2, linKeysN-1, testHashF)
+			m.PoolNodes()
+			return m
+		}, (*ValUintptr[testVPT, uintptr]).Snapshot),
+		linValTarget[int64]("ValInt64", func() *ValInt64[testVPT, int64] { return NewValInt64[testVPT, int64](1, 2, linKeysN-1, testHashF) }, (*ValInt64[testVPT, int64]).Snapshot),
+		linValTarget[uint64]("ValUint64", func() *ValUint64[testVPT, uint64] { return NewValUint64[testVPT, uint64](1, 2, linKeysN-1, testHashF) }, (*ValUint64[testVPT, uint64]).Snapshot),
+		linValTarget[int32]("ValInt32", func() *ValInt32[testVPT, int32] { return NewValInt32[testVPT, int32](1, 2, linKeysN-1, testHashF) }, (*ValInt32[testVPT, int32]).Snapshot),
+		linValTarget[uint32]("ValUint32", func() *ValUint32[testVPT, uint32] { return NewValUint32[testVPT, uint32](1, 2, linKeysN-1, testHashF) }, (*ValUint32[testVPT, uint32]).Snapshot),
+		linValTarget[int]("ValInt", func() *ValInt[testVPT, int] { return NewValInt[testVPT, int](1, 2, linKeysN-1, testHashF) }, (*ValInt[testVPT, int]).Snapshot),
+		linValTarget[uint]("ValUint", func() *ValUint[testVPT, uint] { return NewValUint[testVPT, uint](1, 2, linKeysN-1, testHashF) }, (*ValUint[testVPT, uint]).Snapshot),
+		linValTarget[float64]("ValFloat64", func() *ValFloat64[testVPT, float64] {
+			return NewValFloat64[testVPT, float64](1, 2, linKeysN-1, testHashF)
+		}, (*ValFloat64[testVPT, float64]).Snapshot),
+		{"Set", []linOp{linRemove, linLoad, linStore}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			m := NewSet[testVPT](1, 2, linKeysN-1, testHashF)
+			return m, func(e *linEvent) { //keys are present with the value 0.
+				switch e.arg = 0; e.op {
+				case linLoad:
+					e.ok = m.Has(e.key)
+				case linStore:
+					e.ok = m.Add(e.key)
+				case linRemove:
+					e.ok = m.Remove(e.key)
+				}
+			}
+		}},
+		{"Multi", []linOp{linRemove, linLoad, linStore}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			m := NewMulti[testVPT, testVPT](1, 2, linKeysN/4-1, testHashF)
+			return m, func(e *linEvent) { //each key of the history is a pair of a key and a value of the map.
+				k, v := e.key/4, e.key%4
+				switch e.arg = 0; e.op {
+				case linLoad:
+					e.ok = m.Has(k, v)
+				case linStore:
+					e.ok = m.Add(k, v)
+				case linRemove:
+					e.ok = m.RemoveValue(k, v)
+				}
+			}
+		}},
+		{"Cache", []linOp{linRemove, linLoad, linStore, linLoadOrStore}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			c := NewCache[testVPT, int](1, 2, linKeysN-1, testHashF, linKeysN, nil) //keys are never evicted, which isn't in the model.
+			return c.m, func(e *linEvent) {
+				switch e.op {
+				case linLoad:
+					e.val, e.ok = c.Load(e.key)
+				case linStore:
+					e.ok = c.Store(e.key, e.arg)
+				case linRemove:
+					e.ok = c.Delete(e.key)
+				case linLoadOrStore:
+					e.val, e.ok = c.LoadOrStore(e.key, e.arg)
+				}
+			}
+		}},
+		{"Expiring", []linOp{linRemove, linLoad, linStore}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			x := NewExpiring[testVPT, int](1, 2, linKeysN-1, testHashF, &testClock{}) //keys never expire, which isn't in the model.
+			return x.m, func(e *linEvent) {
+				switch e.op {
+				case linLoad:
+					e.val, e.ok = x.Load(e.key)
+				case linStore:
+					e.ok = x.StoreWithTTL(e.key, e.arg, time.Hour)
+				case linRemove:
+					e.ok = x.Delete(e.key)
+				}
+			}
+		}},
+		{"Ordered", []linOp{linDelete, linLoad, linStore, linLoadOrStore}, func() (interface{ Stats() Stats }, func(e *linEvent)) {
+			o := NewOrdered[testVPT, int]()
+			return nil, func(e *linEvent) {
+				var p *int
+				switch arg := e.arg; e.op {
+				case linLoad:
+					p = o.LoadPtr(e.key)
+				case linStore:
+					e.ok = o.StorePtr(e.key, &arg)
+				case linDelete:
+					p = o.LoadPtrAndDelete(e.key)
+				case linLoadOrStore:
+					p = o.LoadOrStorePtr(e.key, &arg)
+				}
+				if p != nil {
+					e.val, e.ok = *p, true
+				}
+			}
+		}},
+	}
+	for _, target := range targets {
+		t.Run(target.name, func(t *testing.T) {
+			testLinearizable(t, target)
+		})
+	}
+}
+
+func TestLinearizable_Checker(t *testing.T) { //the checker must reject histories that aren't linearizable.
+	for name, events := range map[string][]linEvent{
+		"stale load": { //a load after a store returns must see it.
+			{op: linStore, arg: 1, ok: true, call: 1, ret: 2},
+			{op: linLoad, call: 3, ret: 4},
+		},
+		"lost update": { //both stores report adding the key, but they overlap only each other.
+			{op: linStore, arg: 1, ok: true, call: 1, ret: 4},
+			{op: linStore, arg: 2, ok: true, call: 2, ret: 3},
+		},
+		"delete after store": { //the delete must see one of the stores.
+			{op: linStore, arg: 1, ok: true, call: 1, ret: 2},
+			{op: linSwap, arg: 2, val: 1, ok: true, call: 3, ret: 6},
+			{op: linDelete, val: 1, ok: true, call: 7, ret: 8},
+		},
+		"store after clear": { //a load after a clear returns must not see the store that returned before it.
+			{op: linStore, arg: 1, ok: true, call: 1, ret: 2},
+			{op: linClear, call: 3, ret: 4},
+			{op: linLoad, val: 1, ok: true, call: 5, ret: 6},
+		},
+	} {
+		if linearizable(events) {
+			t.Fatal(name, "is accepted")
+		}
+	}
+	if !linearizable([]linEvent{ //the load and the delete overlap the store, so they may be ordered either way.
+		{op: linStore, arg: 1, ok: true, call: 1, ret: 10},
+		{op: linLoad, val: 1, ok: true, call: 2, ret: 3},
+		{op: linDelete, val: 1, ok: true, call: 4, ret: 5},
+		{op: linLoad, call: 6, ret: 7},
+	}) {
+		t.Fatal("a linearizable history is rejected")
+	}
+	for _, seen := range []bool{false, true} { //key 0 is stored before key 1, so a snapshot seeing key 1 must see key 0 unless it's deleted, though each key alone allows it.
+		byKey := map[testVPT][]linEvent{
+			0: {{op: linStore, key: 0, arg: 1, ok: true, call: 1, ret: 2}, {op: linDelete, key: 0, val: 1, ok: true, call: 7, ret: 8}},
+			1: {{op: linStore, key: 1, arg: 1, ok: true, call: 3, ret: 4}},
+		}
+		s := linEvent{op: linSnapshot, call: 0, ret: 6}
+		for k := range testVPT(2) {
+			e := s
+			e.key, e.val, e.ok = k, 1, k == 1 || seen
+			byKey[k] = append(byKey[k], e)
+		}
+		if linAtOnce(byKey, s) != seen {
+			t.Fatal("a snapshot that sees key 0", seen, "is judged wrong")
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package Maps
 
 import (
+	"math"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 )
@@ -41,6 +44,11 @@ retry:
 		*/
 		if left = (*relay)(path.Pop()); left == nil { //try to backtrack using path.
 			left = fb() //path is empty, use fallback.
+			if statsOn {
+				crawlStats.fallbacks.Add(1)
+			}
+		} else if statsOn {
+			crawlStats.backtracks.Add(1)
 		}
 		goto retry //reload right using new left.
 	}
@@ -60,6 +68,9 @@ retry:
 		if atomic.CompareAndSwapUintptr((*uintptr)(unsafe.Pointer(&left.next)), uintptr(right), right2) {
 			return left, unsafe.Pointer(right2)
 		}
+		if statsOn {
+			crawlStats.retries.Add(1)
+		}
 		goto retry //failed, reload right for new right2.
 	}
 }
@@ -92,7 +103,193 @@ type ptrNode[K any] struct {
 }
 
 type valNode[K any, V uint32 | int32 | uint64 | int64 | uintptr] struct {
+	relay
+	state uint64 //the writes in progress, whether the node is dead, and the number of writes done.
+	key   K
+	val   V
+	ver   unsafe.Pointer //the newest version of the value when writes are tracked, in which case val and state aren't used.
+}
+
+// valNode has no spare value to mark a deleted value with, so a delete that depends on the value makes the node dead in state first: it's done by CAS when no write is in progress and none is done since the value is compared, after which no write starts. The node is then marked, by the delete or by a write finding it dead.
+const (
+	writing = 1       //added to state by each write that starts.
+	dead    = 1 << 32 //set in state when the node is to be deleted.
+	written = 1 << 33 //added to state by each write that's done, which wraps around.
+)
+
+// write starts a write to n, which is ended by done. It returns false when n is dead, in which case n is marked and the write must be made to a new node instead.
+func (n *valNode[K, V]) write(vp *base[K]) bool {
+	if atomic.AddUint64(&n.state, writing)&dead == 0 {
+		return true
+	}
+	atomic.AddUint64(&n.state, ^uint64(writing-1))
+	n.drop(vp)
+	return false
+}
+func (n *valNode[K, V]) done() {
+	atomic.AddUint64(&n.state, written-writing)
+}
+
+// idle returns the state of n once no write to it is in progress, waiting for the writes in progress, which are single atomic operations. It returns false when n is dead, in which case n is marked.
+func (n *valNode[K, V]) idle(vp *base[K]) (uint64, bool) {
+	for {
+		if s := atomic.LoadUint64(&n.state); s&dead != 0 {
+			n.drop(vp)
+			return s, false
+		} else if s&(dead-1) == 0 {
+			return s, true
+		}
+		runtime.Gosched()
+	}
+}
+
+// kill makes n dead when its state is still s, which means its value hasn't changed since idle returned s.
+func (n *valNode[K, V]) kill(s uint64) bool {
+	return atomic.CompareAndSwapUint64(&n.state, s, s|dead)
+}
+func (n *valNode[K, V]) unchanged(s uint64) bool {
+	return atomic.LoadUint64(&n.state) == s
+}
+
+// drop marks n once it's dead, counting it as deleted unless it's marked already.
+func (n *valNode[K, V]) drop(vp *base[K]) {
+	if n.mark() {
+		vp.deleted(&n.relay)
+	}
+}
+
+// ValFloat64 and ValBool keep their values in valNode as bits, which are converted by these. Values are therefore compared by bits, so a NaN equals a NaN of the same bits and -0 doesn't equal +0.
+func float64Bits[V ~float64](v V) uint64 {
+	return math.Float64bits(float64(v))
+}
+func fromFloat64Bits[V ~float64](x uint64) V {
+	return V(math.Float64frombits(x))
+}
+func boolBits[V ~bool](v V) uint32 {
+	if v {
+		return 1
+	}
+	return 0
+}
+func fromBoolBits[V ~bool](x uint32) V {
+	return x != 0
+}
+
+// addFloat64 is atomic.AddUint64 for the bits of float64, by CAS.
+func addFloat64(p *uint64, delta uint64) uint64 {
+	for {
+		old := atomic.LoadUint64(p)
+		if new := math.Float64bits(math.Float64frombits(old) + math.Float64frombits(delta)); atomic.CompareAndSwapUint64(p, old, new) {
+			return new
+		}
+	}
+}
+
+type keyNode[K any] struct {
+	relay
+	key K
+}
+
+type pairNode[K any, V any] struct {
 	relay
 	key K
 	val V
 }
+
+// anyBox holds a value of ValAny. A box is never modified while it's in a node, so it can be swapped by CAS. readers counts the readers that may be copying val, and a box that's swapped out is reused only when there are none.
+type anyBox[V any] struct {
+	readers atomic.Int32
+	val     V
+}
+
+// anyNode keeps the value it's created with in inline. val points to either inline or a box of a later write, or to the newest version of the value when writes are tracked.
+type anyNode[K any, V any] struct {
+	relay
+	val    unsafe.Pointer
+	key    K
+	inline anyBox[V]
+}
+
+// acquire the box at p, which can't be reused until its readers is decremented, or return nil when p is tomb. The box is acquired only when it's still at p after readers is incremented, so it isn't one that's being reused.
+func acquire[V any](p *unsafe.Pointer) *anyBox[V] {
+	for {
+		v := atomic.LoadPointer(p)
+		if v == tomb {
+			return nil
+		}
+		b := (*anyBox[V])(v)
+		if b.readers.Add(1); atomic.LoadPointer(p) == v {
+			return b
+		}
+		b.readers.Add(-1)
+	}
+}
+
+// load copies the value of n, or returns false when n is deleted.
+func (n *anyNode[K, V]) load() (v V, ok bool) {
+	if b := acquire[V](&n.val); b != nil {
+		v = b.val
+		b.readers.Add(-1)
+		return v, true
+	}
+	return
+}
+
+// yield the key and value of n unless n is deleted, returning false when yield does.
+func (n *anyNode[K, V]) yield(yield func(K, V) bool) bool {
+	v, ok := n.load()
+	return !ok || yield(n.key, v)
+}
+
+// anyBoxes pools the boxes that are swapped out of nodes with no readers, so that writes reuse them.
+type anyBoxes[V any] struct {
+	pool sync.Pool
+}
+
+// box returns a box of val, which is a reused one when there is.
+func (bs *anyBoxes[V]) box(val V) *anyBox[V] {
+	b, _ := bs.pool.Get().(*anyBox[V])
+	if b == nil {
+		b = new(anyBox[V])
+	}
+	b.val = val
+	return b
+}
+
+// unbox makes b, which isn't in any node, ready for reuse. The value is zeroed so that it isn't kept alive.
+func (bs *anyBoxes[V]) unbox(b *anyBox[V]) {
+	var zero V
+	b.val = zero
+	bs.pool.Put(b)
+}
+
+// reuse the box p that the caller swapped out of n when no reader is copying from it. A reader that acquires p later finds it's no longer in n, and the box inline in n is never reused.
+func (n *anyNode[K, V]) reuse(bs *anyBoxes[V], p unsafe.Pointer) {
+	if b := (*anyBox[V])(p); b != &n.inline && b.readers.Load() == 0 {
+		bs.unbox(b)
+	}
+}
+
+// swap val into n unless n is deleted, returning the old value.
+func (n *anyNode[K, V]) swap(bs *anyBoxes[V], val V) (old V, swapped bool) {
+	b := bs.box(val)
+	if p := casLive(&n.val, unsafe.Pointer(b)); p != tomb {
+		old = (*anyBox[V])(p).val
+		n.reuse(bs, p)
+		return old, true
+	}
+	bs.unbox(b)
+	return
+}
+
+// tomb replaces the value of a node when it's deleted from ValPtr or ValAny. The deletion is linearized at writing tomb, and the node is marked afterward only to remove it physically. All writes to values must therefore check for tomb atomically, otherwise they could revive a deleted node.
+var tomb = unsafe.Pointer(new(byte))
+
+// casLive replaces the value at p with new unless it's tomb. It returns the replaced value, or tomb when nothing is replaced.
+func casLive(p *unsafe.Pointer, new unsafe.Pointer) unsafe.Pointer {
+	for {
+		if old := atomic.LoadPointer(p); old == tomb || atomic.CompareAndSwapPointer(p, old, new) {
+			return old
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package Maps
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Change describes a write that changed a key, which is given to the functions registered by OnChange and Watch.
+type Change[K any, V any] struct {
+	Key            K
+	Old, New       V    //Old is the value before the write when Loaded, and New is the value after it when Stored; they're zero otherwise.
+	Loaded, Stored bool //whether key was present before and after the write, so an added key isn't Loaded and a deleted key isn't Stored.
+}
+
+// stripeLocks serialize the writes to each stripe of hashes of an observed map, so that changes are queued in the order they're made. The lock is released before the changes are delivered by deliver, so the observers may write to the map. It is also released while the functions given to Compute, CompareAndSwap and CompareAndDelete run, by callCompute and callEq.
+type stripeLocks struct {
+	stripes [trackerStripes]struct {
+		sync.Mutex
+		_ [56]byte //keep each stripe in its own cache line.
+	}
+	deliver func(stripe uint)
+}
+
+// watch is a function registered by Watch for key.
+type watch[K any, V any] struct {
+	hash uint
+	key  K
+	f    func(Change[K, V])
+}
+
+// queued is a change waiting to be delivered, with the watches of its stripe when it's made.
+type queued[K any, V any] struct {
+	hash    uint
+	c       Change[K, V]
+	watches *[]*watch[K, V]
+}
+
+// observers are the functions that are called after every change of an observed map. The watches of each stripe are replaced as a whole when one is added or removed, so a function may add or remove watches while it's called.
+// The changes of each stripe are queued in order and delivered by one writer at a time. A change queued while the stripe is being delivered, including by the observers themselves, is left to the writer that's delivering, so observers may write to the map without waiting for themselves.
+type observers[K any, V any] struct {
+	onChange func(Change[K, V])
+	eq       func(K, K) bool
+	mu       sync.Mutex //serializes adding and removing watches.
+	watches  [trackerStripes]atomic.Pointer[[]*watch[K, V]]
+	queues   [trackerStripes]struct {
+		sync.Mutex
+		changes, spare []queued[K, V] //spare is the slice delivered last time, which is reused.
+		delivering     bool
+	}
+}
+
+// queue c.Key's change, whose hash is hash. The caller must hold the lock of the stripe, so changes of a key are queued in order.
+func (o *observers[K, V]) queue(hash uint, c Change[K, V]) {
+	q := &o.queues[hash%trackerStripes]
+	q.Lock()
+	q.changes = append(q.changes, queued[K, V]{hash, c, o.watches[hash%trackerStripes].Load()})
+	q.Unlock()
+}
+
+// deliver the changes queued in stripe unless they're being delivered already. The caller must not hold the lock of the stripe.
+func (o *observers[K, V]) deliver(stripe uint) {
+	q := &o.queues[stripe]
+	q.Lock()
+	if q.delivering {
+		q.Unlock()
+		return
+	}
+	for q.delivering = true; len(q.changes) != 0; {
+		changes := q.changes
+		q.changes, q.spare = q.spare, nil
+		q.Unlock()
+		for _, c := range changes {
+			o.notify(c)
+		}
+		clear(changes)
+		q.Lock()
+		q.spare = changes[:0]
+	}
+	q.delivering = false
+	q.Unlock()
+}
+
+// notify the observers of a change.
+func (o *observers[K, V]) notify(c queued[K, V]) {
+	if o.onChange != nil {
+		o.onChange(c.c)
+	}
+	if c.watches != nil {
+		for _, w := range *c.watches {
+			if w.hash == c.hash && o.eq(w.key, c.c.Key) {
+				w.f(c.c)
+			}
+		}
+	}
+}
+
+// locks returns the stripeLocks of a map observed by o.
+func (o *observers[K, V]) locks() *stripeLocks {
+	return &stripeLocks{deliver: o.deliver}
+}
+
+// watch registers f for key and returns the function that removes it.
+func (o *observers[K, V]) watch(hash uint, key K, f func(Change[K, V])) (cancel func()) {
+	w, ws := &watch[K, V]{hash, key, f}, &o.watches[hash%trackerStripes]
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var old []*watch[K, V]
+	if p := ws.Load(); p != nil {
+		old = *p
+	}
+	new := append(old[:len(old):len(old)], w)
+	ws.Store(&new)
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if p := ws.Load(); p != nil {
+			if i := slices.Index(*p, w); i >= 0 {
+				new := slices.Delete(slices.Clone(*p), i, i+1) //the old slice may still be iterated by notify.
+				ws.Store(&new)
+			}
+		}
+	}
+}
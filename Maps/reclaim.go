@@ -0,0 +1,115 @@
+package Maps
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const reclaimBatch = 1 << 5 //number of nodes retired between attempts to advance the epoch.
+
+// reclaimer hands the nodes of deleted keys to later inserts once no operation can still reach them, by epoch-based reclamation: every operation on the list pins the epoch it starts in, and a node retired in epoch e is reused only after the epoch advances twice, which requires all operations pinned in e-1 and then in e to finish. A node is retired only after it's removed from the list, so operations pinned afterward never find it.
+type reclaimer struct {
+	epoch   atomic.Uint64
+	stripes [trackerStripes]struct {
+		pins  [3]atomic.Int64 //pins[e%3] is the number of operations pinned in epoch e.
+		mu    sync.Mutex
+		limbo [3]struct {
+			epoch uint64 //the epoch the nodes are retired in.
+			nodes []unsafe.Pointer
+		}
+	}
+	retired atomic.Uint64
+	free    sync.Pool              //nodes ready for reuse, which keeps a free list for each P and drops the nodes left unused over 2 GCs.
+	reset   func(n unsafe.Pointer) //zeroes a node, so it doesn't keep its key and value alive while free.
+	reused  atomic.Uint64
+}
+
+// pin the current epoch in stripe, which protects the nodes the caller reaches from being reused until it decrements the returned count. Operations on a key pin in the stripe of its hash, and the others in any stripe. The epoch is read again after being pinned, since it may have advanced past the epoch that was read.
+func (r *reclaimer) pin(stripe uint) *atomic.Int64 {
+	for {
+		e := r.epoch.Load()
+		pins := &r.stripes[stripe].pins[e%3]
+		if pins.Add(1); r.epoch.Load() == e {
+			return pins
+		}
+		pins.Add(-1)
+	}
+}
+
+// retire n, which is removed from the list, in the stripe of its hash. The caller must be pinned, so the epoch can't advance twice before n is in limbo.
+func (r *reclaimer) retire(n unsafe.Pointer, hash uint) {
+	s := &r.stripes[hash%trackerStripes]
+	s.mu.Lock()
+	e := r.epoch.Load()
+	l := &s.limbo[e%3]
+	if l.epoch != e { //the nodes are from 3 epochs ago.
+		r.release(l.nodes)
+		l.epoch, l.nodes = e, l.nodes[:0]
+	}
+	l.nodes = append(l.nodes, n)
+	s.mu.Unlock()
+	if r.retired.Add(1)%reclaimBatch == 0 {
+		r.advance(e)
+	}
+}
+
+// advance the epoch from e when no operation is pinned in e-1, and release the nodes retired in e-1, which no operation can reach anymore.
+func (r *reclaimer) advance(e uint64) {
+	for i := range r.stripes {
+		if r.stripes[i].pins[(e+2)%3].Load() != 0 {
+			return
+		}
+	}
+	if !r.epoch.CompareAndSwap(e, e+1) {
+		return
+	}
+	for i := range r.stripes {
+		s := &r.stripes[i]
+		s.mu.Lock()
+		for j := range s.limbo {
+			if l := &s.limbo[j]; l.epoch+2 <= e+1 {
+				r.release(l.nodes)
+				l.nodes = l.nodes[:0]
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+func (r *reclaimer) release(nodes []unsafe.Pointer) {
+	for _, n := range nodes {
+		r.reset(n)
+		r.free.Put(n)
+	}
+}
+
+// get returns a free node, or nil when there's none.
+func (r *reclaimer) get() unsafe.Pointer {
+	n, _ := r.free.Get().(unsafe.Pointer)
+	if n != nil {
+		r.reused.Add(1)
+	}
+	return n
+}
+
+// deleted counts n, which the caller marked, as removed. When nodes are pooled, n is removed from the list by crawling past its hash before it's retired, since a marked node stays reachable until a crawl or walk removes it.
+func (vp *base[K]) deleted(n *relay) {
+	vp.removed(n.hash)
+	if vp.nodes != nil {
+		fb := func() *relay {
+			return (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets)))).Get(n.hash)
+		}
+		path := evictStack{}
+		for left, right := fb().crawl(&path, fb); right != nil && (*relay)(addr(right)).hash <= n.hash; left, right = left.crawl(&path, fb) {
+			path.Push(addr(right))
+			left = (*relay)(addr(right))
+		}
+		vp.nodes.retire(unsafe.Pointer(n), n.hash)
+	}
+	vp.tryMerge()
+}
+
+// poolNodes makes the map reuse the nodes of deleted keys, which reset zeroes.
+func (vp *base[K]) poolNodes(reset func(n unsafe.Pointer)) {
+	vp.nodes = &reclaimer{reset: reset}
+}
@@ -0,0 +1,86 @@
+package Maps
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Stats describes the buckets of a map and how they're resized, for choosing MinAvgBucketSize and MaxAvgBucketSize.
+type Stats struct {
+	LogChunkSize   byte   //log2 of the range of hashes in a bucket.
+	Buckets        uint   //number of buckets.
+	Relays         uint   //number of relays in the list, which differs from Buckets only while resizing.
+	Keys           uint   //number of keys found in the list.
+	Splits, Merges uint64 //number of times the buckets are doubled and halved.
+	BucketSizes    []uint //BucketSizes[i] is the number of buckets holding i keys.
+	LongestRun     uint   //largest number of keys of the same hash, which every operation on those keys may pass.
+	Collisions     uint64 //number of inserts that passed more keys of their hash than the limit of DetectCollisions.
+	Reused         uint64 //number of inserts that reused the node of a deleted key since PoolNodes.
+	Crawl          CrawlStats
+}
+
+// CrawlStats counts how often inserting into the list has to go back. They're counted for all maps together, and only when built with the mapsstats tag, otherwise they're 0.
+type CrawlStats struct {
+	Retries    uint64 //a deleted node couldn't be removed because its predecessor changed.
+	Backtracks uint64 //the predecessor was deleted, so an earlier node on the path is used.
+	Fallbacks  uint64 //the path was used up, so the search restarts from the bucket.
+}
+
+// crawlStats is only written when statsOn.
+var crawlStats struct {
+	retries, backtracks, fallbacks atomic.Uint64
+}
+
+// Stats walks the whole list to count the keys in each bucket, so it takes time proportional to the size of the map. It isn't linearizable.
+func (vp *base[K]) Stats() Stats {
+	if vp.nodes != nil {
+		defer vp.nodes.pin(0).Add(-1)
+	}
+	buckets := (*chunkArr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&vp.buckets))))
+	s := Stats{
+		LogChunkSize: buckets.logChunkSize,
+		Buckets:      1 << (vp.maxLogChunkSize - buckets.logChunkSize),
+		Relays:       1, //firstRelay.
+		Splits:       vp.splits.Load(),
+		Merges:       vp.merges.Load(),
+		Crawl:        CrawlStats{crawlStats.retries.Load(), crawlStats.backtracks.Load(), crawlStats.fallbacks.Load()},
+	}
+	if vp.collisions != nil {
+		s.Collisions = vp.collisions.count.Load()
+	}
+	if vp.nodes != nil {
+		s.Reused = vp.nodes.reused.Load()
+	}
+	count := func(n uint) {
+		for uint(len(s.BucketSizes)) <= n {
+			s.BucketSizes = append(s.BucketSizes, 0)
+		}
+		s.BucketSizes[n]++
+	}
+	n, index := uint(0), uint(0)
+	run, runHash := uint(0), uint(0)
+	for cur := vp.firstRelay.walk(); cur != nil; cur = (*relay)(addr(cur)).walk() {
+		if !isRelay(cur) {
+			if hash := (*relay)(addr(cur)).hash; run == 0 || hash != runHash {
+				run, runHash = 1, hash
+			} else {
+				run++
+			}
+			s.LongestRun = max(s.LongestRun, run)
+			if i := buckets.Index((*relay)(addr(cur)).hash); i != index { //the buckets in between are empty.
+				for count(n); index+1 < i; index++ {
+					count(0)
+				}
+				n, index = 0, i
+			}
+			n++
+			s.Keys++
+		} else {
+			s.Relays++
+		}
+	}
+	for count(n); index+1 < s.Buckets; index++ {
+		count(0)
+	}
+	return s
+}
@@ -0,0 +1,6 @@
+//go:build mapsstats
+
+package Maps
+
+// statsOn enables counting the retries of crawl, which is done when built with the mapsstats tag.
+const statsOn = true
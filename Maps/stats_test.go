@@ -0,0 +1,52 @@
+package Maps
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	mq := NewValPtr[testVPT, testVPT](testMinBSz, testMaxBSz, testMaxHash, testHashF)
+	check := func() Stats {
+		t.Helper()
+		s := mq.Stats()
+		buckets, keys := uint(0), uint(0)
+		for i, n := range s.BucketSizes {
+			buckets += n
+			keys += uint(i) * n
+		}
+		if buckets != s.Buckets || keys != s.Keys || s.Keys != mq.Size() || s.Relays != s.Buckets || s.Buckets != 1<<(mq.maxLogChunkSize-s.LogChunkSize) {
+			t.Fatal("inconsistent stats", s.Buckets, buckets, s.Keys, keys, mq.Size(), s.Relays)
+		}
+		return s
+	}
+	if s := check(); s.Buckets != 1 || s.Keys != 0 || s.Splits != 0 {
+		t.Fatal("wrong empty stats", s)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(testThrdsN)
+	for i := range testThrdsN {
+		go func() {
+			defer wg.Done()
+			for j := i * testAddNEach; j < (i+1)*testAddNEach; j++ {
+				v := testVPT(j)
+				mq.StorePtr(v, &v)
+			}
+		}()
+	}
+	wg.Wait()
+	grown := check()
+	if grown.Splits == 0 || grown.Merges != 0 || grown.Splits != uint64(mq.maxLogChunkSize-grown.LogChunkSize) {
+		t.Fatal("wrong splits", grown.Splits, grown.Merges)
+	}
+	for i := range testVPT(testAddNEach * testThrdsN) {
+		if i%4 != 0 {
+			mq.Delete(i)
+		}
+	}
+	if shrunk := check(); shrunk.Merges == 0 || shrunk.Buckets >= grown.Buckets {
+		t.Fatal("wrong merges", shrunk.Merges, shrunk.Buckets, grown.Buckets)
+	} else if !statsOn && shrunk.Crawl != (CrawlStats{}) {
+		t.Fatal("crawl is counted without the mapsstats tag", shrunk.Crawl)
+	}
+}
@@ -0,0 +1,176 @@
+package Maps
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	trackerStripes = 1 << 6
+	sizeTries      = 1 << 4 //number of times size tries to find a moment without writes before giving up.
+)
+
+// tracker counts the writes that began and ended in each stripe of hashes. When the counts are equal in a stripe, no write to that stripe is in progress, so counts read while no stripe begins a write are the state of the map at a single moment.
+// In ValPtr, ValAny and ValVal maps, the tracker also keeps the clock their versions are stamped with, and the snapshots in progress, which need the nodes deleted since they began.
+type tracker struct {
+	stripes [trackerStripes]struct {
+		begun, ended atomic.Uint64
+		count        atomic.Int64 //number of keys whose hash is in the stripe, which is negative when a node is removed before it's counted as added.
+		_            [40]byte     //keep each stripe in its own cache line.
+	}
+	fences    atomic.Int32                       //number of fences up. Writes don't begin while there is one.
+	version   func(n *relay)                     //makes the value of a node that isn't shared yet its first version, which is nil unless the values are versions. Deleted versions are counted by unlink rather than when their nodes are marked.
+	present   func(n *relay, moment uint64) bool //reports whether the key of a node is present at a moment, when the values are versions.
+	clock     atomic.Uint64
+	snapshots atomic.Int32             //number of snapshots in progress. Nodes deleted meanwhile stay in the list, in left.
+	left      atomic.Pointer[leftNode] //deleted nodes that are still in the list, which are marked once no snapshot is in progress.
+	clears    sync.RWMutex             //read locked by snapshots and locked by clear, which detaches the list they walk.
+}
+
+func newTracker(version func(n *relay), present func(n *relay, moment uint64) bool) *tracker {
+	t := &tracker{version: version, present: present}
+	t.clock.Store(1) //0 is the stamp of a version that isn't stamped yet.
+	return t
+}
+
+// begin counts a write to stripe i, waiting while the writes are fenced. The fence is checked after the write is counted, so a fence put up afterward waits for the write to end; a write that finds a fence uncounts itself by ending.
+func (t *tracker) begin(i uint) {
+	for t.stripes[i].begun.Add(1); t.fences.Load() != 0; t.stripes[i].begun.Add(1) {
+		t.stripes[i].ended.Add(1)
+		for t.fences.Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+}
+
+// fence stops writes from beginning and waits for the writes in progress to end, so the map doesn't change until unfence, except by the one who fenced.
+func (t *tracker) fence() {
+	t.fences.Add(1)
+	var begun [trackerStripes]uint64
+	for !t.collect(&begun) {
+		runtime.Gosched()
+	}
+}
+func (t *tracker) unfence() {
+	t.fences.Add(-1)
+}
+
+// collect the begun counts into begun, reporting whether no write was in progress. ended must be read before begun, so that an equal pair means no write was in progress when begun was read.
+func (t *tracker) collect(begun *[trackerStripes]uint64) bool {
+	for i := range t.stripes {
+		ended := t.stripes[i].ended.Load()
+		if begun[i] = t.stripes[i].begun.Load(); begun[i] != ended {
+			return false
+		}
+	}
+	return true
+}
+
+// unchanged reports whether no write began since begun was collected.
+func (t *tracker) unchanged(begun *[trackerStripes]uint64) bool {
+	for i := range t.stripes {
+		if t.stripes[i].begun.Load() != begun[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// size sums count at a moment without writes in progress, reporting false if it can't find one in sizeTries. When fence is true, it fences the writes while summing instead of giving up, which only waits for the writes in progress.
+func (t *tracker) size(fence bool) (uint, bool) {
+	var begun [trackerStripes]uint64
+	for range sizeTries {
+		if t.collect(&begun) {
+			if sum := t.sum(); t.unchanged(&begun) {
+				return uint(sum), true
+			}
+		}
+		runtime.Gosched()
+	}
+	if !fence {
+		return 0, false
+	}
+	t.fence()
+	defer t.unfence()
+	return uint(t.sum()), true
+}
+func (t *tracker) sum() (sum int64) {
+	for i := range t.stripes {
+		sum += t.stripes[i].count.Load()
+	}
+	return
+}
+
+// stamp s with the clock unless it's stamped already. A version is stamped by its writer right after it's written, and by anyone who reads it before that, so a version is never used before it's stamped.
+func (t *tracker) stamp(s *atomic.Uint64) {
+	if s.Load() == 0 {
+		s.CompareAndSwap(0, t.clock.Load())
+	}
+}
+
+// version is a value of a key when writes are tracked. The node of the key points to its newest version, which a write replaces by CAS with a new version pointing to it. A write is linearized when its version is stamped with the clock, and Snapshot ticks the clock, so the versions stamped no later than the moment it reads form the map at that moment.
+type version[V any] struct {
+	stamp atomic.Uint64              //0 until stamped, which is always the first field, so that a version of any type can be stamped by linked.
+	prev  atomic.Pointer[version[V]] //the version it replaced, which is dropped once no snapshot can need it.
+	val   V
+	gone  bool //the key is deleted, which is the last version of a node.
+}
+
+// head returns the version at p, stamped.
+func head[V any](t *tracker, p *unsafe.Pointer) *version[V] {
+	h := (*version[V])(atomic.LoadPointer(p))
+	t.stamp(&h.stamp)
+	return h
+}
+
+// replace h, read from p by head, with a version of val, or a deleted one when gone, reporting false when p doesn't hold h anymore. Once the new version is stamped, h is stamped no later than any snapshot that begins, so the versions before h are dropped unless a snapshot is in progress.
+func replace[V any](t *tracker, p *unsafe.Pointer, h *version[V], val V, gone bool) bool {
+	v := &version[V]{val: val, gone: gone}
+	if v.prev.Store(h); !atomic.CompareAndSwapPointer(p, unsafe.Pointer(h), unsafe.Pointer(v)) {
+		return false
+	}
+	if t.stamp(&v.stamp); t.snapshots.Load() == 0 {
+		h.prev.Store(nil)
+	}
+	return true
+}
+
+// swapLive replaces the version at p with a version of val, or a deleted one when gone, unless the key is deleted. It returns the replaced value and whether it's replaced.
+func swapLive[V any](t *tracker, p *unsafe.Pointer, val V, gone bool) (old V, swapped bool) {
+	for {
+		h := head[V](t, p)
+		if h.gone {
+			return old, false
+		} else if replace(t, p, h, val, gone) {
+			return h.val, true
+		}
+	}
+}
+
+// at returns the version at p that is the newest at moment, or nil when the key is absent at moment.
+func at[V any](t *tracker, p *unsafe.Pointer, moment uint64) *version[V] {
+	v := head[V](t, p)
+	for v != nil && v.stamp.Load() > moment {
+		v = v.prev.Load()
+	}
+	if v != nil && v.gone {
+		return nil
+	}
+	return v
+}
+
+// leftNode is a deleted node that a snapshot in progress may still walk, pushed to tracker.left.
+type leftNode struct {
+	n    *relay
+	next *leftNode
+}
+
+func (t *tracker) push(l *leftNode) {
+	for {
+		if l.next = t.left.Load(); t.left.CompareAndSwap(l.next, l) {
+			return
+		}
+	}
+}
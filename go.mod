@@ -1,6 +1,6 @@
 module github.com/g-m-twostay/go-utils
 
-go 1.23
+go 1.24
 
 require (
 	github.com/emirpasic/gods v1.18.1